@@ -3,6 +3,9 @@ package Golang_iso8601_duration
 import (
 	"regexp"
 	"errors"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type duration struct {
@@ -99,3 +102,34 @@ func (duration duration) ISO8601Duration() string {
 
 	return result
 }
+
+// Pattern for durations without years and months, which have no fixed length
+var timeDurationPattern = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseDuration converts an ISO8601 duration such as PT5S or P1DT1H30M to time.Duration,
+// years and months are not supported
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	matches := timeDurationPattern.FindStringSubmatch(value)
+	if matches == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, errors.New("duration value = " + value + " does not match pattern " + timeDurationPattern.String())
+	}
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if matches[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(v * float64(unit))
+	}
+	return d, nil
+}
+
+// FormatDuration converts time.Duration to an ISO8601 duration in seconds, such as PT1.5S
+func FormatDuration(d time.Duration) string {
+	return "PT" + strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S"
+}
@@ -0,0 +1,56 @@
+package Golang_iso8601_duration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"PT5S":        5 * time.Second,
+		"PT1M30S":     90 * time.Second,
+		"PT1.5S":      1500 * time.Millisecond,
+		"PT2H":        2 * time.Hour,
+		"P1D":         24 * time.Hour,
+		"P1DT1H30M":   25*time.Hour + 30*time.Minute,
+		" PT0S ":      0,
+		"PT0.25M":     15 * time.Second,
+		"P1DT0H0M10S": 24*time.Hour + 10*time.Second,
+	}
+	for value, want := range cases {
+		d, err := ParseDuration(value)
+		if err != nil {
+			t.Errorf("ParseDuration(%q) error: %v", value, err)
+			continue
+		}
+		if d != want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", value, d, want)
+		}
+	}
+}
+
+func TestParseDurationInvalid(t *testing.T) {
+	for _, value := range []string{"", "P", "PT", "P1DT", "5S", "P1Y", "P2M", "PT-5S", "PTXS"} {
+		if d, err := ParseDuration(value); err == nil {
+			t.Errorf("ParseDuration(%q) = %v, want error", value, d)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                       "PT0S",
+		5 * time.Second:         "PT5S",
+		1500 * time.Millisecond: "PT1.5S",
+		2 * time.Minute:         "PT120S",
+	}
+	for d, want := range cases {
+		if s := FormatDuration(d); s != want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", d, s, want)
+		}
+		back, err := ParseDuration(FormatDuration(d))
+		if err != nil || back != d {
+			t.Errorf("ParseDuration(FormatDuration(%v)) = %v, %v", d, back, err)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package camera
+
+import (
+	"camera/goonvif/Analytics"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"encoding/xml"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPolygonItem = "Field"    // 区域类规则(tt:FieldDetector)的参数名
+	defaultLineItem    = "Segments" // 越线类规则(tt:LineDetector)的参数名
+)
+
+// 规则中的点，使用摄像头的归一化坐标
+type Point struct {
+	X float64 `json:"x" xml:"x,attr"`
+	Y float64 `json:"y" xml:"y,attr"`
+}
+
+// 分析规则（越线检测、区域入侵等）
+type AnalyticsRule struct {
+	ConfigurationToken string            `json:"configuration_token,omitempty"`
+	Name               string            `json:"name"`
+	Type               string            `json:"type,omitempty"`
+	Parameters         map[string]string `json:"parameters,omitempty"`
+	Polygon            []Point           `json:"polygon,omitempty"`      // 检测区域
+	PolygonItem        string            `json:"polygon_item,omitempty"` // 区域对应的参数名，默认Field
+	Line               []Point           `json:"line,omitempty"`         // 检测线
+	LineItem           string            `json:"line_item,omitempty"`    // 检测线对应的参数名，默认Segments
+}
+
+// 支持的规则或模块类型
+type AnalyticsDescription struct {
+	Type       string   `json:"type"`
+	Parameters []string `json:"parameters,omitempty"`
+	Elements   []string `json:"elements,omitempty"`
+}
+
+// ElementItem中的点集合(tt:Polygon/tt:Polyline)
+type pointList struct {
+	XMLName xml.Name
+	Point   []Point `xml:"Point"`
+}
+
+func (rule *AnalyticsRule) polygonItem() string {
+	if rule.PolygonItem != "" {
+		return rule.PolygonItem
+	}
+	return defaultPolygonItem
+}
+
+func (rule *AnalyticsRule) lineItem() string {
+	if rule.LineItem != "" {
+		return rule.LineItem
+	}
+	return defaultLineItem
+}
+
+// 转换为onvif规则配置
+func (rule *AnalyticsRule) config() onvif.Config {
+	cfg := onvif.Config{Name: rule.Name, Type: xsd.QName(rule.Type)}
+	for name, value := range rule.Parameters {
+		cfg.Parameters.SimpleItem = append(cfg.Parameters.SimpleItem, onvif.SimpleItem{Name: name, Value: xsd.AnySimpleType(value)})
+	}
+	if len(rule.Polygon) > 0 {
+		cfg.Parameters.ElementItem = append(cfg.Parameters.ElementItem, onvif.ElementItem{Name: rule.polygonItem(), Content: pointsXML("Polygon", rule.Polygon)})
+	}
+	if len(rule.Line) > 0 {
+		cfg.Parameters.ElementItem = append(cfg.Parameters.ElementItem, onvif.ElementItem{Name: rule.lineItem(), Content: pointsXML("Polyline", rule.Line)})
+	}
+	return cfg
+}
+
+func pointsXML(tag string, points []Point) string {
+	var b strings.Builder
+	b.WriteString("<onvif:" + tag + ">")
+	for _, p := range points {
+		fmt.Fprintf(&b, `<onvif:Point x="%s" y="%s"/>`, strconv.FormatFloat(p.X, 'f', -1, 64), strconv.FormatFloat(p.Y, 'f', -1, 64))
+	}
+	b.WriteString("</onvif:" + tag + ">")
+	return b.String()
+}
+
+// 从摄像头返回的规则配置转换
+func newAnalyticsRule(token onvif.ReferenceToken, cfg Analytics.Config) AnalyticsRule {
+	rule := AnalyticsRule{ConfigurationToken: string(token), Name: cfg.Name, Type: string(cfg.Type)}
+	if len(cfg.Parameters.SimpleItem) > 0 {
+		rule.Parameters = make(map[string]string, len(cfg.Parameters.SimpleItem))
+		for _, item := range cfg.Parameters.SimpleItem {
+			rule.Parameters[item.Name] = item.Value
+		}
+	}
+	for _, item := range cfg.Parameters.ElementItem {
+		points := pointList{}
+		if err := xml.Unmarshal([]byte(strings.TrimSpace(item.Content)), &points); err != nil {
+			logrus.WithError(err).Debugf("analytics rule %s element %s is not a point list", cfg.Name, item.Name)
+			continue
+		}
+		switch points.XMLName.Local {
+		case "Polygon":
+			rule.Polygon = points.Point
+			rule.PolygonItem = item.Name
+		case "Polyline":
+			rule.Line = points.Point
+			rule.LineItem = item.Name
+		}
+	}
+	return rule
+}
+
+// 获取视频分析配置token，未指定时使用当前Profile的配置
+func analyticsConfigurationToken(camera *ptz.Camera, token string) (onvif.ReferenceToken, error) {
+	if token != "" {
+		return onvif.ReferenceToken(token), nil
+	}
+	profiles, err := camera.GetProfiles()
+	if err != nil {
+		return "", err
+	}
+	token = string(profiles.Profiles.VideoAnalyticsConfiguration.Token)
+	if token == "" {
+		return "", errors.New("camera has no video analytics configuration")
+	}
+	return onvif.ReferenceToken(token), nil
+}
+
+// 获取支持的规则类型
+func AnalyticsGetSupportedRules(value interface{}) error {
+	camera := newCamera()
+	token, _ := value.(string)
+	configurationToken, err := analyticsConfigurationToken(camera, token)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsGetSupportedRules err")
+	}
+
+	resp, err := camera.Analytics_GetSupportedRules(configurationToken)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsGetSupportedRules err")
+	}
+	res := Analytics.GetSupportedRulesResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsGetSupportedRules err")
+	}
+
+	rules := make([]AnalyticsDescription, 0, len(res.SupportedRules.RuleDescription))
+	for _, description := range res.SupportedRules.RuleDescription {
+		rule := AnalyticsDescription{Type: string(description.Name)}
+		for _, item := range description.Parameters.SimpleItemDescription {
+			rule.Parameters = append(rule.Parameters, item.Name)
+		}
+		for _, item := range description.Parameters.ElementItemDescription {
+			rule.Elements = append(rule.Elements, item.Name)
+		}
+		rules = append(rules, rule)
+	}
+	go handleResponse(rules, handleGetSupportedAnalyticsRules)
+	return nil
+}
+
+// 获取分析规则
+func AnalyticsGetRules(value interface{}) error {
+	camera := newCamera()
+	token, _ := value.(string)
+	configurationToken, err := analyticsConfigurationToken(camera, token)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsGetRules err")
+	}
+	return reportAnalyticsRules(camera, configurationToken)
+}
+
+// 上报摄像头当前的分析规则
+func reportAnalyticsRules(camera *ptz.Camera, token onvif.ReferenceToken) error {
+	resp, err := camera.Analytics_GetRules(token)
+	if err != nil {
+		return errors.Wrap(err, "Analytics_GetRules err")
+	}
+	res := Analytics.GetRulesResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return errors.Wrap(err, "Analytics_GetRules err")
+	}
+
+	rules := make([]AnalyticsRule, 0, len(res.Rule))
+	for _, cfg := range res.Rule {
+		rules = append(rules, newAnalyticsRule(token, cfg))
+	}
+	go handleResponse(rules, handleGetAnalyticsRules)
+	return nil
+}
+
+// 创建分析规则
+func AnalyticsCreateRule(value interface{}) error {
+	return applyAnalyticsRule(value, false)
+}
+
+// 修改分析规则
+func AnalyticsModifyRule(value interface{}) error {
+	return applyAnalyticsRule(value, true)
+}
+
+func applyAnalyticsRule(value interface{}, modify bool) error {
+	rule := AnalyticsRule{}
+	if err := decodeDesired(value, &rule); err != nil {
+		return errors.Wrap(err, "decode analytics rule err")
+	}
+	if rule.Name == "" || rule.Type == "" {
+		return errors.New("analytics rule name and type are required")
+	}
+
+	camera := newCamera()
+	token, err := analyticsConfigurationToken(camera, rule.ConfigurationToken)
+	if err != nil {
+		return errors.Wrap(err, "applyAnalyticsRule err")
+	}
+	if err = validateAnalyticsRule(camera, token, &rule); err != nil {
+		return errors.Wrap(err, "validate analytics rule err")
+	}
+
+	if modify {
+		resp, err := camera.Analytics_ModifyRules(token, rule.config())
+		if err != nil {
+			return errors.Wrap(err, "Analytics_ModifyRules err")
+		}
+		err = ptz.ParseResponse(resp, &Analytics.ModifyRulesResponse{})
+		if err != nil {
+			return errors.Wrap(err, "Analytics_ModifyRules err")
+		}
+	} else {
+		resp, err := camera.Analytics_CreateRules(token, rule.config())
+		if err != nil {
+			return errors.Wrap(err, "Analytics_CreateRules err")
+		}
+		err = ptz.ParseResponse(resp, &Analytics.CreateRulesResponse{})
+		if err != nil {
+			return errors.Wrap(err, "Analytics_CreateRules err")
+		}
+	}
+	return reportAnalyticsRules(camera, token)
+}
+
+// 删除分析规则，value为规则名称或{"name":"","configuration_token":""}
+func AnalyticsDeleteRule(value interface{}) error {
+	rule := AnalyticsRule{}
+	if name, ok := value.(string); ok {
+		rule.Name = name
+	} else if err := decodeDesired(value, &rule); err != nil {
+		return errors.Wrap(err, "decode analytics rule err")
+	}
+	if rule.Name == "" {
+		return errors.New("analytics rule name is required")
+	}
+
+	camera := newCamera()
+	token, err := analyticsConfigurationToken(camera, rule.ConfigurationToken)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsDeleteRule err")
+	}
+	resp, err := camera.Analytics_DeleteRules(token, rule.Name)
+	if err != nil {
+		return errors.Wrap(err, "Analytics_DeleteRules err")
+	}
+	err = ptz.ParseResponse(resp, &Analytics.DeleteRulesResponse{})
+	if err != nil {
+		return errors.Wrap(err, "Analytics_DeleteRules err")
+	}
+	return reportAnalyticsRules(camera, token)
+}
+
+// 按照GetRuleOptions校验规则参数
+func validateAnalyticsRule(camera *ptz.Camera, token onvif.ReferenceToken, rule *AnalyticsRule) error {
+	if len(rule.Polygon) > 0 && len(rule.Polygon) < 3 {
+		return errors.Errorf("polygon needs at least 3 points, got %d", len(rule.Polygon))
+	}
+	if len(rule.Line) > 0 && len(rule.Line) < 2 {
+		return errors.Errorf("line needs at least 2 points, got %d", len(rule.Line))
+	}
+
+	resp, err := camera.Analytics_GetRuleOptions(token, rule.Type)
+	if err != nil {
+		return errors.Wrap(err, "Analytics_GetRuleOptions err")
+	}
+	res := Analytics.GetRuleOptionsResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return errors.Wrap(err, "Analytics_GetRuleOptions err")
+	}
+
+	for _, option := range res.RuleOptions {
+		switch {
+		case option.PolygonOptions != nil && option.Name == rule.polygonItem():
+			if err := checkPoints(option.Name, rule.Polygon, option.PolygonOptions); err != nil {
+				return err
+			}
+		case option.PolygonOptions != nil && option.Name == rule.lineItem():
+			if err := checkPoints(option.Name, rule.Line, option.PolygonOptions); err != nil {
+				return err
+			}
+		default:
+			value, ok := rule.Parameters[option.Name]
+			if !ok {
+				continue
+			}
+			if err := checkSimpleItem(option, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkPoints(name string, points []Point, options *Analytics.PolygonOptions) error {
+	if len(points) == 0 {
+		return nil
+	}
+	if limits := options.VertexLimits; limits != nil {
+		if len(points) < limits.Min || (limits.Max > 0 && len(points) > limits.Max) {
+			return errors.Errorf("%s has %d points, camera allows %d~%d", name, len(points), limits.Min, limits.Max)
+		}
+	}
+	xRange := Analytics.FloatRange{Min: -1, Max: 1}
+	yRange := Analytics.FloatRange{Min: -1, Max: 1}
+	if options.RectangleRange != nil {
+		xRange, yRange = options.RectangleRange.XRange, options.RectangleRange.YRange
+	}
+	for _, p := range points {
+		if p.X < xRange.Min || p.X > xRange.Max || p.Y < yRange.Min || p.Y > yRange.Max {
+			return errors.Errorf("%s point (%v,%v) out of range x[%v,%v] y[%v,%v]", name, p.X, p.Y, xRange.Min, xRange.Max, yRange.Min, yRange.Max)
+		}
+	}
+	return nil
+}
+
+func checkSimpleItem(option Analytics.ConfigOptions, value string) error {
+	switch {
+	case option.IntRange != nil:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Errorf("parameter %s must be an integer", option.Name)
+		}
+		if v < option.IntRange.Min || v > option.IntRange.Max {
+			return errors.Errorf("parameter %s=%d out of range [%d,%d]", option.Name, v, option.IntRange.Min, option.IntRange.Max)
+		}
+	case option.FloatRange != nil:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.Errorf("parameter %s must be a number", option.Name)
+		}
+		if v < option.FloatRange.Min || v > option.FloatRange.Max {
+			return errors.Errorf("parameter %s=%v out of range [%v,%v]", option.Name, v, option.FloatRange.Min, option.FloatRange.Max)
+		}
+	case option.StringList != nil:
+		allowed := strings.Fields(*option.StringList)
+		for _, s := range allowed {
+			if s == value {
+				return nil
+			}
+		}
+		return errors.Errorf("parameter %s=%s not in %v", option.Name, value, allowed)
+	}
+	return nil
+}
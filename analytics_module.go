@@ -0,0 +1,399 @@
+package camera
+
+import (
+	"camera/goonvif"
+	"camera/goonvif/Analytics"
+	"camera/goonvif/Media"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// 分析模块（移动侦测、遮挡检测等）
+type AnalyticsModule struct {
+	ConfigurationToken string                `json:"configuration_token,omitempty"`
+	Name               string                `json:"name"`
+	Type               string                `json:"type,omitempty"`
+	Parameters         map[string]string     `json:"parameters,omitempty"` // SimpleItem参数，如Sensitivity
+	Elements           map[string]XMLElement `json:"elements,omitempty"`   // ElementItem参数，如Layout
+}
+
+// xml元素的json表示，子元素保持原有顺序，space为元素的命名空间
+type XMLElement struct {
+	Name     string            `json:"name"`
+	Space    string            `json:"space,omitempty"`
+	Attrs    map[string]string `json:"attrs,omitempty"`
+	Text     string            `json:"text,omitempty"`
+	Children []XMLElement      `json:"children,omitempty"`
+}
+
+// 分析模块参数约束
+type AnalyticsModuleOption struct {
+	Name       string                    `json:"name"`
+	Type       string                    `json:"type,omitempty"`
+	MinOccurs  string                    `json:"min_occurs,omitempty"`
+	MaxOccurs  string                    `json:"max_occurs,omitempty"`
+	IntRange   *onvif.IntRange           `json:"int_range,omitempty"`
+	FloatRange *Analytics.FloatRange     `json:"float_range,omitempty"`
+	StringList []string                  `json:"string_list,omitempty"`
+	Polygon    *Analytics.PolygonOptions `json:"polygon,omitempty"`
+}
+
+// 解析ElementItem中的xml内容
+func parseXMLElement(content string) (XMLElement, error) {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	var stack []*XMLElement
+	var root XMLElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return root, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := XMLElement{Name: t.Name.Local, Space: t.Name.Space}
+			for _, attr := range t.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+					continue
+				}
+				if element.Attrs == nil {
+					element.Attrs = make(map[string]string)
+				}
+				element.Attrs[attr.Name.Local] = attr.Value
+			}
+			if len(stack) == 0 {
+				root = element
+				stack = append(stack, &root)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, element)
+				stack = append(stack, &parent.Children[len(parent.Children)-1])
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return root, nil
+			}
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].Text += strings.TrimSpace(string(t))
+			}
+		}
+	}
+	if root.Name == "" {
+		return root, errors.New("empty element item")
+	}
+	return root, nil
+}
+
+// 生成ElementItem的xml内容，保留元素原有的命名空间，未指定时使用onvif(tt)命名空间
+func (e XMLElement) xml(b *strings.Builder, parentSpace string) {
+	space := e.Space
+	if space == "" {
+		space = goonvif.Xlmns["onvif"]
+	}
+	b.WriteString("<" + e.Name)
+	if space != parentSpace {
+		b.WriteString(` xmlns="`)
+		xml.EscapeText(b, []byte(space))
+		b.WriteString(`"`)
+	}
+	names := make([]string, 0, len(e.Attrs))
+	for name := range e.Attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString(" " + name + `="`)
+		xml.EscapeText(b, []byte(e.Attrs[name]))
+		b.WriteString(`"`)
+	}
+	b.WriteString(">")
+	xml.EscapeText(b, []byte(e.Text))
+	for _, child := range e.Children {
+		child.xml(b, space)
+	}
+	b.WriteString("</" + e.Name + ">")
+}
+
+// 转换为onvif模块配置
+func (module *AnalyticsModule) config() onvif.Config {
+	cfg := onvif.Config{Name: module.Name, Type: xsd.QName(module.Type)}
+	for name, value := range module.Parameters {
+		cfg.Parameters.SimpleItem = append(cfg.Parameters.SimpleItem, onvif.SimpleItem{Name: name, Value: xsd.AnySimpleType(value)})
+	}
+	for name, element := range module.Elements {
+		var b strings.Builder
+		element.xml(&b, "")
+		cfg.Parameters.ElementItem = append(cfg.Parameters.ElementItem, onvif.ElementItem{Name: name, Content: b.String()})
+	}
+	return cfg
+}
+
+// 从摄像头返回的模块配置转换
+func newAnalyticsModule(token onvif.ReferenceToken, cfg Analytics.Config) AnalyticsModule {
+	module := AnalyticsModule{ConfigurationToken: string(token), Name: cfg.Name, Type: string(cfg.Type)}
+	if len(cfg.Parameters.SimpleItem) > 0 {
+		module.Parameters = make(map[string]string, len(cfg.Parameters.SimpleItem))
+		for _, item := range cfg.Parameters.SimpleItem {
+			module.Parameters[item.Name] = item.Value
+		}
+	}
+	for _, item := range cfg.Parameters.ElementItem {
+		element, err := parseXMLElement(item.Content)
+		if err != nil {
+			continue
+		}
+		if module.Elements == nil {
+			module.Elements = make(map[string]XMLElement)
+		}
+		module.Elements[item.Name] = element
+	}
+	return module
+}
+
+// 获取全部视频分析配置token，指定token时只返回该token
+func analyticsConfigurationTokens(camera *ptz.Camera, token string) ([]onvif.ReferenceToken, error) {
+	if token != "" {
+		return []onvif.ReferenceToken{onvif.ReferenceToken(token)}, nil
+	}
+	resp, err := camera.Media_GetVideoAnalyticsConfigurations()
+	if err != nil {
+		return nil, err
+	}
+	res := Media.GetVideoAnalyticsConfigurationsResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, err
+	}
+	tokens := make([]onvif.ReferenceToken, 0, len(res.Configurations))
+	for _, configuration := range res.Configurations {
+		if configuration.Token != "" {
+			tokens = append(tokens, configuration.Token)
+		}
+	}
+	if len(tokens) == 0 {
+		t, err := analyticsConfigurationToken(camera, "")
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// 获取支持的分析模块，按视频分析配置分组上报
+func AnalyticsGetSupportedModules(value interface{}) error {
+	camera := newCamera()
+	token, _ := value.(string)
+	tokens, err := analyticsConfigurationTokens(camera, token)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsGetSupportedModules err")
+	}
+
+	supported := make(map[string][]AnalyticsDescription, len(tokens))
+	for _, t := range tokens {
+		resp, err := camera.Analytics_GetSupportedAnalyticsModules(t)
+		if err != nil {
+			return errors.Wrap(err, "Analytics_GetSupportedAnalyticsModules err")
+		}
+		res := Analytics.GetSupportedAnalyticsModulesResponse{}
+		if err = ptz.ParseResponse(resp, &res); err != nil {
+			return errors.Wrap(err, "Analytics_GetSupportedAnalyticsModules err")
+		}
+
+		modules := make([]AnalyticsDescription, 0, len(res.SupportedAnalyticsModules.AnalyticsModuleDescription))
+		for _, description := range res.SupportedAnalyticsModules.AnalyticsModuleDescription {
+			module := AnalyticsDescription{Type: string(description.Name)}
+			for _, item := range description.Parameters.SimpleItemDescription {
+				module.Parameters = append(module.Parameters, item.Name)
+			}
+			for _, item := range description.Parameters.ElementItemDescription {
+				module.Elements = append(module.Elements, item.Name)
+			}
+			modules = append(modules, module)
+		}
+		supported[string(t)] = modules
+	}
+	go handleResponse(supported, handleGetSupportedAnalyticsModules)
+	return nil
+}
+
+// 获取分析模块，按视频分析配置分组上报
+func AnalyticsGetModules(value interface{}) error {
+	camera := newCamera()
+	token, _ := value.(string)
+	tokens, err := analyticsConfigurationTokens(camera, token)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsGetModules err")
+	}
+	return reportAnalyticsModules(camera, tokens)
+}
+
+// 上报摄像头当前的分析模块
+func reportAnalyticsModules(camera *ptz.Camera, tokens []onvif.ReferenceToken) error {
+	modules := make(map[string][]AnalyticsModule, len(tokens))
+	for _, t := range tokens {
+		resp, err := camera.Analytics_GetAnalyticsModules(t)
+		if err != nil {
+			return errors.Wrap(err, "Analytics_GetAnalyticsModules err")
+		}
+		res := Analytics.GetAnalyticsModulesResponse{}
+		if err = ptz.ParseResponse(resp, &res); err != nil {
+			return errors.Wrap(err, "Analytics_GetAnalyticsModules err")
+		}
+		list := make([]AnalyticsModule, 0, len(res.AnalyticsModule))
+		for _, cfg := range res.AnalyticsModule {
+			list = append(list, newAnalyticsModule(t, cfg))
+		}
+		modules[string(t)] = list
+	}
+	go handleResponse(modules, handleGetAnalyticsModules)
+	return nil
+}
+
+// 获取分析模块参数约束，value为{"type":"tt:CellMotionEngine","configuration_token":""}
+func AnalyticsGetModuleOptions(value interface{}) error {
+	module := AnalyticsModule{}
+	if err := decodeDesired(value, &module); err != nil {
+		return errors.Wrap(err, "decode analytics module err")
+	}
+	if module.Type == "" {
+		return errors.New("analytics module type is required")
+	}
+
+	camera := newCamera()
+	token, err := analyticsConfigurationToken(camera, module.ConfigurationToken)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsGetModuleOptions err")
+	}
+	options, err := getAnalyticsModuleOptions(camera, token, module.Type)
+	if err != nil {
+		return err
+	}
+
+	result := make([]AnalyticsModuleOption, 0, len(options))
+	for _, option := range options {
+		o := AnalyticsModuleOption{
+			Name:       option.Name,
+			Type:       string(option.Type),
+			MinOccurs:  option.MinOccurs,
+			MaxOccurs:  option.MaxOccurs,
+			IntRange:   option.IntRange,
+			FloatRange: option.FloatRange,
+			Polygon:    option.PolygonOptions,
+		}
+		if option.StringList != nil {
+			o.StringList = strings.Fields(*option.StringList)
+		}
+		result = append(result, o)
+	}
+	go handleResponse(result, handleGetAnalyticsModuleOptions)
+	return nil
+}
+
+func getAnalyticsModuleOptions(camera *ptz.Camera, token onvif.ReferenceToken, moduleType string) ([]Analytics.ConfigOptions, error) {
+	resp, err := camera.Analytics_GetAnalyticsModuleOptions(token, moduleType)
+	if err != nil {
+		return nil, errors.Wrap(err, "Analytics_GetAnalyticsModuleOptions err")
+	}
+	res := Analytics.GetAnalyticsModuleOptionsResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, errors.Wrap(err, "Analytics_GetAnalyticsModuleOptions err")
+	}
+	return res.Options, nil
+}
+
+// 创建分析模块
+func AnalyticsCreateModule(value interface{}) error {
+	return applyAnalyticsModule(value, false)
+}
+
+// 修改分析模块，如调整移动侦测灵敏度、单元格布局
+func AnalyticsModifyModule(value interface{}) error {
+	return applyAnalyticsModule(value, true)
+}
+
+func applyAnalyticsModule(value interface{}, modify bool) error {
+	module := AnalyticsModule{}
+	if err := decodeDesired(value, &module); err != nil {
+		return errors.Wrap(err, "decode analytics module err")
+	}
+	if module.Name == "" || module.Type == "" {
+		return errors.New("analytics module name and type are required")
+	}
+
+	camera := newCamera()
+	token, err := analyticsConfigurationToken(camera, module.ConfigurationToken)
+	if err != nil {
+		return errors.Wrap(err, "applyAnalyticsModule err")
+	}
+
+	options, err := getAnalyticsModuleOptions(camera, token, module.Type)
+	if err != nil {
+		return err
+	}
+	for _, option := range options {
+		if v, ok := module.Parameters[option.Name]; ok {
+			if err := checkSimpleItem(option, v); err != nil {
+				return errors.Wrap(err, "validate analytics module err")
+			}
+		}
+	}
+
+	if modify {
+		resp, err := camera.Analytics_ModifyAnalyticsModules(token, module.config())
+		if err != nil {
+			return errors.Wrap(err, "Analytics_ModifyAnalyticsModules err")
+		}
+		err = ptz.ParseResponse(resp, &Analytics.ModifyAnalyticsModulesResponse{})
+		if err != nil {
+			return errors.Wrap(err, "Analytics_ModifyAnalyticsModules err")
+		}
+	} else {
+		resp, err := camera.Analytics_CreateAnalyticsModules(token, module.config())
+		if err != nil {
+			return errors.Wrap(err, "Analytics_CreateAnalyticsModules err")
+		}
+		err = ptz.ParseResponse(resp, &Analytics.CreateAnalyticsModulesResponse{})
+		if err != nil {
+			return errors.Wrap(err, "Analytics_CreateAnalyticsModules err")
+		}
+	}
+	return reportAnalyticsModules(camera, []onvif.ReferenceToken{token})
+}
+
+// 删除分析模块，value为模块名称或{"name":"","configuration_token":""}
+func AnalyticsDeleteModule(value interface{}) error {
+	module := AnalyticsModule{}
+	if name, ok := value.(string); ok {
+		module.Name = name
+	} else if err := decodeDesired(value, &module); err != nil {
+		return errors.Wrap(err, "decode analytics module err")
+	}
+	if module.Name == "" {
+		return errors.New("analytics module name is required")
+	}
+
+	camera := newCamera()
+	token, err := analyticsConfigurationToken(camera, module.ConfigurationToken)
+	if err != nil {
+		return errors.Wrap(err, "AnalyticsDeleteModule err")
+	}
+	resp, err := camera.Analytics_DeleteAnalyticsModules(token, module.Name)
+	if err != nil {
+		return errors.Wrap(err, "Analytics_DeleteAnalyticsModules err")
+	}
+	err = ptz.ParseResponse(resp, &Analytics.DeleteAnalyticsModulesResponse{})
+	if err != nil {
+		return errors.Wrap(err, "Analytics_DeleteAnalyticsModules err")
+	}
+	return reportAnalyticsModules(camera, []onvif.ReferenceToken{token})
+}
@@ -0,0 +1,65 @@
+package camera
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const cellLayout = `<tt:CellLayout xmlns:tt="http://www.onvif.org/ver10/schema" Columns="22" Rows="18"><tt:Transformation><tt:Translate x="-1.0" y="-1.0"/><tt:Scale x="0.09" y="0.11"/></tt:Transformation></tt:CellLayout>`
+
+func TestXMLElementRoundTrip(t *testing.T) {
+	element, err := parseXMLElement(cellLayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if element.Name != "CellLayout" || element.Space != "http://www.onvif.org/ver10/schema" {
+		t.Errorf("unexpected root %s %s", element.Space, element.Name)
+	}
+	if element.Attrs["Columns"] != "22" || len(element.Children) != 1 || len(element.Children[0].Children) != 2 {
+		t.Fatalf("unexpected element %+v", element)
+	}
+
+	// json下发后再转换为xml，结构不变
+	b, err := json.Marshal(element)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := XMLElement{}
+	if err = json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	var xml strings.Builder
+	decoded.xml(&xml, "")
+	again, err := parseXMLElement(xml.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, element) {
+		t.Errorf("round trip changed the element:\n%s\n%+v\n%+v", xml.String(), again, element)
+	}
+}
+
+func TestXMLElementKeepsNamespace(t *testing.T) {
+	element, err := parseXMLElement(`<ax:Polygon xmlns:ax="http://www.example.com/analytics" xmlns:tt="http://www.onvif.org/ver10/schema"><tt:Point x="0" y="0"/></ax:Polygon>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var xml strings.Builder
+	element.xml(&xml, "")
+	want := `<Polygon xmlns="http://www.example.com/analytics"><Point xmlns="http://www.onvif.org/ver10/schema" x="0" y="0"></Point></Polygon>`
+	if xml.String() != want {
+		t.Errorf("xml = %s, want %s", xml.String(), want)
+	}
+}
+
+func TestXMLElementDefaultNamespace(t *testing.T) {
+	element := XMLElement{Name: "Layout", Children: []XMLElement{{Name: "Cell", Text: "a<b"}}}
+	var xml strings.Builder
+	element.xml(&xml, "")
+	want := `<Layout xmlns="http://www.onvif.org/ver10/schema"><Cell>a&lt;b</Cell></Layout>`
+	if xml.String() != want {
+		t.Errorf("xml = %s, want %s", xml.String(), want)
+	}
+}
@@ -0,0 +1,396 @@
+package camera
+
+import (
+	"bytes"
+	"camera/config"
+	"camera/goonvif/Device"
+	"camera/goonvif/networking"
+	"camera/ptz"
+	"camera/storage"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	backupKey         = "hub:camera:backup:%s" // 摄像头的备份记录
+	defaultBackupKeep = 10
+)
+
+// 备份文件，fid为文件服务器上的文件
+type BackupFileRecord struct {
+	Name string `json:"name"`
+	Fid  string `json:"fid"`
+	Size int    `json:"size"`
+}
+
+// 一次备份，记录摄像头型号，恢复到其他型号时需要force
+type BackupRecord struct {
+	ID              string             `json:"id"`
+	Files           []BackupFileRecord `json:"files"`
+	Source          string             `json:"source"`
+	Manufacturer    string             `json:"manufacturer"`
+	Model           string             `json:"model"`
+	FirmwareVersion string             `json:"firmware_version"`
+	SerialNumber    string             `json:"serial_number"`
+	CreatedAt       int64              `json:"created_at"`
+}
+
+// 恢复命令，id为空时恢复最新的备份
+type RestoreCommand struct {
+	ID    string `json:"id"`
+	Force bool   `json:"force"`
+}
+
+// 设备的备份记录，新的在前
+type SystemBackupList struct {
+	Did     string         `json:"did"`
+	Backups []BackupRecord `json:"backups"`
+}
+
+// 备份摄像头配置到文件服务器并记录到redis
+func DeviceBackupSystem() error {
+	if config.C.Redis.Pool == nil {
+		return errors.New("redis is not configured")
+	}
+	camera := newCamera()
+	info, err := getDeviceInformation(camera)
+	if err != nil {
+		return err
+	}
+	files, source, err := getSystemBackup(camera)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	id, err := newBackupID(now)
+	if err != nil {
+		return err
+	}
+	record := BackupRecord{
+		ID:              id,
+		Source:          source,
+		Manufacturer:    info.Manufacturer,
+		Model:           info.Model,
+		FirmwareVersion: info.FirmwareVersion,
+		SerialNumber:    info.SerialNumber,
+		CreatedAt:       now.Unix(),
+	}
+	for name, content := range files {
+		fid, err := uploadContent("backup_"+record.ID+"_"+name, content)
+		if err != nil {
+			return errors.Wrap(err, "upload backup err")
+		}
+		record.Files = append(record.Files, BackupFileRecord{Name: name, Fid: fid, Size: len(content)})
+	}
+
+	backups, err := loadBackups()
+	if err != nil {
+		return err
+	}
+	keep := config.C.SystemBackup.Keep
+	if keep <= 0 {
+		keep = defaultBackupKeep
+	}
+	backups.Backups = append([]BackupRecord{record}, backups.Backups...)
+	var rotated []BackupRecord
+	if len(backups.Backups) > keep {
+		rotated = backups.Backups[keep:]
+		backups.Backups = backups.Backups[:keep]
+	}
+	if err = saveBackups(backups); err != nil {
+		return err
+	}
+	// 记录保存后再删除文件服务器上超出保留数量的备份，删除失败只记录日志
+	for _, old := range rotated {
+		for _, file := range old.Files {
+			if err := deleteFile(file.Fid); err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{"id": old.ID, "fid": file.Fid}).Warn("delete rotated backup error")
+			}
+		}
+	}
+	NewEntry(Fields{"did": backups.Did, "id": record.ID, "files": len(record.Files)}).DownLink("system backup saved")
+	go handleResponse(backups, handleGetSystemBackups)
+	return nil
+}
+
+// 备份ID，时间后加随机后缀，同一秒内的备份不会重复
+func newBackupID(now time.Time) (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generate backup id err")
+	}
+	return now.Format("20060102150405") + "-" + hex.EncodeToString(b), nil
+}
+
+// 获取备份文件，优先使用GetSystemBackup的MTOM附件，不支持时通过GetSystemUris下载
+func getSystemBackup(camera *ptz.Camera) (map[string][]byte, string, error) {
+	files := make(map[string][]byte)
+	resp, err := camera.Device_GetSystemBackup()
+	if err == nil {
+		res := Device.GetSystemBackupResponse{}
+		attachments, perr := ptz.ParseResponseWithAttachments(resp, &res)
+		if perr == nil {
+			for i, f := range res.BackupFiles {
+				if b, ok := ptz.Attachment(attachments, f.Data.Include.Href); ok {
+					name := f.Name
+					if name == "" {
+						name = fmt.Sprintf("backup%d.bin", i)
+					}
+					files[name] = b
+				}
+			}
+			if len(files) > 0 {
+				return files, "onvif", nil
+			}
+		}
+		err = perr
+	}
+	logrus.WithError(err).Debug("system backup not returned by onvif, try system uris")
+
+	resp, err = camera.Device_GetSystemUris()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "GetSystemUris err")
+	}
+	uris := Device.GetSystemUrisResponse{}
+	if err = ptz.ParseResponse(resp, &uris); err != nil {
+		return nil, "", errors.Wrap(err, "GetSystemUris err")
+	}
+	if uris.SystemBackupUri == "" {
+		return nil, "", errors.New("camera does not support system backup")
+	}
+	b, err := downloadSystemFile(camera, uris.SystemBackupUri)
+	if err != nil {
+		return nil, "", err
+	}
+	files["backup.bin"] = b
+	return files, "http", nil
+}
+
+// 上报备份记录
+func DeviceGetSystemBackups() error {
+	if config.C.Redis.Pool == nil {
+		return errors.New("redis is not configured")
+	}
+	backups, err := loadBackups()
+	if err != nil {
+		return err
+	}
+	go handleResponse(backups, handleGetSystemBackups)
+	return nil
+}
+
+// 恢复备份，value为{"id":"20200101120000","force":false}，更换同型号的摄像头后直接恢复最新的备份
+func DeviceRestoreSystemBackup(value interface{}, commandID string) error {
+	cmd := RestoreCommand{}
+	if value != nil {
+		if err := decodeDesired(value, &cmd); err != nil {
+			return errors.Wrap(err, "decode restore command err")
+		}
+	}
+	if config.C.Redis.Pool == nil {
+		return errors.New("redis is not configured")
+	}
+	backups, err := loadBackups()
+	if err != nil {
+		return err
+	}
+	var record *BackupRecord
+	for i := range backups.Backups {
+		if cmd.ID == "" || backups.Backups[i].ID == cmd.ID {
+			record = &backups.Backups[i]
+			break
+		}
+	}
+	if record == nil {
+		return errors.Errorf("backup %s not found", cmd.ID)
+	}
+	if len(record.Files) != 1 {
+		return errors.Errorf("backup %s has %d files, only single file backups can be restored", record.ID, len(record.Files))
+	}
+
+	camera := newCamera()
+	info, err := getDeviceInformation(camera)
+	if err != nil {
+		return err
+	}
+	if !cmd.Force && (info.Manufacturer != record.Manufacturer || info.Model != record.Model) {
+		audit(RestoreSystemBackup, "rejected", commandID, record)
+		return errors.Errorf("backup is from %s %s, camera is %s %s", record.Manufacturer, record.Model, info.Manufacturer, info.Model)
+	}
+
+	file := record.Files[0]
+	content, err := downloadBackup(file.Fid)
+	if err != nil {
+		return err
+	}
+	audit(RestoreSystemBackup, "requested", commandID, record)
+	downTime, err := restoreSystem(camera, file.Name, content)
+	if err != nil {
+		audit(RestoreSystemBackup, "failed", commandID, err.Error())
+		return err
+	}
+	// 从上传完成开始等待摄像头下线
+	start := time.Now()
+	audit(RestoreSystemBackup, "executed", commandID, map[string]interface{}{"id": record.ID, "serial_number": info.SerialNumber})
+
+	// 恢复后摄像头会重启
+	go func() {
+		timeout := onlineWaitTimeout
+		if downTime*2 > timeout {
+			timeout = downTime * 2
+		}
+		recovery := waitRecovery(RestoreSystemBackup, start, timeout)
+		audit(RestoreSystemBackup, "recovery_"+recovery.Status, commandID, recovery)
+		switch recovery.Status {
+		case "recovered":
+			go ReportInventory()
+		case "not_offline":
+			audit(RestoreSystemBackup, "failed", commandID, "camera did not reboot after restore")
+		}
+	}()
+	return nil
+}
+
+// 优先通过StartSystemRestore返回的地址上传，摄像头不支持时才使用RestoreSystem，返回预计的离线时间
+func restoreSystem(camera *ptz.Camera, name string, content []byte) (time.Duration, error) {
+	start, err := startSystemRestore(camera)
+	if err == nil {
+		if err = postBackup(camera, string(start.UploadUri), content); err != nil {
+			return 0, err
+		}
+		downTime, _ := start.ExpectedDownTime.TimeDuration()
+		return downTime, nil
+	}
+	if !actionNotSupported(err) {
+		return 0, err
+	}
+	logrus.WithError(err).Warn("StartSystemRestore not supported, fallback to RestoreSystem")
+
+	resp, err := camera.Device_RestoreSystem(name, content)
+	if err != nil {
+		return 0, errors.Wrap(err, "RestoreSystem err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.RestoreSystemResponse{}); err != nil {
+		return 0, errors.Wrap(err, "RestoreSystem err")
+	}
+	return 0, nil
+}
+
+func startSystemRestore(camera *ptz.Camera) (*Device.StartSystemRestoreResponse, error) {
+	resp, err := camera.Device_StartSystemRestore()
+	if err != nil {
+		return nil, errors.Wrap(err, "StartSystemRestore err")
+	}
+	res := &Device.StartSystemRestoreResponse{}
+	if err = ptz.ParseResponse(resp, res); err != nil {
+		return nil, errors.Wrap(err, "StartSystemRestore err")
+	}
+	if res.UploadUri == "" {
+		return nil, errors.Wrap(errActionNotSupported, "StartSystemRestore err: empty upload uri")
+	}
+	return res, nil
+}
+
+// 以application/octet-stream上传备份，摄像头要求Digest认证时重新上传
+func postBackup(camera *ptz.Camera, uri string, content []byte) error {
+	newBody := func() io.Reader { return bytes.NewReader(content) }
+	auth := &networking.DigestAuth{Username: camera.Username, Password: camera.Password}
+	resp, err := networking.Upload(uri, "application/octet-stream", int64(len(content)), newBody, auth, upgradeHTTPTimeout)
+	if err != nil {
+		return errors.Wrap(err, "upload backup err")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return errors.Errorf("upload backup err: %s", resp.Status)
+	}
+	return nil
+}
+
+// 从文件服务器下载备份
+func downloadBackup(fid string) ([]byte, error) {
+	url, err := fileDownloadURL(fid)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: upgradeHTTPTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "download backup err")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("download backup err: %s", resp.Status)
+	}
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "download backup err")
+	}
+	if len(content) == 0 {
+		return nil, errors.New("backup is empty")
+	}
+	return content, nil
+}
+
+func loadBackups() (*SystemBackupList, error) {
+	id := deviceID()
+	backups := &SystemBackupList{Did: id, Backups: []BackupRecord{}}
+	b, err := redis.Bytes(storage.Get(fmt.Sprintf(backupKey, id)))
+	if err == redis.ErrNil {
+		return backups, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "load backups err")
+	}
+	if err = json.Unmarshal(b, backups); err != nil {
+		return nil, errors.Wrap(err, "decode backups err")
+	}
+	return backups, nil
+}
+
+func saveBackups(backups *SystemBackupList) error {
+	b, err := json.Marshal(backups)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(storage.Set(fmt.Sprintf(backupKey, backups.Did), b), "save backups err")
+}
+
+// 设备ID，没有收到下行命令时从上报主题中获取
+func deviceID() string {
+	if did != "" {
+		return did
+	}
+	if pubSub != nil {
+		if s := strings.Split(pubSub.rxTopic, "/"); len(s) > 2 {
+			return s[2]
+		}
+	}
+	return config.C.General.Name
+}
+
+// 定时备份摄像头配置
+func SystemBackupSchedule() {
+	interval := config.C.SystemBackup.Interval
+	if interval <= 0 || config.C.Redis.Pool == nil {
+		logrus.Info("scheduled system backup is disabled")
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		if err := DeviceBackupSystem(); err != nil {
+			logrus.WithError(err).Error("system backup error")
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/goonvif/Device"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultHTTPSPort = 443
+
+// 摄像头证书，时间为RFC3339，fingerprint为sha256指纹
+type CameraCertificate struct {
+	ID          string `json:"id"`
+	Subject     string `json:"subject,omitempty"`
+	Issuer      string `json:"issuer,omitempty"`
+	NotBefore   string `json:"not_before,omitempty"`
+	NotAfter    string `json:"not_after,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// 摄像头证书和客户端证书模式
+type CertificateInfo struct {
+	Certificates          []CameraCertificate `json:"certificates"`
+	CACertificates        []CameraCertificate `json:"ca_certificates"`
+	ClientCertificateMode bool                `json:"client_certificate_mode"`
+}
+
+// 证书签名请求，csr为PEM格式
+type CertificateRequest struct {
+	CertificateID string `json:"certificate_id"`
+	Subject       string `json:"subject"`
+	ValidDays     int    `json:"valid_days,omitempty"`
+	CSR           string `json:"csr,omitempty"`
+}
+
+// 上传的证书，certificate为PEM格式，包含证书链时只使用第一个证书
+type CertificateUpload struct {
+	CertificateID string `json:"certificate_id"`
+	Certificate   string `json:"certificate"`
+}
+
+// 启用https，switch为true时网关改用https访问摄像头
+type HTTPSSetting struct {
+	CertificateID string `json:"certificate_id"`
+	Port          int    `json:"port,omitempty"`
+	Switch        bool   `json:"switch"`
+}
+
+// 获取摄像头证书
+func DeviceGetCertificates() error {
+	camera := newCamera()
+	info, err := getCertificates(camera)
+	if err != nil {
+		return err
+	}
+	go handleResponse(info, handleGetCertificates)
+	return nil
+}
+
+func getCertificates(camera *ptz.Camera) (*CertificateInfo, error) {
+	resp, err := camera.Device_GetCertificates()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetCertificates err")
+	}
+	certificates := Device.GetCertificatesResponse{}
+	if err = ptz.ParseResponse(resp, &certificates); err != nil {
+		return nil, errors.Wrap(err, "GetCertificates err")
+	}
+	info := &CertificateInfo{Certificates: []CameraCertificate{}, CACertificates: []CameraCertificate{}}
+
+	enabled := make(map[string]bool)
+	resp, err = camera.Device_GetCertificatesStatus()
+	if err == nil {
+		status := Device.GetCertificatesStatusResponse{}
+		if ptz.ParseResponse(resp, &status) == nil {
+			for _, s := range status.CertificateStatus {
+				enabled[s.CertificateID] = bool(s.Status)
+			}
+		}
+	}
+	for _, c := range certificates.NvtCertificate {
+		certificate := parseCameraCertificate(c)
+		certificate.Enabled = enabled[c.CertificateID]
+		info.Certificates = append(info.Certificates, certificate)
+	}
+
+	// CA证书和客户端证书模式是可选功能，不支持时不上报
+	resp, err = camera.Device_GetCACertificates()
+	if err == nil {
+		ca := Device.GetCACertificatesResponse{}
+		if ptz.ParseResponse(resp, &ca) == nil {
+			for _, c := range ca.CACertificate {
+				info.CACertificates = append(info.CACertificates, parseCameraCertificate(c))
+			}
+		}
+	}
+	resp, err = camera.Device_GetClientCertificateMode()
+	if err == nil {
+		mode := Device.GetClientCertificateModeResponse{}
+		if ptz.ParseResponse(resp, &mode) == nil {
+			info.ClientCertificateMode = bool(mode.Enabled)
+		}
+	}
+	return info, nil
+}
+
+func parseCameraCertificate(c Device.Certificate) CameraCertificate {
+	certificate := CameraCertificate{ID: c.CertificateID}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(c.Certificate.Data))
+	if err != nil {
+		return certificate
+	}
+	certificate.Fingerprint = certificateFingerprint(der)
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		certificate.Subject = cert.Subject.String()
+		certificate.Issuer = cert.Issuer.String()
+		certificate.NotBefore = cert.NotBefore.Format(time.RFC3339)
+		certificate.NotAfter = cert.NotAfter.Format(time.RFC3339)
+	}
+	return certificate
+}
+
+// 证书的sha256指纹，格式与tls_fingerprint配置相同
+func certificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// 在摄像头上生成密钥并上报证书签名请求，value为{"certificate_id":"gateway","subject":"CN=camera-01,O=example","valid_days":365}
+func DeviceCreateCertificateRequest(value interface{}) error {
+	req := CertificateRequest{}
+	if err := decodeDesired(value, &req); err != nil {
+		return errors.Wrap(err, "decode certificate request err")
+	}
+	if req.Subject == "" {
+		_, host, _ := splitCameraAddr(config.CameraAddr())
+		req.Subject = "CN=" + host
+	}
+	notAfter := ""
+	if req.ValidDays > 0 {
+		notAfter = time.Now().AddDate(0, 0, req.ValidDays).UTC().Format(time.RFC3339)
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_CreateCertificate(req.CertificateID, req.Subject, notAfter)
+	if err != nil {
+		return errors.Wrap(err, "CreateCertificate err")
+	}
+	created := Device.CreateCertificateResponse{}
+	if err = ptz.ParseResponse(resp, &created); err != nil {
+		return errors.Wrap(err, "CreateCertificate err")
+	}
+	// 没有指定id时由摄像头分配
+	if created.NvtCertificate.CertificateID != "" {
+		req.CertificateID = created.NvtCertificate.CertificateID
+	}
+
+	resp, err = camera.Device_GetPkcs10Request(req.CertificateID, req.Subject)
+	if err != nil {
+		return errors.Wrap(err, "GetPkcs10Request err")
+	}
+	res := Device.GetPkcs10RequestResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return errors.Wrap(err, "GetPkcs10Request err")
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(res.Pkcs10Request.Data))
+	if err != nil {
+		return errors.Wrap(err, "decode pkcs10 request err")
+	}
+	req.CSR = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	go handleResponse(req, handleCreateCertificateRequest)
+	return nil
+}
+
+// 上传CA签名后的证书，替换同id的自签名证书
+func DeviceLoadCertificate(value interface{}, commandID string) error {
+	upload, der, err := decodeCertificateUpload(value)
+	if err != nil {
+		return err
+	}
+	camera := newCamera()
+	resp, err := camera.Device_LoadCertificates(upload.CertificateID, der)
+	if err != nil {
+		return errors.Wrap(err, "LoadCertificates err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.LoadCertificatesResponse{}); err != nil {
+		audit(LoadCertificate, "failed", commandID, err.Error())
+		return errors.Wrap(err, "LoadCertificates err")
+	}
+	audit(LoadCertificate, "executed", commandID, map[string]string{"certificate_id": upload.CertificateID, "fingerprint": certificateFingerprint(der)})
+	return DeviceGetCertificates()
+}
+
+// 上传CA证书，用于校验客户端证书
+func DeviceLoadCACertificate(value interface{}, commandID string) error {
+	upload, der, err := decodeCertificateUpload(value)
+	if err != nil {
+		return err
+	}
+	camera := newCamera()
+	resp, err := camera.Device_LoadCACertificates(upload.CertificateID, der)
+	if err != nil {
+		return errors.Wrap(err, "LoadCACertificates err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.LoadCACertificatesResponse{}); err != nil {
+		audit(LoadCACertificate, "failed", commandID, err.Error())
+		return errors.Wrap(err, "LoadCACertificates err")
+	}
+	audit(LoadCACertificate, "executed", commandID, map[string]string{"certificate_id": upload.CertificateID, "fingerprint": certificateFingerprint(der)})
+	return DeviceGetCertificates()
+}
+
+func decodeCertificateUpload(value interface{}) (*CertificateUpload, []byte, error) {
+	upload := &CertificateUpload{}
+	if err := decodeDesired(value, upload); err != nil {
+		return nil, nil, errors.Wrap(err, "decode certificate err")
+	}
+	if upload.CertificateID == "" {
+		return nil, nil, errors.New("certificate_id is required")
+	}
+	block, _ := pem.Decode([]byte(upload.Certificate))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, nil, errors.New("certificate is not a PEM certificate")
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, nil, errors.Wrap(err, "parse certificate err")
+	}
+	return upload, block.Bytes, nil
+}
+
+// 设置是否要求客户端证书，value为true/false或{"enabled":true}
+func DeviceSetClientCertificateMode(value interface{}) error {
+	enabled, ok := value.(bool)
+	if !ok {
+		mode := struct {
+			Enabled bool `json:"enabled"`
+		}{}
+		if err := decodeDesired(value, &mode); err != nil {
+			return errors.Wrap(err, "decode client certificate mode err")
+		}
+		enabled = mode.Enabled
+	}
+	camera := newCamera()
+	resp, err := camera.Device_SetClientCertificateMode(enabled)
+	if err != nil {
+		return errors.Wrap(err, "SetClientCertificateMode err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.SetClientCertificateModeResponse{}); err != nil {
+		return errors.Wrap(err, "SetClientCertificateMode err")
+	}
+	return DeviceGetCertificates()
+}
+
+// 启用证书和https端口，value为{"certificate_id":"gateway","port":443,"switch":true}，
+// switch为true时网关改用https访问摄像头，没有配置CA时固定该证书的指纹
+func DeviceEnableHTTPS(value interface{}, commandID string) error {
+	setting := HTTPSSetting{}
+	if err := decodeDesired(value, &setting); err != nil {
+		return errors.Wrap(err, "decode https setting err")
+	}
+	if setting.CertificateID == "" {
+		return errors.New("certificate_id is required")
+	}
+	if setting.Port == 0 {
+		setting.Port = defaultHTTPSPort
+	}
+
+	camera := newCamera()
+	info, err := getCertificates(camera)
+	if err != nil {
+		return err
+	}
+	var certificate *CameraCertificate
+	for i := range info.Certificates {
+		if info.Certificates[i].ID == setting.CertificateID {
+			certificate = &info.Certificates[i]
+		}
+	}
+	if certificate == nil {
+		return errors.Errorf("certificate %s not found", setting.CertificateID)
+	}
+
+	audit(EnableHTTPS, "requested", commandID, setting)
+	resp, err := camera.Device_SetCertificatesStatus(setting.CertificateID, true)
+	if err != nil {
+		return errors.Wrap(err, "SetCertificatesStatus err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.SetCertificatesStatusResponse{}); err != nil {
+		audit(EnableHTTPS, "failed", commandID, err.Error())
+		return errors.Wrap(err, "SetCertificatesStatus err")
+	}
+
+	// 只修改HTTPS端口，其他协议保持不变
+	protocols, err := getNetworkProtocols(camera)
+	if err != nil {
+		return err
+	}
+	settings := []onvif.NetworkProtocol{{Name: "HTTPS", Enabled: true, Port: xsd.Int(setting.Port)}}
+	for _, p := range protocols {
+		if p.Name != "HTTPS" {
+			settings = append(settings, onvif.NetworkProtocol{Name: onvif.NetworkProtocolType(p.Name), Enabled: xsd.Boolean(p.Enabled), Port: xsd.Int(p.Port)})
+		}
+	}
+	resp, err = camera.Device_SetNetworkProtocols(settings)
+	if err != nil {
+		return errors.Wrap(err, "SetNetworkProtocols err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.SetNetworkProtocolsResponse{}); err != nil {
+		audit(EnableHTTPS, "failed", commandID, err.Error())
+		return errors.Wrap(err, "SetNetworkProtocols err")
+	}
+	audit(EnableHTTPS, "executed", commandID, certificate)
+
+	if !setting.Switch {
+		return DeviceGetCertificates()
+	}
+	if config.C.General.TLSCACert == "" && !config.C.General.TLSInsecureSkipVerify {
+		config.C.General.TLSFingerprint = certificate.Fingerprint
+		if err := config.Save("general.tls_fingerprint", certificate.Fingerprint); err != nil {
+			return errors.Wrap(err, "save tls fingerprint err")
+		}
+	}
+	_, host, _ := splitCameraAddr(config.CameraAddr())
+	go followAddressChange(EnableHTTPS, "https://"+net.JoinHostPort(host, strconv.Itoa(setting.Port)), false, commandID)
+	return nil
+}
@@ -0,0 +1,103 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/goonvif"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+const (
+	ClockDriftIndex = "clock_drift" // 时钟偏差指标
+
+	defaultDriftInterval  = time.Minute * 10
+	defaultDriftThreshold = time.Second * 5
+)
+
+// 摄像头时钟偏差，offset为摄像头时间减去网关时间
+type ClockDrift struct {
+	OffsetMs     int64  `json:"offset_ms"`
+	RoundTripMs  int64  `json:"round_trip_ms"`
+	CameraTime   string `json:"camera_time"`
+	DateTimeType string `json:"date_time_type"` // NTP/Manual
+	MeasuredAt   int64  `json:"measured_at"`
+	Calibrated   bool   `json:"calibrated"`
+	NTPResync    bool   `json:"ntp_resync,omitempty"` // NTP校时的摄像头重新设置NTP触发同步
+}
+
+// 测量摄像头时钟偏差，GetSystemDateAndTime不需要鉴权，时钟偏差过大导致鉴权失败时也能测量
+func measureClockDrift() (*ClockDrift, error) {
+	offset, roundTrip, cameraTime, dateTimeType, err := goonvif.MeasureTimeOffset(config.CameraAddr())
+	if err != nil {
+		return nil, errors.Wrap(err, "GetSystemDateAndTime err")
+	}
+	return &ClockDrift{
+		OffsetMs:     int64(offset / time.Millisecond),
+		RoundTripMs:  int64(roundTrip / time.Millisecond),
+		CameraTime:   cameraTime.Format(time.RFC3339),
+		DateTimeType: dateTimeType,
+		MeasuredAt:   time.Now().Unix(),
+	}, nil
+}
+
+// 检测时钟偏差并上报，超过阈值时自动校时
+func DeviceCheckClockDrift() error {
+	drift, err := measureClockDrift()
+	if err != nil {
+		return err
+	}
+
+	threshold := config.C.ClockDrift.Threshold
+	if threshold <= 0 {
+		threshold = defaultDriftThreshold
+	}
+	offset := time.Duration(drift.OffsetMs) * time.Millisecond
+	if offset > threshold || offset < -threshold {
+		if strings.EqualFold(drift.DateTimeType, "NTP") {
+			// 使用NTP校时的摄像头不改为手动校时，重新设置NTP触发同步
+			NewEntry(Fields{"did": did, "offset_ms": drift.OffsetMs}).DownLink("clock drift exceeds %v, resync ntp", threshold)
+			if err := DeviceSetDateTimeType("NTP"); err != nil {
+				logrus.WithError(err).Error("ntp resync error")
+			} else {
+				drift.NTPResync = true
+			}
+		} else {
+			NewEntry(Fields{"did": did, "offset_ms": drift.OffsetMs}).DownLink("clock drift exceeds %v, time calibration", threshold)
+			if err := DeviceSetSystemDateAndTime(); err != nil {
+				logrus.WithError(err).Error("time calibration error")
+			} else {
+				drift.Calibrated = true
+			}
+		}
+	}
+
+	if err := Mark(MarkFields{
+		"did":           did,
+		"offset_ms":     drift.OffsetMs,
+		"round_trip_ms": drift.RoundTripMs,
+		"calibrated":    drift.Calibrated,
+		"ntp_resync":    drift.NTPResync,
+	}, ClockDriftIndex); err != nil {
+		logrus.Error(err)
+	}
+	go handleResponse(drift, handleClockDrift)
+	return nil
+}
+
+// 定时检测时钟偏差
+func ClockDriftCheck() {
+	interval := config.C.ClockDrift.Interval
+	if interval <= 0 {
+		interval = defaultDriftInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := DeviceCheckClockDrift(); err != nil {
+			logrus.WithError(err).Error("check clock drift error")
+		}
+		<-t.C
+	}
+}
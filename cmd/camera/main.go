@@ -68,4 +68,14 @@ func initConfig() {
 	if err := viper.Unmarshal(&config.C); err != nil {
 		log.WithError(err).Fatal("unmarshal config error")
 	}
+	config.Save = saveConfig
+}
+
+// 运行时修改的配置（如摄像头密码）写回配置文件
+func saveConfig(key string, value interface{}) error {
+	viper.Set(key, value)
+	if cfgFile != "" {
+		return viper.WriteConfigAs(cfgFile)
+	}
+	return viper.WriteConfig()
 }
@@ -5,6 +5,7 @@ import (
 	"camera/config"
 	"camera/echo"
 	"camera/goonvif"
+	"camera/storage"
 	"github.com/lestrrat/go-file-rotatelogs"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -20,8 +21,15 @@ import (
 func run(cmd *cobra.Command, args []string) error {
 	tasks := []func() error{
 		setLogLevel,
+		setCameraTLS,
 		setMQTT,
+		setInventory,
 		setIntervalCheck,
+		setClockDriftCheck,
+		setStorageCheck,
+		setRedis,
+		setSystemBackup,
+		setConfigReconcile,
 	}
 
 	for _, t := range tasks {
@@ -137,6 +145,15 @@ func setMQTT() error {
 		Password:     config.C.Camera.MQTTPassword,
 		QOS:          2,
 		CleanSession: true,
+		CACert:       config.C.Camera.MQTTCACert,
+		TLSCert:      config.C.Camera.MQTTTLSCert,
+		TLSKey:       config.C.Camera.MQTTTLSKey,
+
+		InsecureSkipVerify: config.C.Camera.MQTTInsecureSkipVerify,
+
+		QueuePath: config.C.Camera.MQTTQueuePath,
+		QueueSize: config.C.Camera.MQTTQueueSize,
+		QueueTTL:  config.C.Camera.MQTTQueueTTL,
 	}
 	if err := camera.NewBackend(cfg); err != nil {
 		return err
@@ -144,20 +161,38 @@ func setMQTT() error {
 	return nil
 }
 
+// 摄像头https的证书校验
+func setCameraTLS() error {
+	return camera.SetCameraTLS()
+}
+
+// 连接摄像头后上报资产信息
+func setInventory() error {
+	go camera.ReportInventory()
+	return nil
+}
+
 func setIntervalCheck() error {
 	go func() {
+		online := true
 		for {
 			t := time.NewTicker(time.Second * 60)
 			select {
 			case <-t.C:
 				// check
-				dev, _ := goonvif.NewDevice(config.C.General.Addr)
+				dev, _ := goonvif.ProbeDevice(config.Camera())
 				if dev == nil {
 					go camera.HandleIntervalCheck("offline(离线)", camera.HandleInterval)
 					//fmt.Println("offline")
+					online = false
 				} else {
 					go camera.HandleIntervalCheck("online(在线)", camera.HandleInterval)
 					//fmt.Println("online")
+					// 摄像头重新上线后资产信息可能已变化（更换设备、升级固件）
+					if !online {
+						go camera.ReportInventory()
+					}
+					online = true
 				}
 			}
 		}
@@ -165,3 +200,43 @@ func setIntervalCheck() error {
 	}()
 	return nil
 }
+
+// 定时检测摄像头时钟偏差
+func setClockDriftCheck() error {
+	go camera.ClockDriftCheck()
+	return nil
+}
+
+// 定时检测SD卡状态
+func setStorageCheck() error {
+	go camera.StorageCheck()
+	return nil
+}
+
+// 连接redis
+func setRedis() error {
+	if config.C.Redis.URL == "" {
+		log.Warn("redis url is not configured")
+		return nil
+	}
+	if config.C.Redis.MaxIdle > 0 {
+		storage.RedisMaxIdle = config.C.Redis.MaxIdle
+	}
+	if config.C.Redis.MaxActive > 0 {
+		storage.RedisMaxActive = config.C.Redis.MaxActive
+	}
+	config.C.Redis.Pool = storage.NewRedisPool(config.C.Redis.URL)
+	return nil
+}
+
+// 定时备份摄像头配置
+func setSystemBackup() error {
+	go camera.SystemBackupSchedule()
+	return nil
+}
+
+// 定时检查期望配置
+func setConfigReconcile() error {
+	go camera.ConfigReconcile()
+	return nil
+}
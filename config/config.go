@@ -1,6 +1,10 @@
 package config
 
-import "github.com/garyburd/redigo/redis"
+import (
+	"github.com/garyburd/redigo/redis"
+	"sync"
+	"time"
+)
 
 type Config struct {
 	General struct {
@@ -11,6 +15,13 @@ type Config struct {
 		Addr         string `mapstructure:"addr"`
 		Username     string `mapstructure:"username"`
 		Password     string `mapstructure:"password"`
+		TimeZone     string `mapstructure:"timezone"` // POSIX时区，如CST-8
+		Tid          int32  `mapstructure:"tid"`      // 租户ID，用于影子的redis key
+		Pid          int32  `mapstructure:"pid"`      // 产品ID，用于影子的redis key
+
+		TLSCACert             string `mapstructure:"tls_ca_cert"`              // 摄像头https证书的CA
+		TLSFingerprint        string `mapstructure:"tls_fingerprint"`          // 摄像头证书的sha256指纹
+		TLSInsecureSkipVerify bool   `mapstructure:"tls_insecure_skip_verify"` // 不校验摄像头证书
 	}
 
 	Camera struct {
@@ -18,10 +29,39 @@ type Config struct {
 		MQTTServer   string `mapstructure:"mqtt_server"`
 		MQTTUsername string `mapstructure:"mqtt_username"`
 		MQTTPassword string `mapstructure:"mqtt_password"`
+
+		MQTTCACert             string `mapstructure:"mqtt_ca_cert"`
+		MQTTTLSCert            string `mapstructure:"mqtt_tls_cert"`
+		MQTTTLSKey             string `mapstructure:"mqtt_tls_key"`
+		MQTTInsecureSkipVerify bool   `mapstructure:"mqtt_insecure_skip_verify"` // 不校验broker证书
+
+		MQTTQueuePath string        `mapstructure:"mqtt_queue_path"` // 离线消息队列目录，为空时不缓存
+		MQTTQueueSize int           `mapstructure:"mqtt_queue_size"` // 最多缓存的消息数量
+		MQTTQueueTTL  time.Duration `mapstructure:"mqtt_queue_ttl"`  // 消息的有效期
 	} `mapstructure:"camera"`
 
+	ClockDrift struct {
+		Interval  time.Duration `mapstructure:"interval"`  // 检测间隔
+		Threshold time.Duration `mapstructure:"threshold"` // 超过该偏差自动校时
+	} `mapstructure:"clock_drift"`
+
+	StorageCheck struct {
+		Interval time.Duration `mapstructure:"interval"` // 检测间隔
+	} `mapstructure:"storage_check"`
+
+	SystemBackup struct {
+		Interval time.Duration `mapstructure:"interval"` // 自动备份间隔，为0时不自动备份
+		Keep     int           `mapstructure:"keep"`     // 每台摄像头保留的备份数量
+	} `mapstructure:"system_backup"`
+
+	ConfigReconcile struct {
+		Interval time.Duration `mapstructure:"interval"` // 检查期望配置的间隔
+	} `mapstructure:"config_reconcile"`
+
 	File struct {
-		URL       string `mapstructure:"url"`
+		URL         string `mapstructure:"url"`          // 上传地址
+		DownloadURL string `mapstructure:"download_url"` // 下载地址，后接fid
+		DeleteURL   string `mapstructure:"delete_url"`   // 删除地址，后接fid
 	} `mapstructure:"file_server"`
 
 	Redis struct {
@@ -34,3 +74,41 @@ type Config struct {
 
 // C holds the global configuration.
 var C Config
+
+// cameraMu guards General.Addr and General.Password, they are changed at runtime
+// (address change, password change) while other goroutines use them
+var cameraMu sync.RWMutex
+
+// Camera returns the camera address and credentials.
+func Camera() (addr, username, password string) {
+	cameraMu.RLock()
+	defer cameraMu.RUnlock()
+	return C.General.Addr, C.General.Username, C.General.Password
+}
+
+// CameraAddr returns the camera address.
+func CameraAddr() string {
+	cameraMu.RLock()
+	defer cameraMu.RUnlock()
+	return C.General.Addr
+}
+
+// SetCameraAddr changes the camera address at runtime.
+func SetCameraAddr(addr string) {
+	cameraMu.Lock()
+	C.General.Addr = addr
+	cameraMu.Unlock()
+}
+
+// SetCameraPassword changes the camera password at runtime.
+func SetCameraPassword(password string) {
+	cameraMu.Lock()
+	C.General.Password = password
+	cameraMu.Unlock()
+}
+
+// Save persists a configuration value changed at runtime (e.g. "general.password"),
+// it is replaced by the main package once the configuration file is loaded.
+var Save = func(key string, value interface{}) error {
+	return nil
+}
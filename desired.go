@@ -0,0 +1,373 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/ptz"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ConfigDriftIndex = "config_drift" // 配置偏差指标
+
+	defaultReconcileInterval = time.Minute * 5
+	imagingTolerance         = 0.5 // 图像参数的比较误差，摄像头会对设置的值取整
+)
+
+// 期望配置中的项目
+const (
+	desiredVideoEncoder = "video_encoder"
+	desiredOSDText      = "osd_text"
+	desiredNTP          = "ntp"
+	desiredImaging      = "imaging"
+	desiredHostname     = "hostname"
+)
+
+// 期望配置，保存在影子desired的CameraConfig中，只检查设置了的项目，网关定时与摄像头的实际配置比较并恢复偏差
+type DesiredConfig struct {
+	VideoEncoder *VideoEncoderSetting `json:"video_encoder,omitempty"`
+	OSDText      *OSD                 `json:"osd_text,omitempty"` // 文本OSD，没有token时匹配第一个Plain文本OSD
+	NTP          *NTPInfo             `json:"ntp,omitempty"`
+	Imaging      *ImagingConfig       `json:"imaging,omitempty"`
+	Hostname     string               `json:"hostname,omitempty"`
+}
+
+// 摄像头的实际配置，只包含期望配置中的项目，上报到影子reported的CameraConfig中
+type ReportedConfig struct {
+	VideoEncoder *VideoEncoder  `json:"video_encoder,omitempty"`
+	OSDText      *OSD           `json:"osd_text,omitempty"`
+	NTP          *NTPInfo       `json:"ntp,omitempty"`
+	Imaging      *ImagingConfig `json:"imaging,omitempty"`
+	Hostname     string         `json:"hostname,omitempty"`
+}
+
+// 一项配置偏差
+type ConfigDrift struct {
+	Item     string      `json:"item"`
+	Field    string      `json:"field"`
+	Desired  interface{} `json:"desired"`
+	Reported interface{} `json:"reported"`
+}
+
+// 配置检查结果，applied为重新下发的项目，errors为读取或下发失败的项目
+type ConfigState struct {
+	Desired   *DesiredConfig    `json:"desired"`
+	Reported  ReportedConfig    `json:"reported"`
+	Diff      []ConfigDrift     `json:"diff"`
+	Applied   []string          `json:"applied"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	CheckedAt int64             `json:"checked_at"`
+}
+
+// 检查期望配置互斥
+var reconcileMu sync.Mutex
+
+// 影子中的期望配置变化，value为{"ntp":{"from_dhcp":false,"servers":["pool.ntp.org"]},"hostname":"cam01"}，
+// 期望配置已记录在本地影子中，校验后立即检查
+func DeviceSetCameraConfig(value interface{}) error {
+	if _, err := parseDesiredConfig(value); err != nil {
+		return err
+	}
+	return DeviceReconcileConfig()
+}
+
+func parseDesiredConfig(value interface{}) (*DesiredConfig, error) {
+	desired := &DesiredConfig{}
+	if err := decodeDesired(value, desired); err != nil {
+		return nil, errors.Wrap(err, "decode desired config err")
+	}
+	if desired.NTP != nil && !desired.NTP.FromDHCP && len(desired.NTP.Servers) == 0 {
+		return nil, errors.New("ntp servers are required")
+	}
+	return desired, nil
+}
+
+// 比较期望配置和实际配置，恢复偏差后上报两者和偏差
+func DeviceReconcileConfig() error {
+	reconcileMu.Lock()
+	defer reconcileMu.Unlock()
+	value, ok := shadowDesired(CameraConfig)
+	if !ok {
+		return nil
+	}
+	desired, err := parseDesiredConfig(value)
+	if err != nil {
+		return err
+	}
+	state := &ConfigState{Desired: desired, Diff: []ConfigDrift{}, Applied: []string{}, Errors: map[string]string{}}
+	camera := newCamera()
+
+	if desired.VideoEncoder != nil {
+		state.check(desiredVideoEncoder, func() (bool, error) {
+			return reconcileVideoEncoder(camera, desired.VideoEncoder, state)
+		}, func() error {
+			camera, err := media2Camera()
+			if err != nil {
+				return err
+			}
+			return setVideoEncoder(camera, *desired.VideoEncoder)
+		})
+	}
+	if desired.OSDText != nil {
+		osd := *desired.OSDText
+		state.check(desiredOSDText, func() (bool, error) {
+			return reconcileOSDText(camera, &osd, state)
+		}, func() error {
+			return DeviceSetOSD(osd)
+		})
+	}
+	if desired.NTP != nil {
+		state.check(desiredNTP, func() (bool, error) {
+			return reconcileNTP(camera, desired.NTP, state)
+		}, func() error {
+			return DeviceSetNTP(*desired.NTP)
+		})
+	}
+	if desired.Imaging != nil {
+		state.check(desiredImaging, func() (bool, error) {
+			return reconcileImaging(camera, desired.Imaging, state)
+		}, func() error {
+			return setImagingSettings(camera, *desired.Imaging)
+		})
+	}
+	if desired.Hostname != "" {
+		state.check(desiredHostname, func() (bool, error) {
+			hostname, err := getHostname(camera)
+			if err != nil {
+				return false, err
+			}
+			state.Reported.Hostname = hostname.Name
+			return state.compare(desiredHostname, "name", desired.Hostname, hostname.Name, desired.Hostname != hostname.Name), nil
+		}, func() error {
+			return DeviceSetHostname(desired.Hostname, "")
+		})
+	}
+	state.CheckedAt = time.Now().Unix()
+
+	if len(state.Diff) > 0 {
+		NewEntry(Fields{"did": did, "diff": state.Diff, "applied": state.Applied}).DownLink("config drift detected")
+	}
+	if err := Mark(MarkFields{
+		"did":     did,
+		"drift":   len(state.Diff),
+		"applied": len(state.Applied),
+		"errors":  len(state.Errors),
+	}, ConfigDriftIndex); err != nil {
+		logrus.Error(err)
+	}
+	go handleResponse(state, handleConfigState)
+	return nil
+}
+
+// 读取实际配置，有偏差时重新下发
+func (s *ConfigState) check(item string, compare func() (bool, error), apply func() error) {
+	drift, err := compare()
+	if err != nil {
+		s.Errors[item] = err.Error()
+		return
+	}
+	if !drift {
+		return
+	}
+	if err = apply(); err != nil {
+		s.Errors[item] = err.Error()
+		return
+	}
+	s.Applied = append(s.Applied, item)
+}
+
+// 记录偏差，返回是否有偏差
+func (s *ConfigState) compare(item, field string, desired, reported interface{}, drift bool) bool {
+	if drift {
+		s.Diff = append(s.Diff, ConfigDrift{Item: item, Field: field, Desired: desired, Reported: reported})
+	}
+	return drift
+}
+
+// 比较编码配置中设置了的值，没有token时比较第一个编码配置
+func reconcileVideoEncoder(camera *ptz.Camera, desired *VideoEncoderSetting, s *ConfigState) (bool, error) {
+	encoders, err := getVideoEncoders(camera)
+	if err != nil {
+		return false, err
+	}
+	var actual *VideoEncoder
+	for i := range encoders {
+		if desired.Token == "" || encoders[i].Token == desired.Token {
+			actual = &encoders[i]
+			break
+		}
+	}
+	if actual == nil {
+		return false, errors.Errorf("video encoder %s not found", desired.Token)
+	}
+	s.Reported.VideoEncoder = actual
+
+	item := desiredVideoEncoder
+	drift := false
+	if desired.Encoding != "" {
+		drift = s.compare(item, "encoding", desired.Encoding, actual.Encoding, !strings.EqualFold(desired.Encoding, actual.Encoding)) || drift
+	}
+	if desired.Width > 0 && desired.Height > 0 {
+		drift = s.compare(item, "resolution", Resolution{desired.Width, desired.Height}, Resolution{actual.Width, actual.Height},
+			desired.Width != actual.Width || desired.Height != actual.Height) || drift
+	}
+	if desired.Quality > 0 {
+		drift = s.compare(item, "quality", desired.Quality, actual.Quality, desired.Quality != actual.Quality) || drift
+	}
+	if desired.FrameRate > 0 {
+		drift = s.compare(item, "frame_rate", desired.FrameRate, actual.FrameRate, desired.FrameRate != actual.FrameRate) || drift
+	}
+	if desired.Bitrate > 0 {
+		drift = s.compare(item, "bitrate", desired.Bitrate, actual.Bitrate, desired.Bitrate != actual.Bitrate) || drift
+	}
+	if desired.GovLength > 0 {
+		drift = s.compare(item, "gov_length", desired.GovLength, actual.GovLength, desired.GovLength != actual.GovLength) || drift
+	}
+	if desired.Profile != "" {
+		drift = s.compare(item, "profile", desired.Profile, actual.Profile, !strings.EqualFold(desired.Profile, actual.Profile)) || drift
+	}
+	if desired.ConstantBitRate != nil {
+		drift = s.compare(item, "constant_bitrate", *desired.ConstantBitRate, actual.ConstantBitRate, *desired.ConstantBitRate != actual.ConstantBitRate) || drift
+	}
+	return drift, nil
+}
+
+// 比较文本OSD，没有token时匹配第一个Plain文本OSD，找到后使用其token修改，找不到时创建
+func reconcileOSDText(camera *ptz.Camera, desired *OSD, s *ConfigState) (bool, error) {
+	if !camera.SupportsMedia2() {
+		return false, errors.New("camera does not support Media2")
+	}
+	configurationToken, err := videoSourceConfigurationToken(camera, desired.ConfigurationToken)
+	if err != nil {
+		return false, err
+	}
+	osds, err := getOSDs(camera, configurationToken)
+	if err != nil {
+		return false, err
+	}
+	var actual *OSD
+	for i := range osds {
+		if desired.Token != "" && osds[i].Token == desired.Token ||
+			desired.Token == "" && osds[i].Type == "Text" && (osds[i].TextType == "" || osds[i].TextType == "Plain") {
+			actual = &osds[i]
+			break
+		}
+	}
+	if actual == nil {
+		if desired.Token != "" {
+			return false, errors.Errorf("osd %s not found", desired.Token)
+		}
+		return s.compare(desiredOSDText, "plain_text", desired.PlainText, nil, true), nil
+	}
+	s.Reported.OSDText = actual
+	desired.Token = actual.Token
+
+	item := desiredOSDText
+	drift := s.compare(item, "plain_text", desired.PlainText, actual.PlainText, desired.PlainText != actual.PlainText)
+	if desired.Position != "" {
+		drift = s.compare(item, "position", desired.Position, actual.Position, desired.Position != actual.Position) || drift
+	}
+	if desired.FontSize > 0 {
+		drift = s.compare(item, "font_size", desired.FontSize, actual.FontSize, desired.FontSize != actual.FontSize) || drift
+	}
+	return drift, nil
+}
+
+// 比较NTP，手动配置时比较服务器集合，不考虑顺序
+func reconcileNTP(camera *ptz.Camera, desired *NTPInfo, s *ConfigState) (bool, error) {
+	actual, err := getNTPInfo(camera)
+	if err != nil {
+		return false, err
+	}
+	s.Reported.NTP = actual
+
+	drift := s.compare(desiredNTP, "from_dhcp", desired.FromDHCP, actual.FromDHCP, desired.FromDHCP != actual.FromDHCP)
+	if !desired.FromDHCP {
+		drift = s.compare(desiredNTP, "servers", desired.Servers, actual.Servers, !sameServers(desired.Servers, actual.Servers)) || drift
+	}
+	return drift, nil
+}
+
+func sameServers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	x := make([]string, len(a))
+	y := make([]string, len(b))
+	for i := range a {
+		x[i] = strings.ToLower(strings.TrimSpace(a[i]))
+		y[i] = strings.ToLower(strings.TrimSpace(b[i]))
+	}
+	sort.Strings(x)
+	sort.Strings(y)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 比较图像参数中设置了的值
+func reconcileImaging(camera *ptz.Camera, desired *ImagingConfig, s *ConfigState) (bool, error) {
+	actual, err := getImagingSettings(camera, desired.VideoSourceToken)
+	if err != nil {
+		return false, err
+	}
+	s.Reported.Imaging = actual
+
+	item := desiredImaging
+	drift := false
+	values := []struct {
+		field            string
+		desired, current *float64
+	}{
+		{"brightness", desired.Brightness, actual.Brightness},
+		{"color_saturation", desired.ColorSaturation, actual.ColorSaturation},
+		{"contrast", desired.Contrast, actual.Contrast},
+		{"sharpness", desired.Sharpness, actual.Sharpness},
+	}
+	// 摄像头没有返回的参数无法比较，不重复下发
+	var missing []string
+	for _, v := range values {
+		if v.desired == nil {
+			continue
+		}
+		if v.current == nil {
+			missing = append(missing, v.field)
+			continue
+		}
+		drift = s.compare(item, v.field, *v.desired, *v.current, math.Abs(*v.desired-*v.current) > imagingTolerance) || drift
+	}
+	if desired.IrCutFilter != "" {
+		if actual.IrCutFilter == "" {
+			missing = append(missing, "ir_cut_filter")
+		} else {
+			drift = s.compare(item, "ir_cut_filter", desired.IrCutFilter, actual.IrCutFilter, !strings.EqualFold(desired.IrCutFilter, actual.IrCutFilter)) || drift
+		}
+	}
+	if len(missing) > 0 {
+		s.Errors[item] = "camera does not report " + strings.Join(missing, ",")
+	}
+	return drift, nil
+}
+
+// 定时检查期望配置
+func ConfigReconcile() {
+	interval := config.C.ConfigReconcile.Interval
+	if interval <= 0 {
+		interval = defaultReconcileInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		if err := DeviceReconcileConfig(); err != nil {
+			logrus.WithError(err).Error("reconcile config error")
+		}
+	}
+}
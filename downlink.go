@@ -3,9 +3,10 @@ package camera
 import (
 	"bytes"
 	"camera/config"
+	"camera/goonvif"
 	"camera/goonvif/Device"
-	"camera/goonvif/Media"
 	"camera/goonvif/PTZ"
+	"camera/goonvif/networking"
 	"camera/goonvif/xsd"
 	"camera/goonvif/xsd/onvif"
 	"camera/ptz"
@@ -20,6 +21,7 @@ import (
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -74,11 +76,65 @@ func collectCameraPacket(p DevicePayload) {
 	}
 
 	entry.DownLink("receive down data from mqtt this shuncom gateway %s", string(p.Payload))
+	switch responseTwins.Method {
+	case Reply:
+		handleTwinsReply(entry, responseTwins)
+		return
+	case Get:
+		// 云端获取网关的影子，回应当前的上报状态
+		if err := resyncTwins(responseTwins.Version); err != nil {
+			entry.Error("reply shadow get %v", err)
+		}
+		return
+	case Delete:
+		keys := make([]string, 0, len(responseTwins.Payload.State.Reported))
+		for k := range responseTwins.Payload.State.Reported {
+			keys = append(keys, k)
+		}
+		deleteReported(keys, responseTwins.Version)
+		return
+	}
 	if err := handlerCameraDownLink(responseTwins); err != nil {
 		entry.Error("send data to shuncom gateway %v", err)
 	}
 }
 
+// 处理云端对上报和get的回应，失败时payload.content为错误码，get的回应带有云端影子
+func handleTwinsReply(entry *Entry, resp *ResponseTwins) {
+	if code := resp.Payload.Content.ErrorCode; code != "" || strings.EqualFold(resp.Payload.Status, "error") {
+		message := resp.Payload.Content.ErrorMessage
+		if message == "" {
+			message = ErrorCode[code]
+		}
+		entry.Error("shadow reply error %s %s", code, message)
+		if code == versionConflict {
+			if err := resyncTwins(resp.Version); err != nil {
+				entry.Error("resync shadow %v", err)
+			}
+		}
+		return
+	}
+	if resp.Version == 0 {
+		return
+	}
+	// get的回应，云端的上报状态落后时重新上报
+	if syncTwinsVersion(resp.Version) && resp.Payload.State.Reported != nil {
+		if err := resyncTwins(resp.Version); err != nil {
+			entry.Error("resync shadow %v", err)
+		}
+	}
+	if len(resp.Payload.State.Desired) > 0 {
+		if err := handlerCameraDownLink(resp); err != nil {
+			entry.Error("send data to shuncom gateway %v", err)
+		}
+	}
+}
+
+// 声明式的期望状态，一直保留在影子中，没有command_id时也执行
+var declarativeKeys = map[string]bool{
+	CameraConfig: true,
+}
+
 // 记录设备ID
 var did string
 
@@ -92,8 +148,19 @@ var usablePresetsArray = make([]string, 1)
 func handlerCameraDownLink(resp *ResponseTwins) error {
 	entry := logrus.WithFields(logrus.Fields{"Did": did})
 	var send error
-	if resp.CommandID != "" {
+	if len(resp.Payload.State.Desired) > 0 {
+		recordDesired(resp.Payload.State.Desired)
+		applied := make([]string, 0, len(resp.Payload.State.Desired))
 		for desK, desV := range resp.Payload.State.Desired {
+			// 值为null的是已经删除的期望状态
+			if desV == nil {
+				continue
+			}
+			// 没有command_id的期望状态来自get的回应，一次性命令只在下发时执行，避免重复重启、删除用户等
+			if resp.CommandID == "" && !declarativeKeys[desK] {
+				entry.Debugf("忽略没有command_id的命令 %v", desK)
+				continue
+			}
 			entry.Debugf("接收到下发命令 %v:%v", desK, desV)
 			switch desK {
 			case PTZControl, Angle, Zoom:
@@ -123,9 +190,224 @@ func handlerCameraDownLink(resp *ResponseTwins) error {
 			case TimeCalibration:
 				send = DeviceSetSystemDateAndTime()
 				entry.Debug("时间校准", send)
+			case GetSupportedAnalyticsRules:
+				send = AnalyticsGetSupportedRules(desV)
+				entry.Debug("获取支持的分析规则类型", send)
+			case GetAnalyticsRules:
+				send = AnalyticsGetRules(desV)
+				entry.Debug("获取分析规则", send)
+			case CreateAnalyticsRule:
+				send = AnalyticsCreateRule(desV)
+				entry.Debug("创建分析规则", send)
+			case ModifyAnalyticsRule:
+				send = AnalyticsModifyRule(desV)
+				entry.Debug("修改分析规则", send)
+			case DeleteAnalyticsRule:
+				send = AnalyticsDeleteRule(desV)
+				entry.Debug("删除分析规则", send)
+			case GetSupportedAnalyticsModules:
+				send = AnalyticsGetSupportedModules(desV)
+				entry.Debug("获取支持的分析模块", send)
+			case GetAnalyticsModules:
+				send = AnalyticsGetModules(desV)
+				entry.Debug("获取分析模块", send)
+			case GetAnalyticsModuleOptions:
+				send = AnalyticsGetModuleOptions(desV)
+				entry.Debug("获取分析模块参数约束", send)
+			case CreateAnalyticsModule:
+				send = AnalyticsCreateModule(desV)
+				entry.Debug("创建分析模块", send)
+			case ModifyAnalyticsModule:
+				send = AnalyticsModifyModule(desV)
+				entry.Debug("修改分析模块", send)
+			case DeleteAnalyticsModule:
+				send = AnalyticsDeleteModule(desV)
+				entry.Debug("删除分析模块", send)
+			case GetRelayOutputs:
+				send = DeviceGetRelayOutputs()
+				entry.Debug("获取继电器列表", send)
+			case SetRelayOutputSettings:
+				send = DeviceSetRelayOutputSettings(desV)
+				entry.Debug("设置继电器模式", send)
+			case SetRelayOutputState:
+				send = DeviceSetRelayOutputState(desV)
+				entry.Debug("触发继电器", send)
+			case SystemReboot:
+				send = DeviceSystemReboot(desV, resp.CommandID)
+				entry.Debug("远程重启", send)
+			case SetSystemFactoryDefault:
+				send = DeviceSetSystemFactoryDefault(desV, resp.CommandID)
+				entry.Debug("恢复出厂设置", send)
+			case UpgradeFirmware:
+				send = DeviceUpgradeFirmware(desV)
+				entry.Debug("固件升级", send)
+			case GetInventory:
+				send = DeviceGetInventory()
+				entry.Debug("获取资产信息", send)
+			case GetUsers:
+				send = DeviceGetUsers()
+				entry.Debug("获取用户列表", send)
+			case CreateUser:
+				send = DeviceCreateUser(desV, resp.CommandID)
+				entry.Debug("创建用户", send)
+			case DeleteUser:
+				send = DeviceDeleteUser(desV, resp.CommandID)
+				entry.Debug("删除用户", send)
+			case SetUser:
+				send = DeviceSetUser(desV, resp.CommandID)
+				entry.Debug("修改用户", send)
+			case GetNTP:
+				send = DeviceGetNTP()
+				entry.Debug("获取NTP服务器", send)
+			case SetNTP:
+				send = DeviceSetNTP(desV)
+				entry.Debug("设置NTP服务器", send)
+			case SetDateTimeType:
+				send = DeviceSetDateTimeType(desV)
+				entry.Debug("设置校时方式", send)
+			case CheckClockDrift:
+				send = DeviceCheckClockDrift()
+				entry.Debug("检测时钟偏差", send)
+			case GetStreamUri:
+				send = DeviceGetStreamUri(desV)
+				entry.Debug("获取视频流地址", send)
+			case GetVideoEncoders:
+				send = DeviceGetVideoEncoders()
+				entry.Debug("获取视频编码配置", send)
+			case SetVideoEncoder:
+				send = DeviceSetVideoEncoder(desV)
+				entry.Debug("修改视频编码配置", send)
+			case GetVideoEncoderOptions:
+				send = DeviceGetVideoEncoderOptions(desV)
+				entry.Debug("获取视频编码参数约束", send)
+			case GetOSDs:
+				send = DeviceGetOSDs(desV)
+				entry.Debug("获取OSD", send)
+			case SetOSD:
+				send = DeviceSetOSD(desV)
+				entry.Debug("设置OSD", send)
+			case DeleteOSD:
+				send = DeviceDeleteOSD(desV)
+				entry.Debug("删除OSD", send)
+			case GetPrivacyMasks:
+				send = DeviceGetPrivacyMasks(desV)
+				entry.Debug("获取隐私遮挡", send)
+			case SetPrivacyMask:
+				send = DeviceSetPrivacyMask(desV)
+				entry.Debug("设置隐私遮挡", send)
+			case GetImagingSettings:
+				send = DeviceGetImagingSettings(desV)
+				entry.Debug("获取图像参数", send)
+			case SetImagingSettings:
+				send = DeviceSetImagingSettings(desV)
+				entry.Debug("设置图像参数", send)
+			case DeletePrivacyMask:
+				send = DeviceDeletePrivacyMask(desV)
+				entry.Debug("删除隐私遮挡", send)
+			case GetRecordings:
+				send = DeviceGetRecordings()
+				entry.Debug("获取录像列表", send)
+			case SearchRecordings:
+				send = DeviceSearchRecordings(desV)
+				entry.Debug("搜索录像", send)
+			case GetReplayUri:
+				send = DeviceGetReplayUri(desV)
+				entry.Debug("获取回放地址", send)
+			case GetStorage:
+				send = DeviceGetStorage()
+				entry.Debug("获取存储状态", send)
+			case SetStorageConfiguration:
+				send = DeviceSetStorageConfiguration(desV)
+				entry.Debug("设置存储配置", send)
+			case DeleteStorageConfiguration:
+				send = DeviceDeleteStorageConfiguration(desV)
+				entry.Debug("删除存储配置", send)
+			case GetNetwork:
+				send = DeviceGetNetwork()
+				entry.Debug("获取网络配置", send)
+			case SetNetworkInterface:
+				send = DeviceSetNetworkInterface(desV, resp.CommandID)
+				entry.Debug("设置网卡地址", send)
+			case SetDNS:
+				send = DeviceSetDNS(desV)
+				entry.Debug("设置DNS", send)
+			case SetHostname:
+				send = DeviceSetHostname(desV, resp.CommandID)
+				entry.Debug("设置主机名", send)
+			case SetNetworkProtocols:
+				send = DeviceSetNetworkProtocols(desV, resp.CommandID)
+				entry.Debug("设置网络端口", send)
+			case GetIPAddressFilter:
+				send = DeviceGetIPAddressFilter()
+				entry.Debug("获取IP地址过滤", send)
+			case SetIPAddressFilter:
+				send = DeviceSetIPAddressFilter(desV, resp.CommandID)
+				entry.Debug("设置IP地址过滤", send)
+			case AddIPAddressFilter:
+				send = DeviceAddIPAddressFilter(desV, resp.CommandID)
+				entry.Debug("添加IP地址过滤", send)
+			case RemoveIPAddressFilter:
+				send = DeviceRemoveIPAddressFilter(desV, resp.CommandID)
+				entry.Debug("删除IP地址过滤", send)
+			case LockDownToGateway:
+				send = DeviceLockDownToGateway(resp.CommandID)
+				entry.Debug("只允许网关访问", send)
+			case GetCertificates:
+				send = DeviceGetCertificates()
+				entry.Debug("获取证书", send)
+			case CreateCertificateRequest:
+				send = DeviceCreateCertificateRequest(desV)
+				entry.Debug("生成证书签名请求", send)
+			case LoadCertificate:
+				send = DeviceLoadCertificate(desV, resp.CommandID)
+				entry.Debug("上传证书", send)
+			case LoadCACertificate:
+				send = DeviceLoadCACertificate(desV, resp.CommandID)
+				entry.Debug("上传CA证书", send)
+			case SetClientCertificateMode:
+				send = DeviceSetClientCertificateMode(desV)
+				entry.Debug("设置客户端证书模式", send)
+			case EnableHTTPS:
+				send = DeviceEnableHTTPS(desV, resp.CommandID)
+				entry.Debug("启用https", send)
+			case GetSystemLog:
+				send = DeviceGetSystemLog(desV)
+				entry.Debug("获取系统日志", send)
+			case GetSystemSupportInformation:
+				send = DeviceGetSystemSupportInformation()
+				entry.Debug("获取技术支持信息", send)
+			case BackupSystem:
+				send = DeviceBackupSystem()
+				entry.Debug("备份摄像头配置", send)
+			case GetSystemBackups:
+				send = DeviceGetSystemBackups()
+				entry.Debug("获取备份记录", send)
+			case RestoreSystemBackup:
+				send = DeviceRestoreSystemBackup(desV, resp.CommandID)
+				entry.Debug("恢复备份", send)
+			case CameraConfig:
+				// 期望配置一直保留在影子中，不删除
+				send = DeviceSetCameraConfig(desV)
+				entry.Debug("期望配置", send)
+			case ReconcileConfig:
+				send = DeviceReconcileConfig()
+				entry.Debug("检查期望配置", send)
 			default:
 				entry.Debug("命令不存在")
+				continue
 			}
+			// 执行失败的命令保留在期望状态中，并上报失败原因
+			if send != nil {
+				go handleResponse(AckPacket{CommandID: resp.CommandID, Command: desK, Status: FAILED, Result: send.Error()}, handleCommandResult)
+				continue
+			}
+			if !declarativeKeys[desK] {
+				applied = append(applied, desK)
+			}
+		}
+		// 执行成功后删除期望状态，避免重复执行
+		if err := clearDesired(applied); err != nil {
+			return errors.Wrap(err, "clear desired err")
 		}
 	}
 	return nil
@@ -184,6 +466,15 @@ func getPointer(id interface{}) (int8, int8, int8) {
 
 }
 
+// 将下发的json值解析为结构体
+func decodeDesired(value interface{}, v interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
 // 移动速度
 func getAngle(speed interface{}) float64 {
 	//1: 22.5° 2: 45° 3: 90° 4: 180°
@@ -197,7 +488,7 @@ func getAngle(speed interface{}) float64 {
 // 云台控制
 func PTZControlMove(UpOrDown, LeftOrRight, Zoom int8, Angle float64) error {
 
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
+	camera := newCamera()
 	start := time.Now()
 	profiles, err := camera.GetProfiles()
 	if err != nil {
@@ -223,34 +514,24 @@ func PTZControlMove(UpOrDown, LeftOrRight, Zoom int8, Angle float64) error {
 
 // 快照Uri
 func SnapshotUri() error {
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
-	profiles, err := camera.GetProfiles()
+	camera := newCamera()
+	uri, err := getSnapshotUri(camera)
 	if err != nil {
 		return errors.Wrap(err, "SnapshotUri err")
 	}
+	logrus.Println("SnapshotUri:", uri)
 
-	resp, err := camera.Media_GetSnapshotUri(profiles.Profiles.Token)
-	res := Media.GetSnapshotUriResponse{}
-	err = ptz.ParseResponse(resp, &res)
-	if err != nil {
-		return errors.Wrap(err, "SnapshotUri err")
-	}
-
-	b, _ := json.Marshal(res)
-	uri := res.MediaUri.Uri
-	logrus.Println("SnapshotUriResponse:", string(b))
-
-	getSnapshot(string(uri))
+	getSnapshot(uri)
 	return nil
 }
 
 // 获取快照
 func getSnapshot(uri string) {
-	client := &http.Client{
-		Timeout: time.Second * 10,
-	}
+	client := networking.NewClient(uri)
+	client.Timeout = time.Second * 10
 	request, err := http.NewRequest("GET", uri, nil)
-	request.SetBasicAuth(config.C.General.Username, config.C.General.Password)
+	_, username, password := config.Camera()
+	request.SetBasicAuth(username, password)
 	response, err := client.Do(request)
 	logrus.Println("response: ", response)
 	if err != nil {
@@ -292,7 +573,11 @@ func sendSnapshot(fileName string) string {
 	contentType := bodyWriter.FormDataContentType()
 	bodyWriter.Close()
 
-	response, _ := http.Post(config.C.File.URL, contentType, bodyBuffer)
+	response, err := http.Post(config.C.File.URL, contentType, bodyBuffer)
+	if err != nil {
+		logrus.WithError(err).Error("upload file error")
+		return ""
+	}
 	defer response.Body.Close()
 	result, err := ioutil.ReadAll(response.Body)
 	if err != nil {
@@ -301,7 +586,7 @@ func sendSnapshot(fileName string) string {
 	fmt.Println(string(result))
 	data := FileResponse{}
 	err = json.Unmarshal(result, &data)
-	if err != nil {
+	if err == nil {
 		return data.Result.Fid
 	}
 	return ""
@@ -309,7 +594,7 @@ func sendSnapshot(fileName string) string {
 
 // 设置预置位置
 func PTZSetPreset(presetToken float64) error {
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
+	camera := newCamera()
 	profiles, err := camera.GetProfiles()
 	if err != nil {
 		logrus.Println(err)
@@ -334,7 +619,7 @@ func PTZSetPreset(presetToken float64) error {
 
 // 获取预置位置
 func PTZGetPresets() error {
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
+	camera := newCamera()
 	profiles, err := camera.GetProfiles()
 	if err != nil {
 		return errors.Wrap(err, "PTZGetPresets err")
@@ -358,7 +643,7 @@ func PTZGetPresets() error {
 
 // 移除预置位置
 func PTZRemovePresets(presetToken float64) error {
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
+	camera := newCamera()
 	profiles, err := camera.GetProfiles()
 	if err != nil {
 		logrus.Println(err)
@@ -381,7 +666,7 @@ func PTZRemovePresets(presetToken float64) error {
 
 // 回到预置位置
 func PTZGotoPreset(presetToken float64) error {
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
+	camera := newCamera()
 	profiles, err := camera.GetProfiles()
 	if err != nil {
 		return errors.Wrap(err, "GetProfiles err")
@@ -400,7 +685,7 @@ func PTZGotoPreset(presetToken float64) error {
 
 // 设置Home位置
 func PTZSetHomePosition() error {
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
+	camera := newCamera()
 	profiles, err := camera.GetProfiles()
 	if err != nil {
 		return errors.Wrap(err, "PTZSetHomePosition err")
@@ -421,7 +706,7 @@ func PTZSetHomePosition() error {
 
 // 转到Home位置
 func PTZGotoHomePosition() error {
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
+	camera := newCamera()
 	profiles, err := camera.GetProfiles()
 	if err != nil {
 		return errors.Wrap(err, "PTZGotoHomePosition err")
@@ -442,12 +727,15 @@ func PTZGotoHomePosition() error {
 
 // 时间校准
 func DeviceSetSystemDateAndTime() error {
-	camera := &ptz.Camera{Addr: config.C.General.Addr, Username: config.C.General.Username, Password: config.C.General.Password}
+	camera := newCamera()
 	//设置时区： CST-8 东八区
-	timeZone := onvif.TimeZone{TZ: xsd.Token("CST-0")}
-	//设置时间
+	timeZone := onvif.TimeZone{TZ: xsd.Token(cameraTimeZone())}
+	//设置时间，UTCDateTime需要使用UTC时间
 	now := time.Now()
-	resp, err := camera.Device_SetSystemDateAndTime("Manual", false, timeZone, now)
+	resp, err := camera.Device_SetSystemDateAndTime("Manual", false, timeZone, now.UTC())
+	if err != nil {
+		return errors.Wrap(err, "SetSystemDateAndTime err")
+	}
 	res := Device.SetSystemDateAndTimeResponse{}
 
 	err = ptz.ParseResponse(resp, &res)
@@ -457,6 +745,8 @@ func DeviceSetSystemDateAndTime() error {
 
 	b, _ := json.Marshal(res)
 	logrus.Println("SetSystemDateAndTimeResponse:", string(b))
+	// 摄像头时间已变化，重新测量WS-Security使用的时钟偏差
+	goonvif.ResetTimeOffset(config.CameraAddr())
 
 	formatTime := now.Format("2006-01-02 15:04:05")
 	go handleResponse(formatTime, handleSetSystemDateAndTime)
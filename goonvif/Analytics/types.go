@@ -5,40 +5,137 @@ import (
 	"camera/goonvif/xsd/onvif"
 )
 
+type SupportedRules struct {
+	RuleContentSchemaLocation []xsd.AnyURI
+	RuleDescription           []ConfigDescription
+}
+
+type SupportedAnalyticsModules struct {
+	AnalyticsModuleContentSchemaLocation []xsd.AnyURI
+	AnalyticsModuleDescription           []ConfigDescription
+}
+
+type ConfigDescription struct {
+	Name       xsd.QName `xml:"Name,attr"`
+	Parameters ItemListDescription
+}
+
+type ItemListDescription struct {
+	SimpleItemDescription  []ItemDescription
+	ElementItemDescription []ItemDescription
+}
+
+type ItemDescription struct {
+	Name string    `xml:"Name,attr"`
+	Type xsd.QName `xml:"Type,attr"`
+}
+
+//Config is the response side of onvif.Config,
+//fields are left untagged so that any namespace prefix is accepted
+type Config struct {
+	Name       string    `xml:"Name,attr"`
+	Type       xsd.QName `xml:"Type,attr"`
+	Parameters ItemList
+}
+
+type ItemList struct {
+	SimpleItem  []SimpleItem
+	ElementItem []ElementItem
+}
+
+type SimpleItem struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+type ElementItem struct {
+	Name    string `xml:"Name,attr"`
+	Content string `xml:",innerxml"`
+}
+
+type ConfigOptions struct {
+	Name           string    `xml:"Name,attr"`
+	Type           xsd.QName `xml:"Type,attr"`
+	MinOccurs      string    `xml:"minOccurs,attr"`
+	MaxOccurs      string    `xml:"maxOccurs,attr"`
+	IntRange       *onvif.IntRange
+	FloatRange     *FloatRange
+	StringList     *string
+	PolygonOptions *PolygonOptions
+}
+
+type FloatRange struct {
+	Min float64
+	Max float64
+}
+
+type PolygonOptions struct {
+	RectangleRange *FloatRectangleRange
+	VertexLimits   *onvif.IntRange
+}
+
+type FloatRectangleRange struct {
+	XRange FloatRange
+	YRange FloatRange
+}
+
+//Analytics main types
+
 type GetSupportedRules struct {
 	XMLName            string               `xml:"tan:GetSupportedRules"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 }
 
+type GetSupportedRulesResponse struct {
+	SupportedRules SupportedRules
+}
+
 type CreateRules struct {
 	XMLName            string               `xml:"tan:CreateRules"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 	Rule               onvif.Config         `xml:"tan:Rule"`
 }
 
+type CreateRulesResponse struct {
+}
+
 type DeleteRules struct {
 	XMLName            string               `xml:"tan:DeleteRules"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 	RuleName           xsd.String           `xml:"tan:RuleName"`
 }
 
+type DeleteRulesResponse struct {
+}
+
 type GetRules struct {
 	XMLName            string               `xml:"tan:GetRules"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 }
 
+type GetRulesResponse struct {
+	Rule []Config
+}
+
 type GetRuleOptions struct {
 	XMLName            string               `xml:"tan:GetRuleOptions"`
 	RuleType           xsd.QName            `xml:"tan:RuleType"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 }
 
+type GetRuleOptionsResponse struct {
+	RuleOptions []ConfigOptions
+}
+
 type ModifyRules struct {
 	XMLName            string               `xml:"tan:ModifyRules"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 	Rule               onvif.Config         `xml:"tan:Rule"`
 }
 
+type ModifyRulesResponse struct {
+}
+
 type GetServiceCapabilities struct {
 	XMLName string `xml:"tan:GetServiceCapabilities"`
 }
@@ -48,31 +145,52 @@ type GetSupportedAnalyticsModules struct {
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 }
 
+type GetSupportedAnalyticsModulesResponse struct {
+	SupportedAnalyticsModules SupportedAnalyticsModules
+}
+
 type GetAnalyticsModuleOptions struct {
 	XMLName            string               `xml:"tan:GetAnalyticsModuleOptions"`
 	Type               xsd.QName            `xml:"tan:Type"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 }
 
+type GetAnalyticsModuleOptionsResponse struct {
+	Options []ConfigOptions
+}
+
 type CreateAnalyticsModules struct {
-	XMLName            string               `xml:"tev:CreateAnalyticsModules"`
+	XMLName            string               `xml:"tan:CreateAnalyticsModules"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 	AnalyticsModule    onvif.Config         `xml:"tan:AnalyticsModule"`
 }
 
+type CreateAnalyticsModulesResponse struct {
+}
+
 type DeleteAnalyticsModules struct {
 	XMLName             string               `xml:"tan:DeleteAnalyticsModules"`
 	ConfigurationToken  onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 	AnalyticsModuleName xsd.String           `xml:"tan:AnalyticsModuleName"`
 }
 
+type DeleteAnalyticsModulesResponse struct {
+}
+
 type GetAnalyticsModules struct {
 	XMLName            string               `xml:"tan:GetAnalyticsModules"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 }
 
+type GetAnalyticsModulesResponse struct {
+	AnalyticsModule []Config
+}
+
 type ModifyAnalyticsModules struct {
 	XMLName            string               `xml:"tan:ModifyAnalyticsModules"`
 	ConfigurationToken onvif.ReferenceToken `xml:"tan:ConfigurationToken"`
 	AnalyticsModule    onvif.Config         `xml:"tan:AnalyticsModule"`
 }
+
+type ModifyAnalyticsModulesResponse struct {
+}
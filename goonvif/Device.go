@@ -11,9 +11,11 @@ import (
 	"github.com/beevik/etree"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var Xlmns = map[string]string{
@@ -27,11 +29,34 @@ var Xlmns = map[string]string{
 	"xmime":   "http://www.w3.org/2005/05/xmlmime",
 	"wsnt":    "http://docs.oasis-open.org/wsn/b-2",
 	"xop":     "http://www.w3.org/2004/08/xop/include",
+	"inc":     "http://www.w3.org/2004/08/xop/include",
 	"wsa":     "http://www.w3.org/2005/08/addressing",
 	"wstop":   "http://docs.oasis-open.org/wsn/t-1",
 	"wsntw":   "http://docs.oasis-open.org/wsn/bw-2",
 	"wsrf-rw": "http://docs.oasis-open.org/wsrf/rw-2",
 	"wsaw":    "http://www.w3.org/2006/05/addressing/wsdl",
+	"tr2":     "http://www.onvif.org/ver20/media/wsdl",
+	"trc":     "http://www.onvif.org/ver10/recording/wsdl",
+	"tse":     "http://www.onvif.org/ver10/search/wsdl",
+	"trp":     "http://www.onvif.org/ver10/replay/wsdl",
+	"tmd":     "http://www.onvif.org/ver10/deviceIO/wsdl",
+	"tac":     "http://www.onvif.org/ver10/accesscontrol/wsdl",
+	"tns1":    "http://www.onvif.org/ver10/topics",
+}
+
+//capabilityNamespaces maps the GetCapabilities service names (including Capabilities/Extension) to their namespaces
+var capabilityNamespaces = map[string]string{
+	"Device":          Xlmns["tds"],
+	"Media":           Xlmns["trt"],
+	"Events":          Xlmns["tev"],
+	"Imaging":         Xlmns["timg"],
+	"PTZ":             Xlmns["tptz"],
+	"Analytics":       Xlmns["tan"],
+	"Recording":       Xlmns["trc"],
+	"Search":          Xlmns["tse"],
+	"Replay":          Xlmns["trp"],
+	"DeviceIO":        Xlmns["tmd"],
+	"AnalyticsDevice": "http://www.onvif.org/ver10/analyticsdevice/wsdl",
 }
 
 type DeviceType int
@@ -75,8 +100,14 @@ type device struct {
 	login    string
 	password string
 
+	//service endpoints keyed by namespace, and by GetCapabilities service name
 	endpoints map[string]string
-	info      deviceInfo
+	//service capabilities (raw xml) keyed by namespace, only filled by GetServices
+	capabilities map[string]string
+	info         deviceInfo
+
+	//camera clock minus gateway clock, applied to WS-Security Created
+	timeOffset time.Duration
 }
 
 func (dev *device) GetServices() map[string]string {
@@ -145,27 +176,141 @@ func (dev *device) getSupportedServices(resp *http.Response) {
 		return
 	}
 	services := doc.FindElements("./Envelope/Body/GetCapabilitiesResponse/Capabilities/*/XAddr")
+	//Recording, Search, Replay, DeviceIO and AnalyticsDevice are listed under Capabilities/Extension
+	services = append(services, doc.FindElements("./Envelope/Body/GetCapabilitiesResponse/Capabilities/Extension/*/XAddr")...)
 	for _, j := range services {
 		dev.addEndpoint(j.Parent().Tag, j.Text())
+		if namespace, ok := capabilityNamespaces[j.Parent().Tag]; ok {
+			dev.addEndpoint(namespace, j.Text())
+		}
 	}
 }
 
-//NewDevice function construct a ONVIF Device entity
-func NewDevice(xaddr string) (*device, error) {
-	dev := new(device)
-	dev.xaddr = xaddr
+//getServices reads the GetServices response, it returns false when the device listed no service
+func (dev *device) getServices(resp *http.Response) bool {
+	doc := etree.NewDocument()
+
+	data, _ := ioutil.ReadAll(resp.Body)
+	if err := doc.ReadFromBytes(data); err != nil {
+		return false
+	}
+	services := doc.FindElements("./Envelope/Body/GetServicesResponse/Service")
+	for _, service := range services {
+		namespace := service.FindElement("./Namespace")
+		xaddr := service.FindElement("./XAddr")
+		if namespace == nil || xaddr == nil {
+			continue
+		}
+		ns := strings.TrimSpace(namespace.Text())
+		dev.addEndpoint(ns, strings.TrimSpace(xaddr.Text()))
+		for name, capabilityNamespace := range capabilityNamespaces {
+			if capabilityNamespace == ns {
+				dev.addEndpoint(name, strings.TrimSpace(xaddr.Text()))
+			}
+		}
+		if capabilities := service.FindElement("./Capabilities"); capabilities != nil {
+			capabilitiesDoc := etree.NewDocument()
+			capabilitiesDoc.SetRoot(capabilities.Copy())
+			dev.capabilities[ns], _ = capabilitiesDoc.WriteToString()
+		}
+	}
+	return len(services) > 0
+}
+
+//discover finds the service endpoints through GetServices and falls back to the deprecated GetCapabilities
+func (dev *device) discover() error {
 	dev.endpoints = make(map[string]string)
-	dev.addEndpoint("Device", "http://"+xaddr+"/onvif/device_service")
-	getCapabilities := Device.GetCapabilities{Category: "All"}
+	dev.capabilities = make(map[string]string)
+	dev.addEndpoint("Device", deviceServiceURL(dev.xaddr))
+	dev.addEndpoint(Xlmns["tds"], deviceServiceURL(dev.xaddr))
+
+	resp, err := dev.CallMethod(Device.GetServices{IncludeCapability: true})
+	if err == nil && resp.StatusCode == http.StatusOK && dev.getServices(resp) {
+		dev.shareTLSConfig()
+		return nil
+	}
+	if err == nil {
+		resp.Body.Close()
+	}
 
-	resp, err := dev.CallMethod(getCapabilities)
+	getCapabilities := Device.GetCapabilities{Category: "All"}
+	resp, err = dev.CallMethod(getCapabilities)
 	//fmt.Println(resp.Request.Host)
 	//fmt.Println(readResponse(resp))
 	if err != nil || resp.StatusCode != http.StatusOK {
-		return nil, errors.New("camera is not available at " + xaddr + " or it does not support ONVIF services")
+		return errors.New("camera is not available at " + dev.xaddr + " or it does not support ONVIF services")
 	}
 
 	dev.getSupportedServices(resp)
+	dev.shareTLSConfig()
+	return nil
+}
+
+//shareTLSConfig registers the TLS configuration of the device service for the hosts of the https service addresses
+func (dev *device) shareTLSConfig() {
+	deviceURL, err := url.Parse(deviceServiceURL(dev.xaddr))
+	if err != nil {
+		return
+	}
+	for _, endpoint := range dev.endpoints {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Scheme != "https" || u.Host == deviceURL.Host {
+			continue
+		}
+		networking.ShareTLSConfig(deviceURL.Host, u.Host)
+	}
+}
+
+//deviceServiceURL returns the device service address of <xaddr>,
+//xaddr is host:port (http) or a full http(s):// address
+func deviceServiceURL(xaddr string) string {
+	if strings.HasPrefix(xaddr, "http://") || strings.HasPrefix(xaddr, "https://") {
+		if strings.Count(xaddr, "/") > 2 {
+			return xaddr
+		}
+		return xaddr + "/onvif/device_service"
+	}
+	return "http://" + xaddr + "/onvif/device_service"
+}
+
+//NewDevice function construct a ONVIF Device entity
+func NewDevice(xaddr string) (*device, error) {
+	dev := new(device)
+	dev.xaddr = xaddr
+	if err := dev.discover(); err != nil {
+		return nil, err
+	}
+	return dev, nil
+}
+
+//NewDeviceWithAuth function construct a ONVIF Device entity with authentication data,
+//use it for devices which reject unauthenticated GetCapabilities (e.g. HTTP Digest only firmware).
+//The discovered endpoints are cached for endpointsTTL, use ProbeDevice to check the camera is reachable
+func NewDeviceWithAuth(xaddr, username, password string) (*device, error) {
+	dev := new(device)
+	dev.xaddr = xaddr
+	dev.Authenticate(username, password)
+	if dev.cachedEndpoints() {
+		return dev, nil
+	}
+	if err := dev.discover(); err != nil {
+		return nil, err
+	}
+	dev.cacheEndpoints()
+	return dev, nil
+}
+
+//ProbeDevice always discovers the endpoints again and refreshes the cache,
+//when the camera is not reachable the cached endpoints are dropped
+func ProbeDevice(xaddr, username, password string) (*device, error) {
+	dev := new(device)
+	dev.xaddr = xaddr
+	dev.Authenticate(username, password)
+	if err := dev.discover(); err != nil {
+		ResetEndpoints(xaddr)
+		return nil, err
+	}
+	dev.cacheEndpoints()
 	return dev, nil
 }
 
@@ -180,13 +325,21 @@ func (dev *device) addEndpoint(Key, Value string) {
 func (dev *device) Authenticate(username, password string) {
 	dev.login = username
 	dev.password = password
+	if username != "" && password != "" {
+		dev.timeOffset = cameraTimeOffset(dev.xaddr)
+	}
 }
 
-//GetEndpoint returns specific ONVIF service endpoint address
+//GetEndpoint returns specific ONVIF service endpoint address, <name> is a namespace or a GetCapabilities service name
 func (dev *device) GetEndpoint(name string) string {
 	return dev.endpoints[name]
 }
 
+//GetServiceCapabilities returns the capabilities (raw xml) GetServices reported for the <namespace>
+func (dev *device) GetServiceCapabilities(namespace string) string {
+	return dev.capabilities[namespace]
+}
+
 func buildMethodSOAP(msg string) (gosoap.SoapMessage, error) {
 	doc := etree.NewDocument()
 	if err := doc.ReadFromString(msg); err != nil {
@@ -206,22 +359,7 @@ func buildMethodSOAP(msg string) (gosoap.SoapMessage, error) {
 //CallMethod functions call an method, defined <method> struct.
 //You should use Authenticate method to call authorized requests.
 func (dev device) CallMethod(method interface{}) (*http.Response, error) {
-	pkgPath := strings.Split(reflect.TypeOf(method).PkgPath(), "/")
-	pkg := pkgPath[len(pkgPath)-1]
-
-	var endpoint string
-	switch pkg {
-	case "Device":
-		endpoint = dev.endpoints["Device"]
-	case "Event":
-		endpoint = dev.endpoints["Event"]
-	case "Imaging":
-		endpoint = dev.endpoints["Imaging"]
-	case "Media":
-		endpoint = dev.endpoints["Media"]
-	case "PTZ":
-		endpoint = dev.endpoints["PTZ"]
-	}
+	endpoint := dev.methodEndpoint(method)
 	//TODO: Get endpoint automatically
 	if dev.login != "" && dev.password != "" {
 		return dev.callAuthorizedMethod(endpoint, method)
@@ -230,6 +368,51 @@ func (dev device) CallMethod(method interface{}) (*http.Response, error) {
 	}
 }
 
+//CallMethodWithAttachment functions call an method with a binary attachment (MTOM/XOP),
+//<method> should reference the attachment by cid:<contentID>
+func (dev device) CallMethodWithAttachment(method interface{}, contentID, contentType string, attachment []byte) (*http.Response, error) {
+	endpoint := dev.methodEndpoint(method)
+
+	output, err := xml.MarshalIndent(method, "  ", "    ")
+	if err != nil {
+		return nil, err
+	}
+	soap, err := buildMethodSOAP(string(output))
+	if err != nil {
+		return nil, err
+	}
+	soap.AddRootNamespaces(Xlmns)
+	if dev.login == "" || dev.password == "" {
+		return networking.SendSoapWithAttachment(endpoint, soap.String(), contentID, contentType, attachment, nil)
+	}
+	return dev.sendAuthorized(soap, func(message string, digest *networking.DigestAuth) (*http.Response, error) {
+		return networking.SendSoapWithAttachment(endpoint, message, contentID, contentType, attachment, digest)
+	})
+}
+
+//methodEndpoint returns the service endpoint of the <method> struct,
+//it is routed by the namespace of the XMLName prefix (e.g. tds:GetServices)
+func (dev device) methodEndpoint(method interface{}) string {
+	return dev.endpoints[methodNamespace(method)]
+}
+
+//methodNamespace returns the namespace of the <method> struct XMLName prefix
+func methodNamespace(method interface{}) string {
+	t := reflect.TypeOf(method)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	field, ok := t.FieldByName("XMLName")
+	if !ok {
+		return ""
+	}
+	name := strings.Split(field.Tag.Get("xml"), ",")[0]
+	if i := strings.Index(name, ":"); i > 0 {
+		return Xlmns[name[:i]]
+	}
+	return ""
+}
+
 //CallNonAuthorizedMethod functions call an method, defined <method> struct without authentication data
 func (dev device) callNonAuthorizedMethod(endpoint string, method interface{}) (*http.Response, error) {
 	//TODO: Get endpoint automatically
@@ -281,13 +464,14 @@ func (dev device) callAuthorizedMethod(endpoint string, method interface{}) (*ht
 	}
 
 	/*
-		Adding namespaces and WS-Security headers
+		Adding namespaces
 	*/
 	soap.AddRootNamespaces(Xlmns)
-	soap.AddWSSecurity(dev.login, dev.password)
 
 	/*
-		Sending request and returns the response
+		Adding WS-Security headers and/or HTTP Digest, sending request and returns the response
 	*/
-	return networking.SendSoap(endpoint, soap.String())
+	return dev.sendAuthorized(soap, func(message string, digest *networking.DigestAuth) (*http.Response, error) {
+		return networking.SendSoapWithDigest(endpoint, message, digest)
+	})
 }
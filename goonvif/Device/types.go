@@ -87,17 +87,212 @@ type StorageConfiguration struct {
 }
 
 type StorageConfigurationData struct {
-	Type       xsd.String     `xml:"type,attr"`
-	LocalPath  xsd.AnyURI     `xml:"tds:LocalPath"`
-	StorageUri xsd.AnyURI     `xml:"tds:StorageUri"`
-	User       UserCredential `xml:"tds:User"`
-	Extension  xsd.AnyURI     `xml:"tds:Extension"`
+	Type       xsd.String      `xml:"type,attr"`
+	LocalPath  xsd.AnyURI      `xml:"tds:LocalPath,omitempty"`
+	StorageUri xsd.AnyURI      `xml:"tds:StorageUri,omitempty"`
+	User       *UserCredential `xml:"tds:User,omitempty"`
+	Extension  xsd.AnyURI      `xml:"tds:Extension,omitempty"`
 }
 
 type UserCredential struct {
 	UserName  xsd.String  `xml:"tds:UserName"`
-	Password  xsd.String  `xml:"tds:Password"`
-	Extension xsd.AnyType `xml:"tds:Extension"`
+	Password  xsd.String  `xml:"tds:Password,omitempty"`
+	Extension xsd.AnyType `xml:"tds:Extension,omitempty"`
+}
+
+//StorageConfigurationInfo is the response side of StorageConfiguration, the password is never returned
+type StorageConfigurationInfo struct {
+	Token string `xml:"token,attr"`
+	Data  struct {
+		Type       string `xml:"type,attr"`
+		LocalPath  string
+		StorageUri string
+		User       struct {
+			UserName string
+		}
+	}
+}
+
+//RelayOutput is the response side of onvif.RelayOutput
+type RelayOutput struct {
+	Token      onvif.ReferenceToken `xml:"token,attr"`
+	Properties RelayOutputProperties
+}
+
+type RelayOutputProperties struct {
+	Mode      onvif.RelayMode
+	DelayTime xsd.Duration
+	IdleState onvif.RelayIdleState
+}
+
+//UserInfo is the response side of onvif.User, the password is never returned
+type UserInfo struct {
+	Username  string
+	UserLevel onvif.UserLevel
+}
+
+//NTPInformation is the response side of onvif.NTPInformation
+type NTPInformation struct {
+	FromDHCP    xsd.Boolean
+	NTPFromDHCP []NetworkHost
+	NTPManual   []NetworkHost
+}
+
+//NetworkHost is the response side of onvif.NetworkHost
+type NetworkHost struct {
+	Type        onvif.NetworkHostType
+	IPv4Address onvif.IPv4Address
+	IPv6Address onvif.IPv6Address
+	DNSname     onvif.DNSName
+}
+
+//SystemDateTime is the response side of onvif.SystemDateTime
+type SystemDateTime struct {
+	DateTimeType    onvif.SetDateTimeType
+	DaylightSavings xsd.Boolean
+	TimeZone        struct {
+		TZ xsd.Token
+	}
+	UTCDateTime   DateTime
+	LocalDateTime DateTime
+}
+
+//DateTime is the response side of onvif.DateTime
+type DateTime struct {
+	Time struct {
+		Hour   int
+		Minute int
+		Second int
+	}
+	Date struct {
+		Year  int
+		Month int
+		Day   int
+	}
+}
+
+//NetworkInterface is the response side of onvif.NetworkInterface
+type NetworkInterface struct {
+	Token   string `xml:"token,attr"`
+	Enabled xsd.Boolean
+	Info    struct {
+		Name      string
+		HwAddress string
+		MTU       int
+	}
+	IPv4 struct {
+		Enabled xsd.Boolean
+		Config  struct {
+			Manual    []PrefixedIPv4Address
+			LinkLocal PrefixedIPv4Address
+			FromDHCP  PrefixedIPv4Address
+			DHCP      xsd.Boolean
+		}
+	}
+}
+
+//PrefixedIPv4Address is the response side of onvif.PrefixedIPv4Address
+type PrefixedIPv4Address struct {
+	Address      string
+	PrefixLength int
+}
+
+//PrefixedIPv6Address is the response side of onvif.PrefixedIPv6Address
+type PrefixedIPv6Address struct {
+	Address      string
+	PrefixLength int
+}
+
+//IPAddressFilter is the response side of onvif.IPAddressFilter, Type is Allow or Deny
+type IPAddressFilter struct {
+	Type        string
+	IPv4Address []PrefixedIPv4Address
+	IPv6Address []PrefixedIPv6Address
+}
+
+//Certificate is the response side of onvif.Certificate, Data is the base64 DER certificate
+type Certificate struct {
+	CertificateID string
+	Certificate   BinaryData
+}
+
+//BinaryData is the response side of onvif.BinaryData
+type BinaryData struct {
+	Data string
+}
+
+//CertificateStatus is the response side of onvif.CertificateStatus
+type CertificateStatus struct {
+	CertificateID string
+	Status        xsd.Boolean
+}
+
+//SystemLog is the response side of onvif.SystemLog and onvif.SupportInformation,
+//the content is either inline in String or an MTOM attachment referenced by Binary
+type SystemLog struct {
+	Binary AttachmentData
+	String string
+}
+
+//AttachmentData is the response side of onvif.AttachmentData
+type AttachmentData struct {
+	ContentType string `xml:"contentType,attr"`
+	Include     struct {
+		Href string `xml:"href,attr"`
+	}
+}
+
+//BackupFile is the response side of onvif.BackupFile
+type BackupFile struct {
+	Name string
+	Data AttachmentData
+}
+
+//SystemLogUri is the response side of onvif.SystemLogUri
+type SystemLogUri struct {
+	Type string
+	Uri  string
+}
+
+//NetworkInterfaceSetConfiguration is the request side of onvif.NetworkInterfaceSetConfiguration, only IPv4 is set
+type NetworkInterfaceSetConfiguration struct {
+	Enabled xsd.Boolean                           `xml:"onvif:Enabled"`
+	MTU     int                                   `xml:"onvif:MTU,omitempty"`
+	IPv4    *IPv4NetworkInterfaceSetConfiguration `xml:"onvif:IPv4,omitempty"`
+}
+
+type IPv4NetworkInterfaceSetConfiguration struct {
+	Enabled xsd.Boolean                 `xml:"onvif:Enabled"`
+	Manual  []onvif.PrefixedIPv4Address `xml:"onvif:Manual,omitempty"`
+	DHCP    xsd.Boolean                 `xml:"onvif:DHCP"`
+}
+
+//DNSInformation is the response side of onvif.DNSInformation
+type DNSInformation struct {
+	FromDHCP     xsd.Boolean
+	SearchDomain []string
+	DNSFromDHCP  []IPAddress
+	DNSManual    []IPAddress
+}
+
+//IPAddress is the response side of onvif.IPAddress
+type IPAddress struct {
+	Type        string
+	IPv4Address string
+	IPv6Address string
+}
+
+//NetworkGateway is the response side of onvif.NetworkGateway
+type NetworkGateway struct {
+	IPv4Address []string
+	IPv6Address []string
+}
+
+//NetworkProtocol is the response side of onvif.NetworkProtocol
+type NetworkProtocol struct {
+	Name    string
+	Enabled xsd.Boolean
+	Port    []int
 }
 
 //Device main types
@@ -108,7 +303,7 @@ type GetServices struct {
 }
 
 type GetServicesResponse struct {
-	Service Service
+	Service []Service
 }
 
 type GetServiceCapabilities struct {
@@ -136,7 +331,7 @@ type SetSystemDateAndTime struct {
 	DateTimeType    onvif.SetDateTimeType `xml:"tds:DateTimeType"`
 	DaylightSavings xsd.Boolean           `xml:"tds:DaylightSavings"`
 	TimeZone        onvif.TimeZone        `xml:"tds:TimeZone"`
-	UTCDateTime     onvif.DateTime        `xml:"tds:UTCDateTime"`
+	UTCDateTime     *onvif.DateTime       `xml:"tds:UTCDateTime,omitempty"`
 }
 
 type SetSystemDateAndTimeResponse struct {
@@ -147,7 +342,7 @@ type GetSystemDateAndTime struct {
 }
 
 type GetSystemDateAndTimeResponse struct {
-	SystemDateAndTime onvif.SystemDateTime
+	SystemDateAndTime SystemDateTime
 }
 
 type SetSystemFactoryDefault struct {
@@ -189,7 +384,7 @@ type GetSystemBackup struct {
 }
 
 type GetSystemBackupResponse struct {
-	BackupFiles onvif.BackupFile
+	BackupFiles []BackupFile
 }
 
 type GetSystemLog struct {
@@ -198,7 +393,7 @@ type GetSystemLog struct {
 }
 
 type GetSystemLogResponse struct {
-	SystemLog onvif.SystemLog
+	SystemLog SystemLog
 }
 
 type GetSystemSupportInformation struct {
@@ -206,7 +401,7 @@ type GetSystemSupportInformation struct {
 }
 
 type GetSystemSupportInformationResponse struct {
-	SupportInformation onvif.SupportInformation
+	SupportInformation SystemLog
 }
 
 type GetScopes struct {
@@ -322,7 +517,7 @@ type GetUsers struct {
 }
 
 type GetUsersResponse struct {
-	User onvif.User
+	User []UserInfo
 }
 
 //TODO: List of users
@@ -398,14 +593,14 @@ type GetDNS struct {
 }
 
 type GetDNSResponse struct {
-	DNSInformation onvif.DNSInformation
+	DNSInformation DNSInformation
 }
 
 type SetDNS struct {
-	XMLName      string          `xml:"tds:SetDNS"`
-	FromDHCP     xsd.Boolean     `xml:"tds:FromDHCP"`
-	SearchDomain xsd.Token       `xml:"tds:SearchDomain"`
-	DNSManual    onvif.IPAddress `xml:"tds:DNSManual"`
+	XMLName      string            `xml:"tds:SetDNS"`
+	FromDHCP     xsd.Boolean       `xml:"tds:FromDHCP"`
+	SearchDomain []xsd.Token       `xml:"tds:SearchDomain,omitempty"`
+	DNSManual    []onvif.IPAddress `xml:"tds:DNSManual,omitempty"`
 }
 
 type SetDNSResponse struct {
@@ -416,13 +611,13 @@ type GetNTP struct {
 }
 
 type GetNTPResponse struct {
-	NTPInformation onvif.NTPInformation
+	NTPInformation NTPInformation
 }
 
 type SetNTP struct {
-	XMLName   string            `xml:"tds:SetNTP"`
-	FromDHCP  xsd.Boolean       `xml:"tds:FromDHCP"`
-	NTPManual onvif.NetworkHost `xml:"tds:NTPManual"`
+	XMLName   string              `xml:"tds:SetNTP"`
+	FromDHCP  xsd.Boolean         `xml:"tds:FromDHCP"`
+	NTPManual []onvif.NetworkHost `xml:"tds:NTPManual,omitempty"`
 }
 
 type SetNTPResponse struct {
@@ -451,13 +646,13 @@ type GetNetworkInterfaces struct {
 }
 
 type GetNetworkInterfacesResponse struct {
-	NetworkInterfaces onvif.NetworkInterface
+	NetworkInterfaces []NetworkInterface
 }
 
 type SetNetworkInterfaces struct {
-	XMLName          string                                 `xml:"tds:SetNetworkInterfaces"`
-	InterfaceToken   onvif.ReferenceToken                   `xml:"tds:InterfaceToken"`
-	NetworkInterface onvif.NetworkInterfaceSetConfiguration `xml:"tds:NetworkInterface"`
+	XMLName          string                           `xml:"tds:SetNetworkInterfaces"`
+	InterfaceToken   onvif.ReferenceToken             `xml:"tds:InterfaceToken"`
+	NetworkInterface NetworkInterfaceSetConfiguration `xml:"tds:NetworkInterface"`
 }
 
 type SetNetworkInterfacesResponse struct {
@@ -469,12 +664,12 @@ type GetNetworkProtocols struct {
 }
 
 type GetNetworkProtocolsResponse struct {
-	NetworkProtocols onvif.NetworkProtocol
+	NetworkProtocols []NetworkProtocol
 }
 
 type SetNetworkProtocols struct {
-	XMLName          string                `xml:"tds:SetNetworkProtocols"`
-	NetworkProtocols onvif.NetworkProtocol `xml:"tds:NetworkProtocols"`
+	XMLName          string                  `xml:"tds:SetNetworkProtocols"`
+	NetworkProtocols []onvif.NetworkProtocol `xml:"tds:NetworkProtocols"`
 }
 
 type SetNetworkProtocolsResponse struct {
@@ -485,13 +680,13 @@ type GetNetworkDefaultGateway struct {
 }
 
 type GetNetworkDefaultGatewayResponse struct {
-	NetworkGateway onvif.NetworkGateway
+	NetworkGateway NetworkGateway
 }
 
 type SetNetworkDefaultGateway struct {
-	XMLName     string            `xml:"tds:SetNetworkDefaultGateway"`
-	IPv4Address onvif.IPv4Address `xml:"tds:IPv4Address"`
-	IPv6Address onvif.IPv6Address `xml:"tds:IPv6Address"`
+	XMLName     string              `xml:"tds:SetNetworkDefaultGateway"`
+	IPv4Address []onvif.IPv4Address `xml:"tds:IPv4Address,omitempty"`
+	IPv6Address []onvif.IPv6Address `xml:"tds:IPv6Address,omitempty"`
 }
 
 type SetNetworkDefaultGatewayResponse struct {
@@ -519,7 +714,7 @@ type GetIPAddressFilter struct {
 }
 
 type GetIPAddressFilterResponse struct {
-	IPAddressFilter onvif.IPAddressFilter
+	IPAddressFilter IPAddressFilter
 }
 
 type SetIPAddressFilter struct {
@@ -545,7 +740,7 @@ type AddIPAddressFilterResponse struct {
 
 type RemoveIPAddressFilter struct {
 	XMLName         string                `xml:"tds:RemoveIPAddressFilter"`
-	IPAddressFilter onvif.IPAddressFilter `xml:"onvif:IPAddressFilter"`
+	IPAddressFilter onvif.IPAddressFilter `xml:"tds:IPAddressFilter"`
 }
 
 type RemoveIPAddressFilterResponse struct {
@@ -576,7 +771,7 @@ type CreateCertificate struct {
 }
 
 type CreateCertificateResponse struct {
-	NvtCertificate onvif.Certificate
+	NvtCertificate Certificate
 }
 
 type GetCertificates struct {
@@ -584,7 +779,7 @@ type GetCertificates struct {
 }
 
 type GetCertificatesResponse struct {
-	NvtCertificate onvif.Certificate
+	NvtCertificate []Certificate
 }
 
 type GetCertificatesStatus struct {
@@ -592,7 +787,7 @@ type GetCertificatesStatus struct {
 }
 
 type GetCertificatesStatusResponse struct {
-	CertificateStatus onvif.CertificateStatus
+	CertificateStatus []CertificateStatus
 }
 
 type SetCertificatesStatus struct {
@@ -616,12 +811,12 @@ type DeleteCertificatesResponse struct {
 type GetPkcs10Request struct {
 	XMLName       string           `xml:"tds:GetPkcs10Request"`
 	CertificateID xsd.Token        `xml:"tds:CertificateID"`
-	Subject       xsd.String       `xml:"tds:Subject"`
-	Attributes    onvif.BinaryData `xml:"tds:Attributes"`
+	Subject       xsd.String        `xml:"tds:Subject"`
+	Attributes    *onvif.BinaryData `xml:"tds:Attributes,omitempty"`
 }
 
 type GetPkcs10RequestResponse struct {
-	Pkcs10Request onvif.BinaryData
+	Pkcs10Request BinaryData
 }
 
 //TODO: one or more NTVCertificate
@@ -654,7 +849,7 @@ type GetRelayOutputs struct {
 }
 
 type GetRelayOutputsResponse struct {
-	RelayOutputs onvif.RelayOutput
+	RelayOutputs []RelayOutput
 }
 
 type SetRelayOutputSettings struct {
@@ -689,7 +884,7 @@ type GetCACertificates struct {
 }
 
 type GetCACertificatesResponse struct {
-	CACertificate onvif.Certificate
+	CACertificate []Certificate
 }
 
 //TODO: one or more CertificateWithPrivateKey
@@ -791,10 +986,11 @@ type GetSystemUris struct {
 }
 
 type GetSystemUrisResponse struct {
-	SystemLogUris   onvif.SystemLogUriList
-	SupportInfoUri  xsd.AnyURI
-	SystemBackupUri xsd.AnyURI
-	Extension       xsd.AnyType
+	SystemLogUris struct {
+		SystemLog []SystemLogUri
+	}
+	SupportInfoUri  string
+	SystemBackupUri string
 }
 
 type StartFirmwareUpgrade struct {
@@ -821,12 +1017,12 @@ type GetStorageConfigurations struct {
 }
 
 type GetStorageConfigurationsResponse struct {
-	StorageConfigurations StorageConfiguration
+	StorageConfigurations []StorageConfigurationInfo
 }
 
 type CreateStorageConfiguration struct {
-	XMLName              string `xml:"tds:CreateStorageConfiguration"`
-	StorageConfiguration StorageConfigurationData
+	XMLName              string                   `xml:"tds:CreateStorageConfiguration"`
+	StorageConfiguration StorageConfigurationData `xml:"tds:StorageConfiguration"`
 }
 
 type CreateStorageConfigurationResponse struct {
@@ -0,0 +1,58 @@
+package goonvif
+
+import (
+	"camera/goonvif/networking"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const capabilitiesResponse = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema"><env:Body><tds:GetCapabilitiesResponse><tds:Capabilities>
+<tt:Device><tt:XAddr>http://192.168.1.64/onvif/device_service</tt:XAddr></tt:Device>
+<tt:Media><tt:XAddr>http://192.168.1.64/onvif/Media</tt:XAddr></tt:Media>
+<tt:Extension>
+<tt:DeviceIO><tt:XAddr>http://192.168.1.64/onvif/DeviceIO</tt:XAddr></tt:DeviceIO>
+<tt:Recording><tt:XAddr>http://192.168.1.64/onvif/Recording</tt:XAddr></tt:Recording>
+<tt:Search><tt:XAddr>http://192.168.1.64/onvif/SearchRecording</tt:XAddr></tt:Search>
+<tt:Replay><tt:XAddr>http://192.168.1.64/onvif/Replay</tt:XAddr></tt:Replay>
+</tt:Extension>
+</tds:Capabilities></tds:GetCapabilitiesResponse></env:Body></env:Envelope>`
+
+func TestGetSupportedServices(t *testing.T) {
+	dev := &device{endpoints: make(map[string]string)}
+	dev.getSupportedServices(&http.Response{Body: ioutil.NopCloser(strings.NewReader(capabilitiesResponse))})
+
+	want := map[string]string{
+		Xlmns["tds"]: "http://192.168.1.64/onvif/device_service",
+		Xlmns["trt"]: "http://192.168.1.64/onvif/Media",
+		Xlmns["tmd"]: "http://192.168.1.64/onvif/DeviceIO",
+		Xlmns["trc"]: "http://192.168.1.64/onvif/Recording",
+		Xlmns["tse"]: "http://192.168.1.64/onvif/SearchRecording",
+		Xlmns["trp"]: "http://192.168.1.64/onvif/Replay",
+		"Search":     "http://192.168.1.64/onvif/SearchRecording",
+	}
+	for name, endpoint := range want {
+		if got := dev.GetEndpoint(name); got != endpoint {
+			t.Errorf("endpoint %s = %q, want %q", name, got, endpoint)
+		}
+	}
+}
+
+func TestShareTLSConfig(t *testing.T) {
+	networking.SetTLSConfig("192.168.1.64", &tls.Config{ServerName: "camera"})
+	dev := &device{xaddr: "https://192.168.1.64", endpoints: map[string]string{
+		Xlmns["tds"]: "https://192.168.1.64/onvif/device_service",
+		Xlmns["trt"]: "https://192.168.1.64:8443/onvif/Media",
+		Xlmns["tev"]: "http://192.168.1.64:8080/onvif/Events",
+	}}
+	dev.shareTLSConfig()
+
+	if networking.NewClient("https://192.168.1.64:8443/onvif/Media").Transport == nil {
+		t.Error("https service address does not use the camera TLS configuration")
+	}
+	if networking.NewClient("https://192.168.1.64:8080/onvif/Events").Transport != nil {
+		t.Error("TLS configuration registered for a http service address")
+	}
+}
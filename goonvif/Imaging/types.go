@@ -14,11 +14,36 @@ type GetImagingSettings struct {
 	VideoSourceToken onvif.ReferenceToken `xml:"timg:VideoSourceToken"`
 }
 
+type GetImagingSettingsResponse struct {
+	ImagingSettings ImagingSettings
+}
+
+//ImagingSettings is the response side of onvif.ImagingSettings20, the values the camera omits are nil
+type ImagingSettings struct {
+	Brightness      *float64
+	ColorSaturation *float64
+	Contrast        *float64
+	IrCutFilter     string
+	Sharpness       *float64
+}
+
+//ImagingSettingsData is the request side of onvif.ImagingSettings20, only the set values are sent
+type ImagingSettingsData struct {
+	Brightness      *float64 `xml:"onvif:Brightness,omitempty"`
+	ColorSaturation *float64 `xml:"onvif:ColorSaturation,omitempty"`
+	Contrast        *float64 `xml:"onvif:Contrast,omitempty"`
+	IrCutFilter     string   `xml:"onvif:IrCutFilter,omitempty"`
+	Sharpness       *float64 `xml:"onvif:Sharpness,omitempty"`
+}
+
 type SetImagingSettings struct {
-	XMLName          string                  `xml:"timg:SetImagingSettings"`
-	VideoSourceToken onvif.ReferenceToken    `xml:"timg:VideoSourceToken"`
-	ImagingSettings  onvif.ImagingSettings20 `xml:"timg:ImagingSettings"`
-	ForcePersistence xsd.Boolean             `xml:"timg:ForcePersistence"`
+	XMLName          string               `xml:"timg:SetImagingSettings"`
+	VideoSourceToken onvif.ReferenceToken `xml:"timg:VideoSourceToken"`
+	ImagingSettings  ImagingSettingsData  `xml:"timg:ImagingSettings"`
+	ForcePersistence xsd.Boolean          `xml:"timg:ForcePersistence"`
+}
+
+type SetImagingSettingsResponse struct {
 }
 
 type GetOptions struct {
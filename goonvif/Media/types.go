@@ -28,6 +28,32 @@ type StreamingCapabilities struct {
 	NoRTSPStreaming     bool `xml:"NoRTSPStreaming,attr"`
 }
 
+//VideoEncoderConfiguration is the response side of onvif.VideoEncoderConfiguration
+type VideoEncoderConfiguration struct {
+	Token      string `xml:"token,attr"`
+	Name       string
+	UseCount   int
+	Encoding   string
+	Resolution struct {
+		Width  int
+		Height int
+	}
+	Quality     float64
+	RateControl struct {
+		FrameRateLimit   int
+		EncodingInterval int
+		BitrateLimit     int
+	}
+	MPEG4 struct {
+		GovLength    int
+		Mpeg4Profile string
+	}
+	H264 struct {
+		GovLength   int
+		H264Profile string
+	}
+}
+
 //Media main types
 
 type GetServiceCapabilities struct {
@@ -263,7 +289,7 @@ type GetVideoEncoderConfigurations struct {
 }
 
 type GetVideoEncoderConfigurationsResponse struct {
-	Configurations onvif.VideoEncoderConfiguration
+	Configurations []VideoEncoderConfiguration
 }
 
 type GetAudioSourceConfigurations struct {
@@ -287,7 +313,7 @@ type GetVideoAnalyticsConfigurations struct {
 }
 
 type GetVideoAnalyticsConfigurationsResponse struct {
-	Configurations onvif.VideoAnalyticsConfiguration
+	Configurations []onvif.VideoAnalyticsConfiguration
 }
 
 type GetMetadataConfigurations struct {
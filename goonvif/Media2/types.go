@@ -0,0 +1,377 @@
+package Media2
+
+import (
+	"camera/goonvif/xsd/onvif"
+)
+
+//Media2 (ver20) service, H.265 encoders are only visible through it
+
+type Capabilities struct {
+	SnapshotUri         bool `xml:"SnapshotUri,attr"`
+	Rotation            bool `xml:"Rotation,attr"`
+	VideoSourceMode     bool `xml:"VideoSourceMode,attr"`
+	OSD                 bool `xml:"OSD,attr"`
+	TemporaryOSDText    bool `xml:"TemporaryOSDText,attr"`
+	Mask                bool `xml:"Mask,attr"`
+	SourceMask          bool `xml:"SourceMask,attr"`
+	ProfileCapabilities struct {
+		MaximumNumberOfProfiles int    `xml:"MaximumNumberOfProfiles,attr"`
+		ConfigurationsSupported string `xml:"ConfigurationsSupported,attr"`
+	}
+	StreamingCapabilities struct {
+		RTSPStreaming       bool `xml:"RTSPStreaming,attr"`
+		RTPMulticast        bool `xml:"RTPMulticast,attr"`
+		RTP_RTSP_TCP        bool `xml:"RTP_RTSP_TCP,attr"`
+		NonAggregateControl bool `xml:"NonAggregateControl,attr"`
+	}
+}
+
+//Configuration is the common part of the profile configurations
+type Configuration struct {
+	Token    string `xml:"token,attr"`
+	Name     string
+	UseCount int
+}
+
+type MediaProfile struct {
+	Token          string `xml:"token,attr"`
+	Fixed          bool   `xml:"fixed,attr"`
+	Name           string
+	Configurations ConfigurationSet
+}
+
+type ConfigurationSet struct {
+	VideoSource  VideoSourceConfiguration
+	AudioSource  Configuration
+	VideoEncoder VideoEncoder2Configuration
+	AudioEncoder Configuration
+	Analytics    Configuration
+	PTZ          Configuration
+	Metadata     Configuration
+}
+
+type VideoSourceConfiguration struct {
+	Configuration
+	SourceToken string
+}
+
+type VideoResolution struct {
+	Width  int
+	Height int
+}
+
+type VideoRateControl struct {
+	ConstantBitRate bool `xml:"ConstantBitRate,attr"`
+	FrameRateLimit  float64
+	BitrateLimit    int
+}
+
+type VideoEncoder2Configuration struct {
+	Configuration
+	GovLength   int    `xml:"GovLength,attr"`
+	Profile     string `xml:"Profile,attr"`
+	Encoding    string
+	Resolution  VideoResolution
+	RateControl VideoRateControl
+	Quality     float64
+}
+
+type IntRange struct {
+	Min int
+	Max int
+}
+
+type FloatRange struct {
+	Min float64
+	Max float64
+}
+
+type VideoEncoder2ConfigurationOptions struct {
+	GovLengthRange           string `xml:"GovLengthRange,attr"`      //IntList, e.g. "1 400"
+	FrameRatesSupported      string `xml:"FrameRatesSupported,attr"` //FloatList
+	ProfilesSupported        string `xml:"ProfilesSupported,attr"`   //StringList
+	ConstantBitRateSupported bool   `xml:"ConstantBitRateSupported,attr"`
+	Encoding                 string
+	QualityRange             FloatRange
+	ResolutionsAvailable     []VideoResolution
+	BitrateRange             IntRange
+}
+
+//Mask is the request side of tr2:Mask
+type Mask struct {
+	Token              string               `xml:"token,attr,omitempty"`
+	ConfigurationToken onvif.ReferenceToken `xml:"tr2:ConfigurationToken"`
+	Polygon            Polygon              `xml:"tr2:Polygon"`
+	Type               string               `xml:"tr2:Type"`
+	Color              *onvif.Color         `xml:"tr2:Color,omitempty"`
+	Enabled            bool                 `xml:"tr2:Enabled"`
+}
+
+type Polygon struct {
+	Point []onvif.Vector `xml:"onvif:Point"`
+}
+
+//MaskInfo is the response side of Mask
+type MaskInfo struct {
+	Token              string `xml:"token,attr"`
+	ConfigurationToken string
+	Polygon            struct {
+		Point []onvif.Vector
+	}
+	Type    string
+	Enabled bool
+}
+
+type MaskOptions struct {
+	RectangleOnly   bool `xml:"RectangleOnly,attr"`
+	SingleColorOnly bool `xml:"SingleColorOnly,attr"`
+	MaxMasks        int  `xml:"MaxMasks,attr"`
+	MaxPoints       int  `xml:"MaxPoints,attr"`
+	Types           []string
+}
+
+//OSDConfiguration is the request side of onvif.OSDConfiguration, unused parts are omitted
+type OSDConfiguration struct {
+	Token                         string                `xml:"token,attr,omitempty"`
+	VideoSourceConfigurationToken onvif.ReferenceToken  `xml:"onvif:VideoSourceConfigurationToken"`
+	Type                          string                `xml:"onvif:Type"`
+	Position                      OSDPosConfiguration   `xml:"onvif:Position"`
+	TextString                    *OSDTextConfiguration `xml:"onvif:TextString,omitempty"`
+	Image                         *OSDImgConfiguration  `xml:"onvif:Image,omitempty"`
+}
+
+type OSDPosConfiguration struct {
+	Type string        `xml:"onvif:Type"`
+	Pos  *onvif.Vector `xml:"onvif:Pos,omitempty"`
+}
+
+type OSDTextConfiguration struct {
+	Type       string `xml:"onvif:Type"`
+	DateFormat string `xml:"onvif:DateFormat,omitempty"`
+	TimeFormat string `xml:"onvif:TimeFormat,omitempty"`
+	FontSize   int    `xml:"onvif:FontSize,omitempty"`
+	PlainText  string `xml:"onvif:PlainText,omitempty"`
+}
+
+type OSDImgConfiguration struct {
+	ImgPath string `xml:"onvif:ImgPath"`
+}
+
+//OSDInfo is the response side of onvif.OSDConfiguration
+type OSDInfo struct {
+	Token                         string `xml:"token,attr"`
+	VideoSourceConfigurationToken string
+	Type                          string
+	Position                      struct {
+		Type string
+		Pos  onvif.Vector
+	}
+	TextString struct {
+		Type       string
+		DateFormat string
+		TimeFormat string
+		FontSize   int
+		PlainText  string
+	}
+	Image struct {
+		ImgPath string
+	}
+}
+
+type OSDOptions struct {
+	MaximumNumberOfOSDs struct {
+		Total       int `xml:"Total,attr"`
+		Image       int `xml:"Image,attr"`
+		PlainText   int `xml:"PlainText,attr"`
+		Date        int `xml:"Date,attr"`
+		Time        int `xml:"Time,attr"`
+		DateAndTime int `xml:"DateAndTime,attr"`
+	}
+	Type           []string
+	PositionOption []string
+	TextOption     struct {
+		Type          []string
+		FontSizeRange IntRange
+		DateFormat    []string
+		TimeFormat    []string
+	}
+}
+
+//Media2 main types
+
+type GetServiceCapabilities struct {
+	XMLName string `xml:"tr2:GetServiceCapabilities"`
+}
+
+type GetServiceCapabilitiesResponse struct {
+	Capabilities Capabilities
+}
+
+type GetProfiles struct {
+	XMLName string   `xml:"tr2:GetProfiles"`
+	Token   string   `xml:"tr2:Token,omitempty"`
+	Type    []string `xml:"tr2:Type,omitempty"` //All or the configuration types to include
+}
+
+type GetProfilesResponse struct {
+	Profiles []MediaProfile
+}
+
+type GetStreamUri struct {
+	XMLName      string               `xml:"tr2:GetStreamUri"`
+	Protocol     string               `xml:"tr2:Protocol"` //RtspUnicast, RtspMulticast, RTSP, RtspOverHttp
+	ProfileToken onvif.ReferenceToken `xml:"tr2:ProfileToken"`
+}
+
+type GetStreamUriResponse struct {
+	Uri string
+}
+
+type GetSnapshotUri struct {
+	XMLName      string               `xml:"tr2:GetSnapshotUri"`
+	ProfileToken onvif.ReferenceToken `xml:"tr2:ProfileToken"`
+}
+
+type GetSnapshotUriResponse struct {
+	Uri string
+}
+
+type GetVideoEncoderConfigurations struct {
+	XMLName            string               `xml:"tr2:GetVideoEncoderConfigurations"`
+	ConfigurationToken onvif.ReferenceToken `xml:"tr2:ConfigurationToken,omitempty"`
+	ProfileToken       onvif.ReferenceToken `xml:"tr2:ProfileToken,omitempty"`
+}
+
+type GetVideoEncoderConfigurationsResponse struct {
+	Configurations []VideoEncoder2Configuration
+}
+
+//VideoEncoder2ConfigurationData is the request side of tt:VideoEncoder2Configuration
+type VideoEncoder2ConfigurationData struct {
+	Token       string                `xml:"token,attr"`
+	GovLength   int                   `xml:"GovLength,attr,omitempty"`
+	Profile     string                `xml:"Profile,attr,omitempty"`
+	Name        string                `xml:"onvif:Name"`
+	UseCount    int                   `xml:"onvif:UseCount"`
+	Encoding    string                `xml:"onvif:Encoding"`
+	Resolution  VideoResolutionData   `xml:"onvif:Resolution"`
+	RateControl *VideoRateControlData `xml:"onvif:RateControl,omitempty"`
+	Quality     float64               `xml:"onvif:Quality"`
+}
+
+type VideoResolutionData struct {
+	Width  int `xml:"onvif:Width"`
+	Height int `xml:"onvif:Height"`
+}
+
+type VideoRateControlData struct {
+	ConstantBitRate bool    `xml:"ConstantBitRate,attr"`
+	FrameRateLimit  float64 `xml:"onvif:FrameRateLimit"`
+	BitrateLimit    int     `xml:"onvif:BitrateLimit"`
+}
+
+type SetVideoEncoderConfiguration struct {
+	XMLName       string                         `xml:"tr2:SetVideoEncoderConfiguration"`
+	Configuration VideoEncoder2ConfigurationData `xml:"tr2:Configuration"`
+}
+
+type SetVideoEncoderConfigurationResponse struct {
+}
+
+type GetVideoEncoderConfigurationOptions struct {
+	XMLName            string               `xml:"tr2:GetVideoEncoderConfigurationOptions"`
+	ConfigurationToken onvif.ReferenceToken `xml:"tr2:ConfigurationToken,omitempty"`
+	ProfileToken       onvif.ReferenceToken `xml:"tr2:ProfileToken,omitempty"`
+}
+
+type GetVideoEncoderConfigurationOptionsResponse struct {
+	Options []VideoEncoder2ConfigurationOptions
+}
+
+type GetMasks struct {
+	XMLName            string               `xml:"tr2:GetMasks"`
+	Token              onvif.ReferenceToken `xml:"tr2:Token,omitempty"`
+	ConfigurationToken onvif.ReferenceToken `xml:"tr2:ConfigurationToken,omitempty"`
+}
+
+type GetMasksResponse struct {
+	Masks []MaskInfo
+}
+
+type GetMaskOptions struct {
+	XMLName            string               `xml:"tr2:GetMaskOptions"`
+	ConfigurationToken onvif.ReferenceToken `xml:"tr2:ConfigurationToken"`
+}
+
+type GetMaskOptionsResponse struct {
+	Options MaskOptions
+}
+
+type CreateMask struct {
+	XMLName string `xml:"tr2:CreateMask"`
+	Mask    Mask   `xml:"tr2:Mask"`
+}
+
+type CreateMaskResponse struct {
+	Token string
+}
+
+type SetMask struct {
+	XMLName string `xml:"tr2:SetMask"`
+	Mask    Mask   `xml:"tr2:Mask"`
+}
+
+type SetMaskResponse struct {
+}
+
+type DeleteMask struct {
+	XMLName string               `xml:"tr2:DeleteMask"`
+	Token   onvif.ReferenceToken `xml:"tr2:Token"`
+}
+
+type DeleteMaskResponse struct {
+}
+
+type GetOSDs struct {
+	XMLName            string               `xml:"tr2:GetOSDs"`
+	OSDToken           onvif.ReferenceToken `xml:"tr2:OSDToken,omitempty"`
+	ConfigurationToken onvif.ReferenceToken `xml:"tr2:ConfigurationToken,omitempty"`
+}
+
+type GetOSDsResponse struct {
+	OSDs []OSDInfo
+}
+
+type GetOSDOptions struct {
+	XMLName            string               `xml:"tr2:GetOSDOptions"`
+	ConfigurationToken onvif.ReferenceToken `xml:"tr2:ConfigurationToken"`
+}
+
+type GetOSDOptionsResponse struct {
+	OSDOptions OSDOptions
+}
+
+type CreateOSD struct {
+	XMLName string           `xml:"tr2:CreateOSD"`
+	OSD     OSDConfiguration `xml:"tr2:OSD"`
+}
+
+type CreateOSDResponse struct {
+	OSDToken string
+}
+
+type SetOSD struct {
+	XMLName string           `xml:"tr2:SetOSD"`
+	OSD     OSDConfiguration `xml:"tr2:OSD"`
+}
+
+type SetOSDResponse struct {
+}
+
+type DeleteOSD struct {
+	XMLName  string               `xml:"tr2:DeleteOSD"`
+	OSDToken onvif.ReferenceToken `xml:"tr2:OSDToken"`
+}
+
+type DeleteOSDResponse struct {
+}
@@ -0,0 +1,75 @@
+package Recording
+
+//Recording (Profile G) service, manages the recordings on the camera storage
+
+type Capabilities struct {
+	DynamicRecordings          bool   `xml:"DynamicRecordings,attr"`
+	DynamicTracks              bool   `xml:"DynamicTracks,attr"`
+	Encoding                   string `xml:"Encoding,attr"`
+	MaxRate                    int    `xml:"MaxRate,attr"`
+	MaxTotalRate               int    `xml:"MaxTotalRate,attr"`
+	MaxRecordings              int    `xml:"MaxRecordings,attr"`
+	MaxRecordingJobs           int    `xml:"MaxRecordingJobs,attr"`
+	Options                    bool   `xml:"Options,attr"`
+	MetadataRecording          bool   `xml:"MetadataRecording,attr"`
+	SupportedExportFileFormats string `xml:"SupportedExportFileFormats,attr"`
+}
+
+type RecordingSourceInformation struct {
+	SourceId    string
+	Name        string
+	Location    string
+	Description string
+	Address     string
+}
+
+type RecordingConfiguration struct {
+	Source               RecordingSourceInformation
+	Content              string
+	MaximumRetentionTime string
+}
+
+type TrackConfiguration struct {
+	TrackType   string //Video, Audio, Metadata
+	Description string
+}
+
+type GetTracksResponseItem struct {
+	TrackToken    string
+	Configuration TrackConfiguration
+}
+
+type GetRecordingsResponseItem struct {
+	RecordingToken string
+	Configuration  RecordingConfiguration
+	Tracks         struct {
+		Track []GetTracksResponseItem
+	}
+}
+
+//Recording main types
+
+type GetServiceCapabilities struct {
+	XMLName string `xml:"trc:GetServiceCapabilities"`
+}
+
+type GetServiceCapabilitiesResponse struct {
+	Capabilities Capabilities
+}
+
+type GetRecordings struct {
+	XMLName string `xml:"trc:GetRecordings"`
+}
+
+type GetRecordingsResponse struct {
+	RecordingItem []GetRecordingsResponseItem
+}
+
+type GetRecordingConfiguration struct {
+	XMLName        string `xml:"trc:GetRecordingConfiguration"`
+	RecordingToken string `xml:"trc:RecordingToken"`
+}
+
+type GetRecordingConfigurationResponse struct {
+	RecordingConfiguration RecordingConfiguration
+}
@@ -0,0 +1,44 @@
+package Replay
+
+import (
+	"camera/goonvif/xsd/onvif"
+)
+
+//Replay (Profile G) service, plays back the recordings over RTSP
+
+type Capabilities struct {
+	ReversePlayback     bool   `xml:"ReversePlayback,attr"`
+	SessionTimeoutRange string `xml:"SessionTimeoutRange,attr"`
+	RTP_RTSP_TCP        bool   `xml:"RTP_RTSP_TCP,attr"`
+	RTSPWebSocketUri    string `xml:"RTSPWebSocketUri,attr"`
+}
+
+//Replay main types
+
+type GetServiceCapabilities struct {
+	XMLName string `xml:"trp:GetServiceCapabilities"`
+}
+
+type GetServiceCapabilitiesResponse struct {
+	Capabilities Capabilities
+}
+
+type GetReplayUri struct {
+	XMLName        string            `xml:"trp:GetReplayUri"`
+	StreamSetup    onvif.StreamSetup `xml:"trp:StreamSetup"`
+	RecordingToken string            `xml:"trp:RecordingToken"`
+}
+
+type GetReplayUriResponse struct {
+	Uri string
+}
+
+type GetReplayConfiguration struct {
+	XMLName string `xml:"trp:GetReplayConfiguration"`
+}
+
+type GetReplayConfigurationResponse struct {
+	Configuration struct {
+		SessionTimeout string
+	}
+}
@@ -0,0 +1,174 @@
+package Search
+
+//Search (Profile G) service, searches the recordings and the recorded events
+
+type Capabilities struct {
+	MetadataSearch     bool `xml:"MetadataSearch,attr"`
+	GeneralStartEvents bool `xml:"GeneralStartEvents,attr"`
+}
+
+//SearchScope is the request side of tt:SearchScope
+type SearchScope struct {
+	IncludedRecordings         []string `xml:"onvif:IncludedRecordings,omitempty"`
+	RecordingInformationFilter string   `xml:"onvif:RecordingInformationFilter,omitempty"`
+}
+
+//EventFilter is the request side of tt:EventFilter (wsnt:FilterType)
+type EventFilter struct {
+	TopicExpression *TopicExpression `xml:"wsnt:TopicExpression,omitempty"`
+}
+
+type TopicExpression struct {
+	Dialect    string `xml:"Dialect,attr"`
+	Expression string `xml:",chardata"`
+}
+
+type RecordingSourceInformation struct {
+	SourceId    string
+	Name        string
+	Location    string
+	Description string
+	Address     string
+}
+
+type TrackInformation struct {
+	TrackToken  string
+	TrackType   string
+	Description string
+	DataFrom    string
+	DataTo      string
+}
+
+type RecordingInformation struct {
+	RecordingToken    string
+	Source            RecordingSourceInformation
+	EarliestRecording string
+	LatestRecording   string
+	Content           string
+	Track             []TrackInformation
+	RecordingStatus   string //Initiated, Recording, Stopped, Removing, Removed
+}
+
+type RecordingSummary struct {
+	DataFrom         string
+	DataUntil        string
+	NumberRecordings int
+}
+
+type SimpleItem struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+//FindEventResult is a recorded wsnt:NotificationMessage
+type FindEventResult struct {
+	RecordingToken string
+	TrackToken     string
+	Time           string
+	Event          struct {
+		Topic   string
+		Message struct {
+			Message struct {
+				UtcTime           string `xml:"UtcTime,attr"`
+				PropertyOperation string `xml:"PropertyOperation,attr"`
+				Source            struct {
+					SimpleItem []SimpleItem
+				}
+				Data struct {
+					SimpleItem []SimpleItem
+				}
+			}
+		}
+	}
+	StartStateEvent bool
+}
+
+//Search main types
+
+type GetServiceCapabilities struct {
+	XMLName string `xml:"tse:GetServiceCapabilities"`
+}
+
+type GetServiceCapabilitiesResponse struct {
+	Capabilities Capabilities
+}
+
+type GetRecordingSummary struct {
+	XMLName string `xml:"tse:GetRecordingSummary"`
+}
+
+type GetRecordingSummaryResponse struct {
+	Summary RecordingSummary
+}
+
+type GetRecordingInformation struct {
+	XMLName        string `xml:"tse:GetRecordingInformation"`
+	RecordingToken string `xml:"tse:RecordingToken"`
+}
+
+type GetRecordingInformationResponse struct {
+	RecordingInformation RecordingInformation
+}
+
+type FindRecordings struct {
+	XMLName       string      `xml:"tse:FindRecordings"`
+	Scope         SearchScope `xml:"tse:Scope"`
+	MaxMatches    int         `xml:"tse:MaxMatches,omitempty"`
+	KeepAliveTime string      `xml:"tse:KeepAliveTime"`
+}
+
+type FindRecordingsResponse struct {
+	SearchToken string
+}
+
+type GetRecordingSearchResults struct {
+	XMLName     string `xml:"tse:GetRecordingSearchResults"`
+	SearchToken string `xml:"tse:SearchToken"`
+	MaxResults  int    `xml:"tse:MaxResults,omitempty"`
+	WaitTime    string `xml:"tse:WaitTime,omitempty"`
+}
+
+type GetRecordingSearchResultsResponse struct {
+	ResultList struct {
+		SearchState          string //Queued, Searching, Completed, Unknown
+		RecordingInformation []RecordingInformation
+	}
+}
+
+type FindEvents struct {
+	XMLName           string      `xml:"tse:FindEvents"`
+	StartPoint        string      `xml:"tse:StartPoint"`
+	EndPoint          string      `xml:"tse:EndPoint,omitempty"`
+	Scope             SearchScope `xml:"tse:Scope"`
+	SearchFilter      EventFilter `xml:"tse:SearchFilter"`
+	IncludeStartState bool        `xml:"tse:IncludeStartState"`
+	MaxMatches        int         `xml:"tse:MaxMatches,omitempty"`
+	KeepAliveTime     string      `xml:"tse:KeepAliveTime"`
+}
+
+type FindEventsResponse struct {
+	SearchToken string
+}
+
+type GetEventSearchResults struct {
+	XMLName     string `xml:"tse:GetEventSearchResults"`
+	SearchToken string `xml:"tse:SearchToken"`
+	MaxResults  int    `xml:"tse:MaxResults,omitempty"`
+	WaitTime    string `xml:"tse:WaitTime,omitempty"`
+}
+
+type GetEventSearchResultsResponse struct {
+	ResultList struct {
+		SearchState string
+		Result      []FindEventResult
+	}
+}
+
+type EndSearch struct {
+	XMLName     string `xml:"tse:EndSearch"`
+	SearchToken string `xml:"tse:SearchToken"`
+}
+
+type EndSearchResponse struct {
+	Endpoint string
+}
@@ -0,0 +1,76 @@
+package goonvif
+
+import (
+	"camera/goonvif/networking"
+	"camera/gosoap"
+	"net/http"
+	"sync"
+)
+
+//authMode is the authentication a device accepts
+type authMode int
+
+const (
+	authWSSecurity authMode = iota
+	authDigest
+	authBoth
+)
+
+func (mode authMode) String() string {
+	return [...]string{"WS-Security", "Digest", "WS-Security+Digest"}[mode]
+}
+
+//authModes remembers per device address which authentication worked
+var authModes = struct {
+	sync.Mutex
+	modes map[string]authMode
+}{modes: make(map[string]authMode)}
+
+//AuthMode returns the authentication that last worked for the device
+func AuthMode(xaddr string) string {
+	authModes.Lock()
+	defer authModes.Unlock()
+	return authModes.modes[xaddr].String()
+}
+
+//sendAuthorized sends <soap> with the authentication that worked last time,
+//on 401 it tries WS-Security, HTTP Digest and both in turn and remembers the first accepted one
+func (dev device) sendAuthorized(soap gosoap.SoapMessage, send func(message string, digest *networking.DigestAuth) (*http.Response, error)) (*http.Response, error) {
+	authModes.Lock()
+	first := authModes.modes[dev.xaddr]
+	authModes.Unlock()
+
+	modes := []authMode{first}
+	for _, mode := range []authMode{authWSSecurity, authDigest, authBoth} {
+		if mode != first {
+			modes = append(modes, mode)
+		}
+	}
+
+	var resp *http.Response
+	var err error
+	for i, mode := range modes {
+		message := soap
+		var digest *networking.DigestAuth
+		if mode != authDigest {
+			message.AddWSSecurityWithOffset(dev.login, dev.password, dev.timeOffset)
+		}
+		if mode != authWSSecurity {
+			digest = &networking.DigestAuth{Username: dev.login, Password: dev.password}
+		}
+
+		resp, err = send(message.String(), digest)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			if err == nil && mode != first {
+				authModes.Lock()
+				authModes.modes[dev.xaddr] = mode
+				authModes.Unlock()
+			}
+			return resp, err
+		}
+		if i < len(modes)-1 {
+			resp.Body.Close()
+		}
+	}
+	return resp, err
+}
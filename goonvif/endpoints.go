@@ -0,0 +1,49 @@
+package goonvif
+
+import (
+	"sync"
+	"time"
+)
+
+//endpointsTTL is how long the discovered service endpoints of a device are reused
+const endpointsTTL = time.Minute * 10
+
+type discoveredEndpoints struct {
+	endpoints    map[string]string
+	capabilities map[string]string
+	discoveredAt time.Time
+}
+
+//discoveries remembers per device address the endpoints GetServices/GetCapabilities returned,
+//the maps are never modified after discovery so devices can share them
+var discoveries = struct {
+	sync.Mutex
+	devices map[string]discoveredEndpoints
+}{devices: make(map[string]discoveredEndpoints)}
+
+//cachedEndpoints fills the endpoints discovered before, it returns false when they are missing or stale
+func (dev *device) cachedEndpoints() bool {
+	discoveries.Lock()
+	cached, ok := discoveries.devices[dev.xaddr]
+	discoveries.Unlock()
+	if !ok || time.Since(cached.discoveredAt) >= endpointsTTL {
+		return false
+	}
+	dev.endpoints = cached.endpoints
+	dev.capabilities = cached.capabilities
+	return true
+}
+
+//cacheEndpoints remembers the endpoints the device discovered
+func (dev *device) cacheEndpoints() {
+	discoveries.Lock()
+	discoveries.devices[dev.xaddr] = discoveredEndpoints{endpoints: dev.endpoints, capabilities: dev.capabilities, discoveredAt: time.Now()}
+	discoveries.Unlock()
+}
+
+//ResetEndpoints drops the cached endpoints, call it after the camera address or firmware was changed
+func ResetEndpoints(xaddr string) {
+	discoveries.Lock()
+	delete(discoveries.devices, xaddr)
+	discoveries.Unlock()
+}
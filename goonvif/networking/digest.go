@@ -0,0 +1,189 @@
+package networking
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DigestAuth holds the credentials used to answer HTTP Digest challenges
+type DigestAuth struct {
+	Username string
+	Password string
+}
+
+// challenge is the last WWW-Authenticate Digest challenge of a host,
+// it is reused with an increasing nonce count until the camera sends a new one
+type challenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	qop       string
+	algorithm string
+	nc        int
+}
+
+var challenges = struct {
+	sync.Mutex
+	hosts map[string]*challenge
+}{hosts: make(map[string]*challenge)}
+
+func sendDigest(client *http.Client, method, endpoint, contentType string, body []byte, auth *DigestAuth) (*http.Response, error) {
+	newBody := func() io.Reader { return bytes.NewReader(body) }
+	return sendDigestBody(client, method, endpoint, contentType, newBody, int64(len(body)), auth, false)
+}
+
+// sendDigestBody sends the request and answers a Digest challenge, newBody is called for every attempt.
+// With <basic> the first request of a host without a known challenge carries Basic credentials
+func sendDigestBody(client *http.Client, method, endpoint, contentType string, newBody func() io.Reader, length int64, auth *DigestAuth, basic bool) (*http.Response, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	challenges.Lock()
+	c := challenges.hosts[u.Host]
+	challenges.Unlock()
+
+	//the first request of a host has no challenge yet and gets a 401 with one
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(method, endpoint, newBody())
+		if err != nil {
+			return nil, err
+		}
+		if req.ContentLength == 0 && length > 0 {
+			req.ContentLength = length
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if c != nil {
+			req.Header.Set("Authorization", c.authorize(method, u.RequestURI(), auth))
+		} else if basic {
+			req.SetBasicAuth(auth.Username, auth.Password)
+		}
+		resp, err := client.Do(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || i > 0 {
+			return resp, err
+		}
+
+		next, err := parseChallenge(resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return resp, nil
+		}
+		resp.Body.Close()
+		c = next
+		challenges.Lock()
+		challenges.hosts[u.Host] = c
+		challenges.Unlock()
+	}
+	return nil, errors.New("digest authentication failed")
+}
+
+// parseChallenge parses `Digest realm="...", nonce="...", qop="auth", opaque="...", algorithm=MD5`
+func parseChallenge(header string) (*challenge, error) {
+	if !strings.HasPrefix(strings.ToLower(header), "digest ") {
+		return nil, errors.New("not a digest challenge")
+	}
+	c := &challenge{algorithm: "MD5"}
+	for _, param := range splitParams(header[len("digest "):]) {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "realm":
+			c.realm = value
+		case "nonce":
+			c.nonce = value
+		case "opaque":
+			c.opaque = value
+		case "algorithm":
+			c.algorithm = value
+		case "qop":
+			//prefer auth, auth-int needs the hash of the body and is rarely the only option
+			for _, qop := range strings.Split(value, ",") {
+				if strings.TrimSpace(qop) == "auth" {
+					c.qop = "auth"
+				}
+			}
+		}
+	}
+	if c.nonce == "" {
+		return nil, errors.New("digest challenge without nonce")
+	}
+	return c, nil
+}
+
+// splitParams splits the challenge on commas outside quotes
+func splitParams(s string) []string {
+	var params []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			params = append(params, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(params, s[start:])
+}
+
+func (c *challenge) hash(s string) string {
+	var h hash.Hash
+	if strings.HasPrefix(strings.ToUpper(c.algorithm), "SHA-256") {
+		h = sha256.New()
+	} else {
+		h = md5.New()
+	}
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *challenge) authorize(method, uri string, auth *DigestAuth) string {
+	challenges.Lock()
+	c.nc++
+	nc := fmt.Sprintf("%08x", c.nc)
+	challenges.Unlock()
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	cnonce := hex.EncodeToString(b)
+
+	ha1 := c.hash(auth.Username + ":" + c.realm + ":" + auth.Password)
+	if strings.HasSuffix(strings.ToLower(c.algorithm), "-sess") {
+		ha1 = c.hash(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := c.hash(method + ":" + uri)
+
+	var response string
+	if c.qop == "" {
+		response = c.hash(ha1 + ":" + c.nonce + ":" + ha2)
+	} else {
+		response = c.hash(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	}
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, response="%s"`,
+		auth.Username, c.realm, c.nonce, uri, c.algorithm, response)
+	if c.qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, c.qop, nc, cnonce)
+	}
+	if c.opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, c.opaque)
+	}
+	return header
+}
@@ -0,0 +1,107 @@
+package networking
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseChallenge(t *testing.T) {
+	c, err := parseChallenge(`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.realm != "testrealm@host.com" || c.nonce != "dcd98b7102dd2f0e8b11d0f600bfb0c093" || c.opaque != "5ccc069c403ebaf9f0171e9517f40e41" {
+		t.Errorf("unexpected challenge %+v", c)
+	}
+	if c.qop != "auth" {
+		t.Errorf("qop = %q, want auth", c.qop)
+	}
+	if c.algorithm != "MD5" {
+		t.Errorf("algorithm = %q, want MD5 by default", c.algorithm)
+	}
+}
+
+func TestParseChallengeQuotedComma(t *testing.T) {
+	c, err := parseChallenge(`Digest realm="IP Camera, Main", nonce="abc", algorithm=SHA-256`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.realm != "IP Camera, Main" {
+		t.Errorf("realm = %q", c.realm)
+	}
+	if c.algorithm != "SHA-256" {
+		t.Errorf("algorithm = %q", c.algorithm)
+	}
+	if c.qop != "" {
+		t.Errorf("qop = %q, want empty", c.qop)
+	}
+}
+
+func TestParseChallengeInvalid(t *testing.T) {
+	for _, header := range []string{"", `Basic realm="camera"`, `Digest realm="camera"`} {
+		if _, err := parseChallenge(header); err == nil {
+			t.Errorf("parseChallenge(%q) should fail", header)
+		}
+	}
+}
+
+// params parses the Authorization header the same way as a challenge
+func params(header string) map[string]string {
+	res := make(map[string]string)
+	for _, param := range splitParams(strings.TrimPrefix(header, "Digest ")) {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 {
+			res[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+	}
+	return res
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestAuthorize(t *testing.T) {
+	//RFC 2617 example
+	c := &challenge{realm: "testrealm@host.com", nonce: "dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque: "5ccc069c403ebaf9f0171e9517f40e41", qop: "auth", algorithm: "MD5"}
+	auth := &DigestAuth{Username: "Mufasa", Password: "Circle Of Life"}
+
+	p := params(c.authorize("GET", "/dir/index.html", auth))
+	if p["nc"] != "00000001" {
+		t.Errorf("nc = %q, want 00000001", p["nc"])
+	}
+	if p["opaque"] != c.opaque || p["uri"] != "/dir/index.html" || p["username"] != "Mufasa" {
+		t.Errorf("unexpected header %v", p)
+	}
+	ha1 := md5Hex("Mufasa:testrealm@host.com:Circle Of Life")
+	ha2 := md5Hex("GET:/dir/index.html")
+	want := md5Hex(ha1 + ":" + c.nonce + ":" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+	if p["response"] != want {
+		t.Errorf("response = %q, want %q", p["response"], want)
+	}
+}
+
+func TestAuthorizeNonceCount(t *testing.T) {
+	c := &challenge{realm: "camera", nonce: "abc", qop: "auth", algorithm: "MD5"}
+	auth := &DigestAuth{Username: "admin", Password: "admin"}
+	for _, want := range []string{"00000001", "00000002", "00000003"} {
+		if nc := params(c.authorize("POST", "/onvif/device_service", auth))["nc"]; nc != want {
+			t.Errorf("nc = %q, want %q", nc, want)
+		}
+	}
+}
+
+func TestAuthorizeWithoutQop(t *testing.T) {
+	c := &challenge{realm: "camera", nonce: "abc", algorithm: "MD5"}
+	p := params(c.authorize("POST", "/onvif/device_service", &DigestAuth{Username: "admin", Password: "admin"}))
+	if _, ok := p["nc"]; ok {
+		t.Error("nc should only be sent with qop")
+	}
+	want := md5Hex(md5Hex("admin:camera:admin") + ":abc:" + md5Hex("POST:/onvif/device_service"))
+	if p["response"] != want {
+		t.Errorf("response = %q, want %q", p["response"], want)
+	}
+}
@@ -3,15 +3,118 @@ package networking
 import (
 	"net/http"
 	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sync"
+	"time"
 )
 
 func SendSoap(endpoint, message string) (*http.Response, error) {
-	httpClient := new(http.Client)
+	return SendSoapWithDigest(endpoint, message, nil)
+}
+
+//SendSoapWithDigest sends the soap message and answers HTTP Digest challenges with <auth>,
+//nil <auth> sends the message without transport authentication
+func SendSoapWithDigest(endpoint, message string, auth *DigestAuth) (*http.Response, error) {
+	return send(endpoint, "application/soap+xml; charset=utf-8", []byte(message), auth)
+}
+
+//SendSoapWithAttachment sends the soap message as a MTOM/XOP package,
+//the attachment is referenced from the message by cid:<contentID>
+func SendSoapWithAttachment(endpoint, message, contentID, contentType string, attachment []byte, auth *DigestAuth) (*http.Response, error) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
 
-	resp, err := httpClient.Post(endpoint, "application/soap+xml; charset=utf-8", bytes.NewBufferString(message))
+	rootHeader := textproto.MIMEHeader{}
+	rootHeader.Set("Content-Type", `application/xop+xml; charset=UTF-8; type="application/soap+xml"`)
+	rootHeader.Set("Content-Transfer-Encoding", "8bit")
+	rootHeader.Set("Content-ID", "<root>")
+	part, err := writer.CreatePart(rootHeader)
 	if err != nil {
-		return resp, err
+		return nil, err
+	}
+	part.Write([]byte(message))
+
+	attachmentHeader := textproto.MIMEHeader{}
+	attachmentHeader.Set("Content-Type", contentType)
+	attachmentHeader.Set("Content-Transfer-Encoding", "binary")
+	attachmentHeader.Set("Content-ID", "<"+contentID+">")
+	part, err = writer.CreatePart(attachmentHeader)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(attachment)
+	writer.Close()
+
+	contentTypeHeader := fmt.Sprintf(`multipart/related; type="application/xop+xml"; start="<root>"; start-info="application/soap+xml"; boundary=%s`, writer.Boundary())
+	return send(endpoint, contentTypeHeader, body.Bytes(), auth)
+}
+
+//transports holds the transport of https devices with their own TLS configuration, keyed by host:port
+var transports = struct {
+	sync.RWMutex
+	hosts map[string]*http.Transport
+}{hosts: make(map[string]*http.Transport)}
+
+//SetTLSConfig sets the TLS configuration (CA, pinned certificate) used for the https device at <host>
+func SetTLSConfig(host string, config *tls.Config) {
+	transports.Lock()
+	transports.hosts[host] = &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: config}
+	transports.Unlock()
+}
+
+//ShareTLSConfig uses the TLS configuration of <host> for <other> too,
+//devices may list service addresses on another host or port than their device service
+func ShareTLSConfig(host, other string) {
+	transports.Lock()
+	if transport, ok := transports.hosts[host]; ok {
+		if _, set := transports.hosts[other]; !set {
+			transports.hosts[other] = transport
+		}
+	}
+	transports.Unlock()
+}
+
+//NewClient returns a http client for <endpoint>, https endpoints use the TLS configuration of their host
+func NewClient(endpoint string) *http.Client {
+	httpClient := new(http.Client)
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" {
+		return httpClient
 	}
+	transports.RLock()
+	transport, ok := transports.hosts[u.Host]
+	transports.RUnlock()
+	if ok {
+		httpClient.Transport = transport
+	}
+	return httpClient
+}
+
+func send(endpoint, contentType string, body []byte, auth *DigestAuth) (*http.Response, error) {
+	httpClient := NewClient(endpoint)
+	if auth == nil {
+		return httpClient.Post(endpoint, contentType, bytes.NewReader(body))
+	}
+	return sendDigest(httpClient, http.MethodPost, endpoint, contentType, body, auth)
+}
+
+//Get sends a GET request to a camera http api (e.g. vendor specific status), answering Digest challenges with <auth>
+func Get(endpoint string, auth *DigestAuth) (*http.Response, error) {
+	httpClient := NewClient(endpoint)
+	httpClient.Timeout = time.Second * 10
+	return sendDigest(httpClient, http.MethodGet, endpoint, "", nil, auth)
+}
 
-	return resp,nil
-}
\ No newline at end of file
+//Upload posts a file to a camera upload address (e.g. the UploadUri of StartFirmwareUpgrade),
+//the first request carries Basic credentials and a Digest challenge is answered with <auth>.
+//newBody is called for every attempt, the file is sent again after a challenge
+func Upload(endpoint, contentType string, length int64, newBody func() io.Reader, auth *DigestAuth, timeout time.Duration) (*http.Response, error) {
+	httpClient := NewClient(endpoint)
+	httpClient.Timeout = timeout
+	return sendDigestBody(httpClient, http.MethodPost, endpoint, contentType, newBody, length, auth, true)
+}
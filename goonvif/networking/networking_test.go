@@ -0,0 +1,49 @@
+package networking
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadDigest(t *testing.T) {
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Digest realm="camera", nonce="abc", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if string(body) != "firmware" {
+			t.Errorf("body = %q", body)
+		}
+	}))
+	defer server.Close()
+
+	attempts := 0
+	newBody := func() io.Reader {
+		attempts++
+		return bytes.NewReader([]byte("firmware"))
+	}
+	resp, err := Upload(server.URL+"/upload", "application/octet-stream", 8, newBody, &DigestAuth{Username: "admin", Password: "admin"}, time.Second*5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %s", resp.Status)
+	}
+	if attempts != 2 || len(authorizations) != 2 {
+		t.Fatalf("attempts = %d, want 2", attempts)
+	}
+	if !strings.HasPrefix(authorizations[0], "Basic ") {
+		t.Errorf("first request authorization = %q, want Basic", authorizations[0])
+	}
+}
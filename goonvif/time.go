@@ -0,0 +1,100 @@
+package goonvif
+
+import (
+	"camera/goonvif/Device"
+	"camera/gosoap"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//timeOffsetTTL is how long a measured camera clock offset is reused
+const timeOffsetTTL = time.Minute
+
+type timeOffset struct {
+	offset     time.Duration
+	measuredAt time.Time
+}
+
+var timeOffsets = struct {
+	sync.Mutex
+	offsets map[string]timeOffset
+}{offsets: make(map[string]timeOffset)}
+
+//MeasureTimeOffset calls GetSystemDateAndTime without authentication and returns
+//the camera clock minus gateway clock, compensated by half of the round trip,
+//and the camera DateTimeType (NTP or Manual)
+func MeasureTimeOffset(xaddr string) (offset, roundTrip time.Duration, cameraTime time.Time, dateTimeType string, err error) {
+	dev := new(device)
+	dev.xaddr = xaddr
+	dev.endpoints = map[string]string{"Device": deviceServiceURL(xaddr)}
+
+	sent := time.Now()
+	resp, err := dev.callNonAuthorizedMethod(dev.endpoints["Device"], Device.GetSystemDateAndTime{})
+	if err != nil {
+		return 0, 0, cameraTime, "", err
+	}
+	defer resp.Body.Close()
+	received := time.Now()
+	//Digest only cameras answer 401 with an html page
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, cameraTime, "", errors.New("GetSystemDateAndTime: " + resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, 0, cameraTime, "", err
+	}
+	body, err := gosoap.SoapMessage(string(b)).Body()
+	if err != nil {
+		return 0, 0, cameraTime, "", err
+	}
+	res := Device.GetSystemDateAndTimeResponse{}
+	if err = xml.Unmarshal([]byte(body), &res); err != nil {
+		return 0, 0, cameraTime, "", err
+	}
+	dt := res.SystemDateAndTime.UTCDateTime
+	if dt.Date.Year == 0 {
+		return 0, 0, cameraTime, "", errors.New("camera returned no UTC time")
+	}
+	cameraTime = time.Date(dt.Date.Year, time.Month(dt.Date.Month), dt.Date.Day,
+		dt.Time.Hour, dt.Time.Minute, dt.Time.Second, 0, time.UTC)
+
+	//the camera only returns seconds, take the middle of that second
+	roundTrip = received.Sub(sent)
+	offset = cameraTime.Add(time.Millisecond * 500).Sub(sent.Add(roundTrip / 2))
+
+	timeOffsets.Lock()
+	timeOffsets.offsets[xaddr] = timeOffset{offset: offset, measuredAt: received}
+	timeOffsets.Unlock()
+	return offset, roundTrip, cameraTime, string(res.SystemDateAndTime.DateTimeType), nil
+}
+
+//ResetTimeOffset drops the cached offset, call it after the camera clock was changed
+func ResetTimeOffset(xaddr string) {
+	timeOffsets.Lock()
+	delete(timeOffsets.offsets, xaddr)
+	timeOffsets.Unlock()
+}
+
+//cameraTimeOffset returns the cached offset or measures it again when it is stale,
+//a failed measurement is cached as zero offset for timeOffsetTTL
+func cameraTimeOffset(xaddr string) time.Duration {
+	timeOffsets.Lock()
+	cached, ok := timeOffsets.offsets[xaddr]
+	timeOffsets.Unlock()
+	if ok && time.Since(cached.measuredAt) < timeOffsetTTL {
+		return cached.offset
+	}
+	offset, _, _, _, err := MeasureTimeOffset(xaddr)
+	if err != nil {
+		//cache the failure too, so an unreachable camera is not asked twice per call
+		timeOffsets.Lock()
+		timeOffsets.offsets[xaddr] = timeOffset{measuredAt: time.Now()}
+		timeOffsets.Unlock()
+		return 0
+	}
+	return offset
+}
@@ -0,0 +1,33 @@
+package goonvif
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMeasureTimeOffsetUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("<html><body>401 Unauthorized</body></html>"))
+	}))
+	defer server.Close()
+
+	if _, _, _, _, err := MeasureTimeOffset(server.URL); err == nil {
+		t.Error("MeasureTimeOffset should fail on 401")
+	}
+	if offset := cameraTimeOffset(server.URL); offset != 0 {
+		t.Errorf("cameraTimeOffset = %v, want 0", offset)
+	}
+}
+
+func TestMeasureTimeOffsetNotSOAP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>camera</body></html>"))
+	}))
+	defer server.Close()
+
+	if _, _, _, _, err := MeasureTimeOffset(server.URL); err == nil {
+		t.Error("MeasureTimeOffset should fail on a non SOAP reply")
+	}
+}
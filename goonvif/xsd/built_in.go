@@ -201,6 +201,20 @@ func (tp Duration) NewDateTime(years, months, days, hours, minutes, seconds stri
 	return Duration(i.ISO8601Duration())
 }
 
+/*
+	Construct an instance of xsd duration type from time.Duration
+*/
+func NewDuration(d time.Duration) Duration {
+	return Duration(iso8601.FormatDuration(d))
+}
+
+/*
+	Convert to time.Duration, years and months are not supported
+*/
+func (tp Duration) TimeDuration() (time.Duration, error) {
+	return iso8601.ParseDuration(string(tp))
+}
+
 /*
 	DateTime values may be viewed as objects with integer-valued year, month, day, hour
 	and minute properties, a decimal-valued second property, and a boolean timezoned property.
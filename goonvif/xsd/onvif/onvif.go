@@ -462,8 +462,8 @@ type MulticastConfiguration struct {
 
 type IPAddress struct {
 	Type        IPType      `xml:"onvif:Type"`
-	IPv4Address IPv4Address `xml:"onvif:IPv4Address"`
-	IPv6Address IPv6Address `xml:"onvif:IPv6Address"`
+	IPv4Address IPv4Address `xml:"onvif:IPv4Address,omitempty"`
+	IPv6Address IPv6Address `xml:"onvif:IPv6Address,omitempty"`
 }
 
 type IPType xsd.String
@@ -503,18 +503,20 @@ type Config struct {
 }
 
 type ItemList struct {
-	SimpleItem  SimpleItem        `xml:"onvif:SimpleItem"`
-	ElementItem ElementItem       `xml:"onvif:ElementItem"`
-	Extension   ItemListExtension `xml:"onvif:Extension"`
+	SimpleItem  []SimpleItem      `xml:"onvif:SimpleItem"`
+	ElementItem []ElementItem     `xml:"onvif:ElementItem"`
+	Extension   ItemListExtension `xml:"onvif:Extension,omitempty"`
 }
 
 type SimpleItem struct {
-	Name  string            `xml:"onvif:Name,attr"`
-	Value xsd.AnySimpleType `xml:"onvif:Value,attr"`
+	Name  string            `xml:"Name,attr"`
+	Value xsd.AnySimpleType `xml:"Value,attr"`
 }
 
+//ElementItem content (tt:Polygon, tt:Polyline ...) is kept as raw xml
 type ElementItem struct {
-	Name string `xml:"Name,attr"`
+	Name    string `xml:"Name,attr"`
+	Content string `xml:",innerxml"`
 }
 
 type ItemListExtension xsd.AnyType
@@ -1184,10 +1186,10 @@ type DiscoveryMode xsd.String
 
 type NetworkHost struct {
 	Type        NetworkHostType      `xml:"onvif:Type"`
-	IPv4Address IPv4Address          `xml:"onvif:IPv4Address"`
-	IPv6Address IPv6Address          `xml:"onvif:IPv6Address"`
-	DNSname     DNSName              `xml:"onvif:DNSname"`
-	Extension   NetworkHostExtension `xml:"onvif:Extension"`
+	IPv4Address IPv4Address          `xml:"onvif:IPv4Address,omitempty"`
+	IPv6Address IPv6Address          `xml:"onvif:IPv6Address,omitempty"`
+	DNSname     DNSName              `xml:"onvif:DNSname,omitempty"`
+	Extension   NetworkHostExtension `xml:"onvif:Extension,omitempty"`
 }
 
 type NetworkHostType xsd.String
@@ -1202,9 +1204,9 @@ type RemoteUser struct {
 
 type User struct {
 	Username  string        `xml:"onvif:Username"`
-	Password  string        `xml:"onvif:Password"`
+	Password  string        `xml:"onvif:Password,omitempty"`
 	UserLevel UserLevel     `xml:"onvif:UserLevel"`
-	Extension UserExtension `xml:"onvif:Extension"`
+	Extension UserExtension `xml:"onvif:Extension,omitempty"`
 }
 
 type UserLevel xsd.String
@@ -1620,7 +1622,7 @@ type NetworkProtocol struct {
 	Name      NetworkProtocolType      `xml:"onvif:Name"`
 	Enabled   xsd.Boolean              `xml:"onvif:Enabled"`
 	Port      xsd.Int                  `xml:"onvif:Port"`
-	Extension NetworkProtocolExtension `xml:"onvif:Extension"`
+	Extension NetworkProtocolExtension `xml:"onvif:Extension,omitempty"`
 }
 
 type NetworkProtocolExtension xsd.AnyType
@@ -1649,8 +1651,8 @@ type NetworkZeroConfigurationExtension2 xsd.AnyType
 
 type IPAddressFilter struct {
 	Type        IPAddressFilterType      `xml:"onvif:Type"`
-	IPv4Address PrefixedIPv4Address      `xml:"onvif:IPv4Address,omitempty"`
-	IPv6Address PrefixedIPv6Address      `xml:"onvif:IPv6Address,omitempty"`
+	IPv4Address []PrefixedIPv4Address    `xml:"onvif:IPv4Address,omitempty"`
+	IPv6Address []PrefixedIPv6Address    `xml:"onvif:IPv6Address,omitempty"`
 	Extension   IPAddressFilterExtension `xml:"onvif:Extension,omitempty"`
 }
 
@@ -1662,7 +1664,7 @@ type IPAddressFilterType xsd.String
 
 //TODO: attribite <xs:attribute ref="xmime:contentType" use="optional"/>
 type BinaryData struct {
-	X    ContentType      `xml:"xmime:contentType,attr"`
+	X    ContentType      `xml:"xmime:contentType,attr,omitempty"`
 	Data xsd.Base64Binary `xml:"onvif:Data"`
 }
 
@@ -1,9 +1,11 @@
 package gosoap
 
 import (
+	"errors"
 	"github.com/beevik/etree"
 	"log"
 	"encoding/xml"
+	"time"
 )
 
 type SoapMessage string
@@ -44,20 +46,26 @@ func (msg SoapMessage) StringIndent() string {
 	return res
 }
 
-func (msg SoapMessage) Body() string {
+//Body returns the first element of the SOAP Body,
+//it fails when the message is not a SOAP envelope (e.g. an html error page)
+func (msg SoapMessage) Body() (string, error) {
 
 	doc := etree.NewDocument()
 
 	if err := doc.ReadFromString(msg.String()); err != nil {
-		log.Println(err.Error())
+		return "", err
+	}
+	if doc.Root() == nil || doc.Root().Tag != "Envelope" {
+		return "", errors.New("not a SOAP envelope")
 	}
-	bodyTag := doc.Root().SelectElement("Body").ChildElements()[0]
-	doc.SetRoot(bodyTag)
+	body := doc.Root().SelectElement("Body")
+	if body == nil || len(body.ChildElements()) == 0 {
+		return "", errors.New("SOAP envelope has no body content")
+	}
+	doc.SetRoot(body.ChildElements()[0])
 	doc.IndentTabs()
 
-	res, _ := doc.WriteToString()
-
-	return res
+	return doc.WriteToString()
 }
 
 func (msg *SoapMessage) AddStringBodyContent(data string)  {
@@ -232,6 +240,11 @@ func buildSoapRoot() *etree.Document {
 }
 
 func (msg *SoapMessage) AddWSSecurity(username, password string) {
+	msg.AddWSSecurityWithOffset(username, password, 0)
+}
+
+//AddWSSecurityWithOffset adds WS-Security header with Created shifted by the camera clock offset
+func (msg *SoapMessage) AddWSSecurityWithOffset(username, password string, offset time.Duration) {
 	//doc := etree.NewDocument()
 	//if err := doc.ReadFromString(msg.String()); err != nil {
 	//	log.Println(err.Error())
@@ -240,7 +253,7 @@ func (msg *SoapMessage) AddWSSecurity(username, password string) {
 	/*
 	Getting an WS-Security struct representation
 	 */
-	auth := NewSecurity(username, password)
+	auth := NewSecurityWithOffset(username, password, offset)
 
 	/*
 	Adding WS-Security namespaces to root element of SOAP message
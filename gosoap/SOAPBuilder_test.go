@@ -0,0 +1,31 @@
+package gosoap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBody(t *testing.T) {
+	msg := SoapMessage(`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><tds:GetSystemDateAndTimeResponse xmlns:tds="http://www.onvif.org/ver10/device/wsdl"/></env:Body></env:Envelope>`)
+	body, err := msg.Body()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body, "GetSystemDateAndTimeResponse") {
+		t.Errorf("body = %s", body)
+	}
+}
+
+func TestBodyInvalid(t *testing.T) {
+	for _, msg := range []string{
+		"",
+		"401 Unauthorized",
+		"<html><body>401 Unauthorized</body></html>",
+		`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"/>`,
+		`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body/></env:Envelope>`,
+	} {
+		if body, err := SoapMessage(msg).Body(); err == nil {
+			t.Errorf("Body(%q) = %q, want error", msg, body)
+		}
+	}
+}
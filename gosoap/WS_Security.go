@@ -53,23 +53,30 @@ type wsAuth struct {
  */
 
 func NewSecurity(username, passwd string) security {
+	return NewSecurityWithOffset(username, passwd, 0)
+}
+
+//NewSecurityWithOffset stamps Created with the camera clock (gateway time + offset),
+//cameras reject tokens whose Created is too far from their own clock
+func NewSecurityWithOffset(username, passwd string, offset time.Duration) security {
 	/** Generating Nonce sequence **/
 	charsToGenerate := 32
 	charSet := gostrgen.Lower | gostrgen.Digit
 
 	nonceSeq, _ := gostrgen.RandGen(charsToGenerate, charSet, "", "")
+	created := time.Now().Add(offset).UTC()
 	auth := security{
 		Auth:wsAuth{
 			Username:username,
 			Password:password {
 				Type:passwordType,
-				Password:generateToken(username, nonceSeq, time.Now().UTC(), passwd),
+				Password:generateToken(username, nonceSeq, created, passwd),
 			},
 			Nonce:nonce {
 				Type:encodingType,
 				Nonce: nonceSeq,
 			},
-			Created: time.Now().UTC().Format(time.RFC3339Nano),
+			Created: created.Format(time.RFC3339Nano),
 		},
 	}
 
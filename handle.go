@@ -5,25 +5,13 @@ import (
 )
 
 const (
-	keyPrefix = "hub:digital:%d:%d:%s"
+	keyPrefix = "hub:digital:%d:%d:%s" // 设备影子，tid:pid:did
 )
 
 func setMQTT(key string, value interface{}) error {
 	reported := make(map[string]interface{})
-	reported[key]=value
-	state := &State{Reported: reported}
-	twins := RequestTwins{Method: Update, State: state, Version: 1}
-	//fmt.Printf("%+v",twins)
-	jsonText, err := twins.MarshalJSONText()
-	if err != nil{
-		return err
-	}
-	err = pubSub.publish(pubSub.rxTopic, jsonText)
-	if err != nil{
-		return err
-	}
-
-	return nil
+	reported[key] = value
+	return publishReported(reported)
 }
 
 func handleSetSystemDateAndTime(time interface{}) error {
@@ -41,3 +29,137 @@ func HandleInterval(state interface{}) error {
 	logrus.Println("state:  ", state)
 	return setMQTT(CameraStatus, state)
 }
+
+func handleGetSupportedAnalyticsRules(rules interface{}) error {
+	return setMQTT(SupportedAnalyticsRules, rules)
+}
+
+func handleGetAnalyticsRules(rules interface{}) error {
+	return setMQTT(AnalyticsRules, rules)
+}
+
+func handleGetSupportedAnalyticsModules(modules interface{}) error {
+	return setMQTT(SupportedAnalyticsModules, modules)
+}
+
+func handleGetAnalyticsModules(modules interface{}) error {
+	return setMQTT(AnalyticsModules, modules)
+}
+
+func handleGetAnalyticsModuleOptions(options interface{}) error {
+	return setMQTT(AnalyticsModuleOptions, options)
+}
+
+func handleGetRelayOutputs(relays interface{}) error {
+	return setMQTT(RelayOutputs, relays)
+}
+
+func handlePendingConfirmation(pending interface{}) error {
+	return setMQTT(PendingConfirmation, pending)
+}
+
+func handleRebootRecovery(recovery interface{}) error {
+	return setMQTT(RebootRecoveryData, recovery)
+}
+
+func handleFirmwareUpgrade(status interface{}) error {
+	return setMQTT(FirmwareUpgrade, status)
+}
+
+func handleGetInventory(inventory interface{}) error {
+	return setMQTT(InventoryData, inventory)
+}
+
+func handleGetUsers(users interface{}) error {
+	return setMQTT(Users, users)
+}
+
+func handleGetNTP(ntp interface{}) error {
+	return setMQTT(NTP, ntp)
+}
+
+func handleClockDrift(drift interface{}) error {
+	return setMQTT(ClockDriftData, drift)
+}
+
+func handleGetStreamUri(stream interface{}) error {
+	return setMQTT(StreamUri, stream)
+}
+
+func handleGetVideoEncoders(encoders interface{}) error {
+	return setMQTT(VideoEncoders, encoders)
+}
+
+func handleGetVideoEncoderOptions(options interface{}) error {
+	return setMQTT(VideoEncoderOptions, options)
+}
+
+func handleGetOSDs(osds interface{}) error {
+	return setMQTT(OSDs, osds)
+}
+
+func handleGetPrivacyMasks(masks interface{}) error {
+	return setMQTT(PrivacyMasks, masks)
+}
+
+func handleGetImagingSettings(settings interface{}) error {
+	return setMQTT(ImagingSettings, settings)
+}
+
+func handleGetRecordings(recordings interface{}) error {
+	return setMQTT(Recordings, recordings)
+}
+
+func handleSearchRecordings(result interface{}) error {
+	return setMQTT(RecordingSearch, result)
+}
+
+func handleGetReplayUri(replay interface{}) error {
+	return setMQTT(ReplayUri, replay)
+}
+
+func handleGetStorage(storage interface{}) error {
+	return setMQTT(Storage, storage)
+}
+
+func handleGetNetwork(network interface{}) error {
+	return setMQTT(Network, network)
+}
+
+func handleGetIPAddressFilter(filter interface{}) error {
+	return setMQTT(IPAddressFilter, filter)
+}
+
+func handleGetCertificates(info interface{}) error {
+	return setMQTT(Certificates, info)
+}
+
+func handleCreateCertificateRequest(req interface{}) error {
+	return setMQTT(CertificateSigningRequest, req)
+}
+
+func handleGetSystemLog(file interface{}) error {
+	return setMQTT(SystemLog, file)
+}
+
+func handleGetSystemSupportInformation(file interface{}) error {
+	return setMQTT(SupportInformation, file)
+}
+
+func handleGetSystemBackups(backups interface{}) error {
+	return setMQTT(SystemBackups, backups)
+}
+
+// 实际配置上报到CameraConfig，和desired中的期望配置对应
+func handleConfigState(state interface{}) error {
+	reported := make(map[string]interface{})
+	reported[ConfigStateData] = state
+	if s, ok := state.(*ConfigState); ok {
+		reported[CameraConfig] = s.Reported
+	}
+	return publishReported(reported)
+}
+
+func handleCommandResult(result interface{}) error {
+	return setMQTT(CommandResult, result)
+}
@@ -0,0 +1,117 @@
+package camera
+
+import (
+	"camera/goonvif/Imaging"
+	"camera/goonvif/Media"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"github.com/pkg/errors"
+)
+
+// 图像参数，下发时只修改设置的值，ir_cut_filter为ON/OFF/AUTO
+type ImagingConfig struct {
+	VideoSourceToken string   `json:"video_source_token,omitempty"`
+	Brightness       *float64 `json:"brightness,omitempty"`
+	ColorSaturation  *float64 `json:"color_saturation,omitempty"`
+	Contrast         *float64 `json:"contrast,omitempty"`
+	Sharpness        *float64 `json:"sharpness,omitempty"`
+	IrCutFilter      string   `json:"ir_cut_filter,omitempty"`
+}
+
+// 获取图像参数，value为视频源token，为空时使用当前Profile的视频源
+func DeviceGetImagingSettings(value interface{}) error {
+	token, _ := value.(string)
+	camera := newCamera()
+	settings, err := getImagingSettings(camera, token)
+	if err != nil {
+		return err
+	}
+	go handleResponse(settings, handleGetImagingSettings)
+	return nil
+}
+
+func getImagingSettings(camera *ptz.Camera, token string) (*ImagingConfig, error) {
+	sourceToken, err := videoSourceToken(camera, token)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := camera.Imaging_GetImagingSettings(sourceToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetImagingSettings err")
+	}
+	res := Imaging.GetImagingSettingsResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, errors.Wrap(err, "GetImagingSettings err")
+	}
+	s := res.ImagingSettings
+	return &ImagingConfig{
+		VideoSourceToken: string(sourceToken),
+		Brightness:       s.Brightness,
+		ColorSaturation:  s.ColorSaturation,
+		Contrast:         s.Contrast,
+		Sharpness:        s.Sharpness,
+		IrCutFilter:      s.IrCutFilter,
+	}, nil
+}
+
+// 设置图像参数，value为{"brightness":50,"contrast":50,"ir_cut_filter":"AUTO"}
+func DeviceSetImagingSettings(value interface{}) error {
+	settings := ImagingConfig{}
+	if err := decodeDesired(value, &settings); err != nil {
+		return errors.Wrap(err, "decode imaging settings err")
+	}
+	camera := newCamera()
+	if err := setImagingSettings(camera, settings); err != nil {
+		return err
+	}
+	return DeviceGetImagingSettings(settings.VideoSourceToken)
+}
+
+func setImagingSettings(camera *ptz.Camera, settings ImagingConfig) error {
+	sourceToken, err := videoSourceToken(camera, settings.VideoSourceToken)
+	if err != nil {
+		return err
+	}
+	resp, err := camera.Imaging_SetImagingSettings(sourceToken, Imaging.ImagingSettingsData{
+		Brightness:      settings.Brightness,
+		ColorSaturation: settings.ColorSaturation,
+		Contrast:        settings.Contrast,
+		IrCutFilter:     settings.IrCutFilter,
+		Sharpness:       settings.Sharpness,
+	})
+	if err != nil {
+		return errors.Wrap(err, "SetImagingSettings err")
+	}
+	if err = ptz.ParseResponse(resp, &Imaging.SetImagingSettingsResponse{}); err != nil {
+		return errors.Wrap(err, "SetImagingSettings err")
+	}
+	return nil
+}
+
+// 获取视频源token，未指定时使用当前Profile的视频源，不支持Media2时使用Media的第一个视频源
+func videoSourceToken(camera *ptz.Camera, token string) (onvif.ReferenceToken, error) {
+	if token != "" {
+		return onvif.ReferenceToken(token), nil
+	}
+	if camera.SupportsMedia2() {
+		profile, err := media2Profile(camera)
+		if err != nil {
+			return "", err
+		}
+		if profile.Configurations.VideoSource.SourceToken != "" {
+			return onvif.ReferenceToken(profile.Configurations.VideoSource.SourceToken), nil
+		}
+	}
+	resp, err := camera.Media_GetVideoSources()
+	if err != nil {
+		return "", errors.Wrap(err, "GetVideoSources err")
+	}
+	res := Media.GetVideoSourcesResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return "", errors.Wrap(err, "GetVideoSources err")
+	}
+	if res.VideoSources.Token == "" {
+		return "", errors.New("camera has no video source")
+	}
+	return res.VideoSources.Token, nil
+}
@@ -0,0 +1,127 @@
+package camera
+
+import (
+	"camera/goonvif"
+	"camera/goonvif/Device"
+	"camera/ptz"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// 摄像头资产信息
+type Inventory struct {
+	Manufacturer    string                `json:"manufacturer"`
+	Model           string                `json:"model"`
+	FirmwareVersion string                `json:"firmware_version"`
+	SerialNumber    string                `json:"serial_number"`
+	HardwareId      string                `json:"hardware_id"`
+	Services        []InventoryService    `json:"services"`
+	Capabilities    InventoryCapabilities `json:"capabilities"`
+	AuthMode        string                `json:"auth_mode"`
+	CollectedAt     int64                 `json:"collected_at"`
+}
+
+// 摄像头支持的服务
+type InventoryService struct {
+	Namespace string `json:"namespace"`
+	XAddr     string `json:"xaddr"`
+	Version   string `json:"version"`
+}
+
+// 摄像头能力摘要
+type InventoryCapabilities struct {
+	Analytics       bool   `json:"analytics"`
+	Events          bool   `json:"events"`
+	Imaging         bool   `json:"imaging"`
+	Media           bool   `json:"media"`
+	PTZ             bool   `json:"ptz"`
+	InputConnectors int    `json:"input_connectors"`
+	RelayOutputs    int    `json:"relay_outputs"`
+	FirmwareUpgrade bool   `json:"firmware_upgrade"`
+	SystemBackup    bool   `json:"system_backup"`
+	SystemLogging   bool   `json:"system_logging"`
+	IPFilter        bool   `json:"ip_filter"`
+	OnvifVersion    string `json:"onvif_version"`
+}
+
+// 采集并上报摄像头资产信息
+func DeviceGetInventory() error {
+	camera := newCamera()
+	inventory, err := getInventory(camera)
+	if err != nil {
+		return err
+	}
+	go handleResponse(inventory, handleGetInventory)
+	return nil
+}
+
+// 连接摄像头时上报资产信息
+func ReportInventory() {
+	if err := DeviceGetInventory(); err != nil {
+		logrus.WithError(err).Error("report inventory error")
+	}
+}
+
+func getInventory(camera *ptz.Camera) (*Inventory, error) {
+	info, err := getDeviceInformation(camera)
+	if err != nil {
+		return nil, err
+	}
+	inventory := &Inventory{
+		Manufacturer:    info.Manufacturer,
+		Model:           info.Model,
+		FirmwareVersion: info.FirmwareVersion,
+		SerialNumber:    info.SerialNumber,
+		HardwareId:      info.HardwareId,
+		AuthMode:        goonvif.AuthMode(camera.Addr),
+		CollectedAt:     time.Now().Unix(),
+	}
+
+	resp, err := camera.Device_GetCapabilitieAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetCapabilities err")
+	}
+	capabilities := Device.GetCapabilitiesResponse{}
+	err = ptz.ParseResponse(resp, &capabilities)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetCapabilities err")
+	}
+	c := capabilities.Capabilities
+	inventory.Capabilities = InventoryCapabilities{
+		Analytics:       c.Analytics.XAddr != "",
+		Events:          c.Events.XAddr != "",
+		Imaging:         c.Imaging.XAddr != "",
+		Media:           c.Media.XAddr != "",
+		PTZ:             c.PTZ.XAddr != "",
+		InputConnectors: c.Device.IO.InputConnectors,
+		RelayOutputs:    c.Device.IO.RelayOutputs,
+		FirmwareUpgrade: bool(c.Device.System.FirmwareUpgrade),
+		SystemBackup:    bool(c.Device.System.SystemBackup),
+		SystemLogging:   bool(c.Device.System.SystemLogging),
+		IPFilter:        bool(c.Device.Network.IPFilter),
+		OnvifVersion:    fmt.Sprintf("%d.%d", c.Device.System.SupportedVersions.Major, c.Device.System.SupportedVersions.Minor),
+	}
+
+	// 部分老设备不支持GetServices，只上报GetCapabilities的结果
+	resp, err = camera.Device_GetServices(false)
+	if err != nil {
+		logrus.WithError(err).Warn("GetServices err")
+		return inventory, nil
+	}
+	services := Device.GetServicesResponse{}
+	err = ptz.ParseResponse(resp, &services)
+	if err != nil {
+		logrus.WithError(err).Warn("GetServices err")
+		return inventory, nil
+	}
+	for _, service := range services.Service {
+		inventory.Services = append(inventory.Services, InventoryService{
+			Namespace: string(service.Namespace),
+			XAddr:     string(service.XAddr),
+			Version:   fmt.Sprintf("%d.%d", service.Version.Major, service.Version.Minor),
+		})
+	}
+	return inventory, nil
+}
@@ -0,0 +1,317 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/goonvif/Device"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	IPFilterAllow = "Allow" // 只允许列表中的地址访问
+	IPFilterDeny  = "Deny"  // 拒绝列表中的地址访问
+
+	filterVerifyAttempts = 3 // 修改过滤规则后检测网关能否访问摄像头的次数
+)
+
+// IP地址过滤规则，addresses为IP或CIDR，gateway为网关访问摄像头使用的地址，只用于上报
+type IPFilter struct {
+	Type      string   `json:"type"`
+	Addresses []string `json:"addresses"`
+	Gateway   string   `json:"gateway,omitempty"`
+}
+
+// 获取IP地址过滤规则
+func DeviceGetIPAddressFilter() error {
+	camera := newCamera()
+	filter, err := getIPAddressFilter(camera)
+	if err != nil {
+		return err
+	}
+	if ip, err := gatewayIP(camera.Addr); err == nil {
+		filter.Gateway = ip.String()
+	}
+	go handleResponse(filter, handleGetIPAddressFilter)
+	return nil
+}
+
+func getIPAddressFilter(camera *ptz.Camera) (*IPFilter, error) {
+	resp, err := camera.Device_GetIPAddressFilter()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetIPAddressFilter err")
+	}
+	res := Device.GetIPAddressFilterResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, errors.Wrap(err, "GetIPAddressFilter err")
+	}
+	filter := &IPFilter{Type: res.IPAddressFilter.Type, Addresses: []string{}}
+	for _, a := range res.IPAddressFilter.IPv4Address {
+		filter.Addresses = append(filter.Addresses, (&net.IPNet{IP: net.ParseIP(a.Address).To4(), Mask: net.CIDRMask(a.PrefixLength, 32)}).String())
+	}
+	for _, a := range res.IPAddressFilter.IPv6Address {
+		filter.Addresses = append(filter.Addresses, (&net.IPNet{IP: net.ParseIP(a.Address), Mask: net.CIDRMask(a.PrefixLength, 128)}).String())
+	}
+	return filter, nil
+}
+
+// 替换IP地址过滤规则，value为{"type":"Allow","addresses":["192.168.1.10","192.168.2.0/24"]}
+func DeviceSetIPAddressFilter(value interface{}, commandID string) error {
+	filter, err := decodeIPFilter(value)
+	if err != nil {
+		return err
+	}
+	if filter.Type == "" {
+		return errors.New("filter type is required")
+	}
+	return changeIPAddressFilter(SetIPAddressFilter, commandID, func(current *IPFilter) (*IPFilter, func(*ptz.Camera, onvif.IPAddressFilter) (*http.Response, error)) {
+		return filter, (*ptz.Camera).Device_SetIPAddressFilter
+	})
+}
+
+// 添加过滤地址，value同SetIPAddressFilter，type为空时使用摄像头当前的类型
+func DeviceAddIPAddressFilter(value interface{}, commandID string) error {
+	filter, err := decodeIPFilter(value)
+	if err != nil {
+		return err
+	}
+	return changeIPAddressFilter(AddIPAddressFilter, commandID, func(current *IPFilter) (*IPFilter, func(*ptz.Camera, onvif.IPAddressFilter) (*http.Response, error)) {
+		if filter.Type == "" {
+			filter.Type = current.Type
+		}
+		// 类型不同时添加等于替换规则
+		if filter.Type != current.Type {
+			return filter, (*ptz.Camera).Device_SetIPAddressFilter
+		}
+		return &IPFilter{Type: filter.Type, Addresses: mergeAddresses(current.Addresses, filter.Addresses)}, func(camera *ptz.Camera, f onvif.IPAddressFilter) (*http.Response, error) {
+			add, _ := toONVIFFilter(filter)
+			return camera.Device_AddIPAddressFilter(add)
+		}
+	})
+}
+
+// 删除过滤地址，value为{"addresses":["192.168.1.10"]}
+func DeviceRemoveIPAddressFilter(value interface{}, commandID string) error {
+	filter, err := decodeIPFilter(value)
+	if err != nil {
+		return err
+	}
+	return changeIPAddressFilter(RemoveIPAddressFilter, commandID, func(current *IPFilter) (*IPFilter, func(*ptz.Camera, onvif.IPAddressFilter) (*http.Response, error)) {
+		filter.Type = current.Type
+		return &IPFilter{Type: current.Type, Addresses: removeAddresses(current.Addresses, filter.Addresses)}, func(camera *ptz.Camera, f onvif.IPAddressFilter) (*http.Response, error) {
+			remove, _ := toONVIFFilter(filter)
+			return camera.Device_RemoveIPAddressFilter(remove)
+		}
+	})
+}
+
+// 只允许网关访问摄像头
+func DeviceLockDownToGateway(commandID string) error {
+	ip, err := gatewayIP(config.CameraAddr())
+	if err != nil {
+		return err
+	}
+	filter := &IPFilter{Type: IPFilterAllow, Addresses: []string{hostCIDR(ip)}}
+	return changeIPAddressFilter(LockDownToGateway, commandID, func(current *IPFilter) (*IPFilter, func(*ptz.Camera, onvif.IPAddressFilter) (*http.Response, error)) {
+		return filter, (*ptz.Camera).Device_SetIPAddressFilter
+	})
+}
+
+// 修改过滤规则：检查修改后的规则是否允许网关访问，执行后检测网关能否访问摄像头，不能访问时恢复原来的规则。
+// change根据当前规则返回修改后的规则和执行修改的调用
+func changeIPAddressFilter(action, commandID string, change func(current *IPFilter) (*IPFilter, func(*ptz.Camera, onvif.IPAddressFilter) (*http.Response, error))) error {
+	camera := newCamera()
+	previous, err := getIPAddressFilter(camera)
+	if err != nil {
+		return err
+	}
+	next, apply := change(previous)
+	onvifFilter, err := toONVIFFilter(next)
+	if err != nil {
+		return err
+	}
+	ip, err := gatewayIP(camera.Addr)
+	if err != nil {
+		return err
+	}
+	if !filterAllows(next, ip) {
+		audit(action, "rejected", commandID, next)
+		return errors.Errorf("ip address filter would block the gateway %s", ip)
+	}
+
+	audit(action, "requested", commandID, map[string]interface{}{"from": previous, "to": next})
+	resp, err := apply(camera, onvifFilter)
+	if err == nil {
+		err = ptz.ParseResponse(resp, &struct{}{})
+	}
+	// 摄像头返回fault时规则没有修改，不需要检测和恢复
+	if _, rejected := errors.Cause(err).(*ptz.Fault); rejected {
+		audit(action, "failed", commandID, err.Error())
+		return errors.Wrap(err, action+" err")
+	}
+	if err != nil {
+		logrus.WithError(err).Warn(action + " failed, check the camera is reachable")
+	}
+
+	if verifyGatewayAccess() {
+		if err != nil {
+			audit(action, "failed", commandID, err.Error())
+			return errors.Wrap(err, action+" err")
+		}
+		audit(action, "executed", commandID, next)
+		return DeviceGetIPAddressFilter()
+	}
+
+	// 网关无法访问摄像头，恢复原来的规则，摄像头完全拒绝网关时恢复也会失败，需要在现场处理
+	rollback, _ := toONVIFFilter(previous)
+	resp, rerr := camera.Device_SetIPAddressFilter(rollback)
+	if rerr == nil {
+		rerr = ptz.ParseResponse(resp, &Device.SetIPAddressFilterResponse{})
+	}
+	if rerr != nil || !verifyGatewayAccess() {
+		audit(action, "rollback_failed", commandID, previous)
+		return errors.Errorf("camera is not reachable after %s, rollback failed", action)
+	}
+	audit(action, "rolled_back", commandID, previous)
+	return errors.Errorf("camera is not reachable after %s, rolled back", action)
+}
+
+// 检测网关能否访问摄像头
+func verifyGatewayAccess() bool {
+	for i := 0; i < filterVerifyAttempts; i++ {
+		time.Sleep(recoveryInterval)
+		if cameraOnline() {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeIPFilter(value interface{}) (*IPFilter, error) {
+	filter := &IPFilter{}
+	if err := decodeDesired(value, filter); err != nil {
+		return nil, errors.Wrap(err, "decode ip address filter err")
+	}
+	switch strings.ToLower(filter.Type) {
+	case "":
+	case "allow":
+		filter.Type = IPFilterAllow
+	case "deny":
+		filter.Type = IPFilterDeny
+	default:
+		return nil, errors.Errorf("unknown filter type %s", filter.Type)
+	}
+	for i, address := range filter.Addresses {
+		ipNet, err := parseFilterAddress(address)
+		if err != nil {
+			return nil, err
+		}
+		filter.Addresses[i] = ipNet.String()
+	}
+	return filter, nil
+}
+
+func toONVIFFilter(filter *IPFilter) (onvif.IPAddressFilter, error) {
+	res := onvif.IPAddressFilter{Type: onvif.IPAddressFilterType(filter.Type)}
+	for _, address := range filter.Addresses {
+		ipNet, err := parseFilterAddress(address)
+		if err != nil {
+			return res, err
+		}
+		ones, _ := ipNet.Mask.Size()
+		if ip := ipNet.IP.To4(); ip != nil {
+			res.IPv4Address = append(res.IPv4Address, onvif.PrefixedIPv4Address{Address: onvif.IPv4Address(ip.String()), PrefixLength: xsd.Int(ones)})
+		} else {
+			res.IPv6Address = append(res.IPv6Address, onvif.PrefixedIPv6Address{Address: onvif.IPv6Address(ipNet.IP.String()), PrefixLength: xsd.Int(ones)})
+		}
+	}
+	return res, nil
+}
+
+// 解析IP或CIDR，单个IP按主机地址处理
+func parseFilterAddress(address string) (*net.IPNet, error) {
+	address = strings.TrimSpace(address)
+	if !strings.Contains(address, "/") {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return nil, errors.Errorf("invalid address %s", address)
+		}
+		address = hostCIDR(ip)
+	}
+	_, ipNet, err := net.ParseCIDR(address)
+	if err != nil {
+		return nil, errors.Errorf("invalid address %s", address)
+	}
+	return ipNet, nil
+}
+
+func hostCIDR(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
+// 判断规则是否允许ip访问，没有地址的规则不生效
+func filterAllows(filter *IPFilter, ip net.IP) bool {
+	if len(filter.Addresses) == 0 {
+		return true
+	}
+	matched := false
+	for _, address := range filter.Addresses {
+		if ipNet, err := parseFilterAddress(address); err == nil && ipNet.Contains(ip) {
+			matched = true
+			break
+		}
+	}
+	if filter.Type == IPFilterDeny {
+		return !matched
+	}
+	return matched
+}
+
+func mergeAddresses(current, add []string) []string {
+	res := append([]string{}, current...)
+	for _, a := range add {
+		if !containsString(res, a) {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+func removeAddresses(current, remove []string) []string {
+	res := make([]string, 0, len(current))
+	for _, a := range current {
+		if !containsString(remove, a) {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// 网关访问摄像头使用的本机地址
+func gatewayIP(addr string) (net.IP, error) {
+	_, host, port := splitCameraAddr(addr)
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(host, port), time.Second*5)
+	if err != nil {
+		return nil, errors.Wrap(err, "get gateway ip err")
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
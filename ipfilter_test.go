@@ -0,0 +1,69 @@
+package camera
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilterAddress(t *testing.T) {
+	cases := map[string]string{
+		"192.168.1.10":    "192.168.1.10/32",
+		" 192.168.1.10 ":  "192.168.1.10/32",
+		"192.168.1.0/24":  "192.168.1.0/24",
+		"192.168.1.10/24": "192.168.1.0/24",
+		"fe80::1":         "fe80::1/128",
+		"2001:db8::/32":   "2001:db8::/32",
+	}
+	for address, want := range cases {
+		ipNet, err := parseFilterAddress(address)
+		if err != nil {
+			t.Errorf("parseFilterAddress(%q) error: %v", address, err)
+			continue
+		}
+		if ipNet.String() != want {
+			t.Errorf("parseFilterAddress(%q) = %s, want %s", address, ipNet, want)
+		}
+	}
+	for _, address := range []string{"", "camera", "192.168.1.300", "192.168.1.0/33"} {
+		if _, err := parseFilterAddress(address); err == nil {
+			t.Errorf("parseFilterAddress(%q) should fail", address)
+		}
+	}
+}
+
+func TestFilterAllows(t *testing.T) {
+	ip := net.ParseIP("192.168.1.10")
+	cases := []struct {
+		filter IPFilter
+		want   bool
+	}{
+		{IPFilter{Type: IPFilterAllow}, true},
+		{IPFilter{Type: IPFilterDeny}, true},
+		{IPFilter{Type: IPFilterAllow, Addresses: []string{"192.168.1.0/24"}}, true},
+		{IPFilter{Type: IPFilterAllow, Addresses: []string{"10.0.0.0/8"}}, false},
+		{IPFilter{Type: IPFilterAllow, Addresses: []string{"invalid", "192.168.1.10"}}, true},
+		{IPFilter{Type: IPFilterDeny, Addresses: []string{"192.168.1.10"}}, false},
+		{IPFilter{Type: IPFilterDeny, Addresses: []string{"10.0.0.0/8"}}, true},
+	}
+	for _, c := range cases {
+		if got := filterAllows(&c.filter, ip); got != c.want {
+			t.Errorf("filterAllows(%+v) = %v, want %v", c.filter, got, c.want)
+		}
+	}
+}
+
+func TestMergeAddresses(t *testing.T) {
+	current := []string{"192.168.1.0/24", "10.0.0.1/32"}
+	got := mergeAddresses(current, []string{"10.0.0.1/32", "172.16.0.0/12", "172.16.0.0/12"})
+	want := []string{"192.168.1.0/24", "10.0.0.1/32", "172.16.0.0/12"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeAddresses = %v, want %v", got, want)
+	}
+	if len(current) != 2 {
+		t.Errorf("mergeAddresses modified the current addresses: %v", current)
+	}
+	if got := removeAddresses(want, []string{"10.0.0.1/32"}); !reflect.DeepEqual(got, []string{"192.168.1.0/24", "172.16.0.0/12"}) {
+		t.Errorf("removeAddresses = %v", got)
+	}
+}
@@ -0,0 +1,692 @@
+package camera
+
+import (
+	"camera/goonvif/Media"
+	"camera/goonvif/Media2"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+)
+
+const defaultStreamProtocol = "RTSP" // 默认取流协议 RTP/RTSP/TCP
+
+// 视频流地址
+type StreamInfo struct {
+	Profile  string `json:"profile"`
+	Protocol string `json:"protocol"`
+	Uri      string `json:"uri"`
+	Media2   bool   `json:"media2"`
+}
+
+// 视频编码配置，Media2下可以看到H265编码
+type VideoEncoder struct {
+	Token           string  `json:"token"`
+	Name            string  `json:"name"`
+	Encoding        string  `json:"encoding"`
+	Width           int     `json:"width"`
+	Height          int     `json:"height"`
+	Quality         float64 `json:"quality"`
+	FrameRate       float64 `json:"frame_rate"`
+	Bitrate         int     `json:"bitrate"` // kbps
+	GovLength       int     `json:"gov_length"`
+	Profile         string  `json:"profile,omitempty"`
+	ConstantBitRate bool    `json:"constant_bitrate"`
+	UseCount        int     `json:"use_count"`
+}
+
+// 修改视频编码配置时下发的参数，为零的值不修改
+type VideoEncoderSetting struct {
+	VideoEncoder
+	ConstantBitRate *bool `json:"constant_bitrate,omitempty"`
+}
+
+// 视频编码参数约束，每种编码方式一组
+type VideoEncoderOption struct {
+	Encoding        string       `json:"encoding"`
+	Resolutions     []Resolution `json:"resolutions"`
+	QualityRange    [2]float64   `json:"quality_range"`
+	BitrateRange    [2]int       `json:"bitrate_range"`
+	GovLengthRange  []int        `json:"gov_length_range,omitempty"`
+	FrameRates      []float64    `json:"frame_rates,omitempty"`
+	Profiles        []string     `json:"profiles,omitempty"`
+	ConstantBitRate bool         `json:"constant_bitrate"`
+}
+
+// 分辨率
+type Resolution struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// OSD叠加，type为Text/Image，position为UpperLeft/UpperRight/LowerLeft/LowerRight/Custom，Custom时使用pos
+type OSD struct {
+	Token              string `json:"token,omitempty"`
+	ConfigurationToken string `json:"configuration_token,omitempty"` // 视频源配置
+	Type               string `json:"type"`
+	Position           string `json:"position"`
+	Pos                *Point `json:"pos,omitempty"`
+	TextType           string `json:"text_type,omitempty"` // Plain/Date/Time/DateAndTime
+	PlainText          string `json:"plain_text,omitempty"`
+	DateFormat         string `json:"date_format,omitempty"`
+	TimeFormat         string `json:"time_format,omitempty"`
+	FontSize           int    `json:"font_size,omitempty"`
+	ImgPath            string `json:"img_path,omitempty"`
+}
+
+// 隐私遮挡，type为Color/Pixelated/Blurred
+type PrivacyMask struct {
+	Token              string  `json:"token,omitempty"`
+	ConfigurationToken string  `json:"configuration_token,omitempty"` // 视频源配置
+	Type               string  `json:"type"`
+	Polygon            []Point `json:"polygon"`
+	Enabled            bool    `json:"enabled"`
+}
+
+// 摄像头提供Media2服务时才能使用的功能
+func media2Camera() (*ptz.Camera, error) {
+	camera := newCamera()
+	if !camera.SupportsMedia2() {
+		return nil, errors.New("camera does not support Media2")
+	}
+	return camera, nil
+}
+
+// 获取Media2的第一个Profile
+func media2Profile(camera *ptz.Camera) (*Media2.MediaProfile, error) {
+	profiles, err := camera.Media2_GetProfiles()
+	if err != nil {
+		return nil, errors.Wrap(err, "Media2 GetProfiles err")
+	}
+	if len(profiles.Profiles) == 0 {
+		return nil, errors.New("camera has no media profile")
+	}
+	return &profiles.Profiles[0], nil
+}
+
+// 获取视频源配置token，未指定时使用当前Profile的配置
+func videoSourceConfigurationToken(camera *ptz.Camera, token string) (onvif.ReferenceToken, error) {
+	if token != "" {
+		return onvif.ReferenceToken(token), nil
+	}
+	profile, err := media2Profile(camera)
+	if err != nil {
+		return "", err
+	}
+	if profile.Configurations.VideoSource.Token == "" {
+		return "", errors.New("camera has no video source configuration")
+	}
+	return onvif.ReferenceToken(profile.Configurations.VideoSource.Token), nil
+}
+
+// 获取快照地址，摄像头支持时优先使用Media2
+func getSnapshotUri(camera *ptz.Camera) (string, error) {
+	if camera.SupportsMedia2() {
+		profile, err := media2Profile(camera)
+		if err != nil {
+			return "", err
+		}
+		resp, err := camera.Media2_GetSnapshotUri(onvif.ReferenceToken(profile.Token))
+		if err != nil {
+			return "", errors.Wrap(err, "Media2 GetSnapshotUri err")
+		}
+		res := Media2.GetSnapshotUriResponse{}
+		if err = ptz.ParseResponse(resp, &res); err != nil {
+			return "", errors.Wrap(err, "Media2 GetSnapshotUri err")
+		}
+		return res.Uri, nil
+	}
+
+	profiles, err := camera.GetProfiles()
+	if err != nil {
+		return "", errors.Wrap(err, "GetProfiles err")
+	}
+	resp, err := camera.Media_GetSnapshotUri(profiles.Profiles.Token)
+	if err != nil {
+		return "", errors.Wrap(err, "GetSnapshotUri err")
+	}
+	res := Media.GetSnapshotUriResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return "", errors.Wrap(err, "GetSnapshotUri err")
+	}
+	return string(res.MediaUri.Uri), nil
+}
+
+// 获取视频流地址，value为取流协议，Media2为RtspUnicast/RtspMulticast/RTSP/RtspOverHttp，默认RTSP
+func DeviceGetStreamUri(value interface{}) error {
+	protocol, _ := value.(string)
+	if protocol == "" {
+		protocol = defaultStreamProtocol
+	}
+	camera := newCamera()
+	stream := StreamInfo{Protocol: protocol}
+
+	if camera.SupportsMedia2() {
+		profile, err := media2Profile(camera)
+		if err != nil {
+			return err
+		}
+		resp, err := camera.Media2_GetStreamUri(protocol, onvif.ReferenceToken(profile.Token))
+		if err != nil {
+			return errors.Wrap(err, "Media2 GetStreamUri err")
+		}
+		res := Media2.GetStreamUriResponse{}
+		if err = ptz.ParseResponse(resp, &res); err != nil {
+			return errors.Wrap(err, "Media2 GetStreamUri err")
+		}
+		stream.Profile = profile.Token
+		stream.Uri = res.Uri
+		stream.Media2 = true
+		go handleResponse(stream, handleGetStreamUri)
+		return nil
+	}
+
+	profiles, err := camera.GetProfiles()
+	if err != nil {
+		return errors.Wrap(err, "GetProfiles err")
+	}
+	setup := onvif.StreamSetup{
+		Stream:    onvif.StreamType("RTP-Unicast"),
+		Transport: onvif.Transport{Protocol: onvif.TransportProtocol(protocol)},
+	}
+	resp, err := camera.Media_GetStreamUri(setup, profiles.Profiles.Token)
+	if err != nil {
+		return errors.Wrap(err, "GetStreamUri err")
+	}
+	res := Media.GetStreamUriResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return errors.Wrap(err, "GetStreamUri err")
+	}
+	stream.Profile = string(profiles.Profiles.Token)
+	stream.Uri = string(res.MediaUri.Uri)
+	go handleResponse(stream, handleGetStreamUri)
+	return nil
+}
+
+// 获取视频编码配置，摄像头支持时优先使用Media2
+func DeviceGetVideoEncoders() error {
+	camera := newCamera()
+	encoders, err := getVideoEncoders(camera)
+	if err != nil {
+		return err
+	}
+	go handleResponse(encoders, handleGetVideoEncoders)
+	return nil
+}
+
+func getVideoEncoders(camera *ptz.Camera) ([]VideoEncoder, error) {
+	if camera.SupportsMedia2() {
+		resp, err := camera.Media2_GetVideoEncoderConfigurations("")
+		if err != nil {
+			return nil, errors.Wrap(err, "Media2 GetVideoEncoderConfigurations err")
+		}
+		res := Media2.GetVideoEncoderConfigurationsResponse{}
+		if err = ptz.ParseResponse(resp, &res); err != nil {
+			return nil, errors.Wrap(err, "Media2 GetVideoEncoderConfigurations err")
+		}
+		encoders := make([]VideoEncoder, 0, len(res.Configurations))
+		for _, c := range res.Configurations {
+			encoders = append(encoders, VideoEncoder{
+				Token:           c.Token,
+				Name:            c.Name,
+				Encoding:        c.Encoding,
+				Width:           c.Resolution.Width,
+				Height:          c.Resolution.Height,
+				Quality:         c.Quality,
+				FrameRate:       c.RateControl.FrameRateLimit,
+				Bitrate:         c.RateControl.BitrateLimit,
+				GovLength:       c.GovLength,
+				Profile:         c.Profile,
+				ConstantBitRate: c.RateControl.ConstantBitRate,
+				UseCount:        c.UseCount,
+			})
+		}
+		return encoders, nil
+	}
+
+	resp, err := camera.Media_GetVideoEncoderConfigurations()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetVideoEncoderConfigurations err")
+	}
+	res := Media.GetVideoEncoderConfigurationsResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, errors.Wrap(err, "GetVideoEncoderConfigurations err")
+	}
+	encoders := make([]VideoEncoder, 0, len(res.Configurations))
+	for _, c := range res.Configurations {
+		encoder := VideoEncoder{
+			Token:     c.Token,
+			Name:      c.Name,
+			Encoding:  c.Encoding,
+			Width:     c.Resolution.Width,
+			Height:    c.Resolution.Height,
+			Quality:   c.Quality,
+			FrameRate: float64(c.RateControl.FrameRateLimit),
+			Bitrate:   c.RateControl.BitrateLimit,
+			UseCount:  c.UseCount,
+		}
+		switch c.Encoding {
+		case "H264":
+			encoder.GovLength = c.H264.GovLength
+			encoder.Profile = c.H264.H264Profile
+		case "MPEG4":
+			encoder.GovLength = c.MPEG4.GovLength
+			encoder.Profile = c.MPEG4.Mpeg4Profile
+		}
+		encoders = append(encoders, encoder)
+	}
+	return encoders, nil
+}
+
+// 修改视频编码配置，value为VideoEncoder，只修改设置的值，token为空时修改第一个编码配置
+func DeviceSetVideoEncoder(value interface{}) error {
+	encoder := VideoEncoderSetting{}
+	if err := decodeDesired(value, &encoder); err != nil {
+		return errors.Wrap(err, "decode video encoder err")
+	}
+	camera, err := media2Camera()
+	if err != nil {
+		return err
+	}
+	if err = setVideoEncoder(camera, encoder); err != nil {
+		return err
+	}
+	return DeviceGetVideoEncoders()
+}
+
+func setVideoEncoder(camera *ptz.Camera, encoder VideoEncoderSetting) error {
+	resp, err := camera.Media2_GetVideoEncoderConfigurations(onvif.ReferenceToken(encoder.Token))
+	if err != nil {
+		return errors.Wrap(err, "Media2 GetVideoEncoderConfigurations err")
+	}
+	res := Media2.GetVideoEncoderConfigurationsResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return errors.Wrap(err, "Media2 GetVideoEncoderConfigurations err")
+	}
+	if len(res.Configurations) == 0 {
+		return errors.Errorf("video encoder %s not found", encoder.Token)
+	}
+	c := res.Configurations[0]
+	cfg := Media2.VideoEncoder2ConfigurationData{
+		Token:      c.Token,
+		GovLength:  c.GovLength,
+		Profile:    c.Profile,
+		Name:       c.Name,
+		UseCount:   c.UseCount,
+		Encoding:   c.Encoding,
+		Resolution: Media2.VideoResolutionData{Width: c.Resolution.Width, Height: c.Resolution.Height},
+		RateControl: &Media2.VideoRateControlData{
+			ConstantBitRate: c.RateControl.ConstantBitRate,
+			FrameRateLimit:  c.RateControl.FrameRateLimit,
+			BitrateLimit:    c.RateControl.BitrateLimit,
+		},
+		Quality: c.Quality,
+	}
+	if encoder.Encoding != "" {
+		cfg.Encoding = encoder.Encoding
+	}
+	if encoder.Width > 0 && encoder.Height > 0 {
+		cfg.Resolution = Media2.VideoResolutionData{Width: encoder.Width, Height: encoder.Height}
+	}
+	if encoder.Quality > 0 {
+		cfg.Quality = encoder.Quality
+	}
+	if encoder.FrameRate > 0 {
+		cfg.RateControl.FrameRateLimit = encoder.FrameRate
+	}
+	if encoder.Bitrate > 0 {
+		cfg.RateControl.BitrateLimit = encoder.Bitrate
+	}
+	if encoder.GovLength > 0 {
+		cfg.GovLength = encoder.GovLength
+	}
+	if encoder.Profile != "" {
+		cfg.Profile = encoder.Profile
+	}
+	if encoder.ConstantBitRate != nil {
+		cfg.RateControl.ConstantBitRate = *encoder.ConstantBitRate
+	}
+
+	resp, err = camera.Media2_SetVideoEncoderConfiguration(cfg)
+	if err != nil {
+		return errors.Wrap(err, "Media2 SetVideoEncoderConfiguration err")
+	}
+	if err = ptz.ParseResponse(resp, &Media2.SetVideoEncoderConfigurationResponse{}); err != nil {
+		return errors.Wrap(err, "Media2 SetVideoEncoderConfiguration err")
+	}
+	return nil
+}
+
+// 获取视频编码参数约束，value为编码配置token，为空时返回摄像头支持的全部编码方式
+func DeviceGetVideoEncoderOptions(value interface{}) error {
+	camera, err := media2Camera()
+	if err != nil {
+		return err
+	}
+	token, _ := value.(string)
+	resp, err := camera.Media2_GetVideoEncoderConfigurationOptions(onvif.ReferenceToken(token))
+	if err != nil {
+		return errors.Wrap(err, "Media2 GetVideoEncoderConfigurationOptions err")
+	}
+	res := Media2.GetVideoEncoderConfigurationOptionsResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return errors.Wrap(err, "Media2 GetVideoEncoderConfigurationOptions err")
+	}
+
+	options := make([]VideoEncoderOption, 0, len(res.Options))
+	for _, o := range res.Options {
+		option := VideoEncoderOption{
+			Encoding:        o.Encoding,
+			QualityRange:    [2]float64{o.QualityRange.Min, o.QualityRange.Max},
+			BitrateRange:    [2]int{o.BitrateRange.Min, o.BitrateRange.Max},
+			GovLengthRange:  parseIntList(o.GovLengthRange),
+			FrameRates:      parseFloatList(o.FrameRatesSupported),
+			Profiles:        strings.Fields(o.ProfilesSupported),
+			ConstantBitRate: o.ConstantBitRateSupported,
+		}
+		for _, r := range o.ResolutionsAvailable {
+			option.Resolutions = append(option.Resolutions, Resolution{Width: r.Width, Height: r.Height})
+		}
+		options = append(options, option)
+	}
+	go handleResponse(options, handleGetVideoEncoderOptions)
+	return nil
+}
+
+// 解析空格分隔的整数列表(tt:IntList)
+func parseIntList(s string) []int {
+	var list []int
+	for _, field := range strings.Fields(s) {
+		if v, err := strconv.Atoi(field); err == nil {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// 解析空格分隔的浮点数列表(tt:FloatList)
+func parseFloatList(s string) []float64 {
+	var list []float64
+	for _, field := range strings.Fields(s) {
+		if v, err := strconv.ParseFloat(field, 64); err == nil {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// 获取OSD，value为视频源配置token，为空时使用当前Profile的配置
+func DeviceGetOSDs(value interface{}) error {
+	camera, err := media2Camera()
+	if err != nil {
+		return err
+	}
+	token, _ := value.(string)
+	configurationToken, err := videoSourceConfigurationToken(camera, token)
+	if err != nil {
+		return errors.Wrap(err, "DeviceGetOSDs err")
+	}
+	return reportOSDs(camera, configurationToken)
+}
+
+func reportOSDs(camera *ptz.Camera, configurationToken onvif.ReferenceToken) error {
+	osds, err := getOSDs(camera, configurationToken)
+	if err != nil {
+		return err
+	}
+	go handleResponse(osds, handleGetOSDs)
+	return nil
+}
+
+func getOSDs(camera *ptz.Camera, configurationToken onvif.ReferenceToken) ([]OSD, error) {
+	resp, err := camera.Media2_GetOSDs(configurationToken)
+	if err != nil {
+		return nil, errors.Wrap(err, "Media2 GetOSDs err")
+	}
+	res := Media2.GetOSDsResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, errors.Wrap(err, "Media2 GetOSDs err")
+	}
+
+	osds := make([]OSD, 0, len(res.OSDs))
+	for _, o := range res.OSDs {
+		osd := OSD{
+			Token:              o.Token,
+			ConfigurationToken: o.VideoSourceConfigurationToken,
+			Type:               o.Type,
+			Position:           o.Position.Type,
+			TextType:           o.TextString.Type,
+			PlainText:          o.TextString.PlainText,
+			DateFormat:         o.TextString.DateFormat,
+			TimeFormat:         o.TextString.TimeFormat,
+			FontSize:           o.TextString.FontSize,
+			ImgPath:            o.Image.ImgPath,
+		}
+		if o.Position.Type == "Custom" {
+			osd.Pos = &Point{X: o.Position.Pos.X, Y: o.Position.Pos.Y}
+		}
+		osds = append(osds, osd)
+	}
+	return osds, nil
+}
+
+// 创建或修改OSD，value为OSD，没有token时创建
+func DeviceSetOSD(value interface{}) error {
+	osd := OSD{}
+	if err := decodeDesired(value, &osd); err != nil {
+		return errors.Wrap(err, "decode osd err")
+	}
+	if osd.Type == "" {
+		osd.Type = "Text"
+	}
+	if osd.Position == "" {
+		osd.Position = "UpperLeft"
+	}
+	if osd.Position == "Custom" && osd.Pos == nil {
+		return errors.New("pos is required for custom position")
+	}
+
+	camera, err := media2Camera()
+	if err != nil {
+		return err
+	}
+	configurationToken, err := videoSourceConfigurationToken(camera, osd.ConfigurationToken)
+	if err != nil {
+		return errors.Wrap(err, "DeviceSetOSD err")
+	}
+
+	cfg := Media2.OSDConfiguration{
+		Token:                         osd.Token,
+		VideoSourceConfigurationToken: configurationToken,
+		Type:                          osd.Type,
+		Position:                      Media2.OSDPosConfiguration{Type: osd.Position},
+	}
+	if osd.Pos != nil {
+		cfg.Position.Pos = &onvif.Vector{X: osd.Pos.X, Y: osd.Pos.Y}
+	}
+	switch osd.Type {
+	case "Text":
+		if osd.TextType == "" {
+			osd.TextType = "Plain"
+		}
+		cfg.TextString = &Media2.OSDTextConfiguration{
+			Type:       osd.TextType,
+			DateFormat: osd.DateFormat,
+			TimeFormat: osd.TimeFormat,
+			FontSize:   osd.FontSize,
+			PlainText:  osd.PlainText,
+		}
+	case "Image":
+		if osd.ImgPath == "" {
+			return errors.New("img_path is required for image osd")
+		}
+		cfg.Image = &Media2.OSDImgConfiguration{ImgPath: osd.ImgPath}
+	default:
+		return errors.Errorf("unknown osd type %s", osd.Type)
+	}
+
+	if osd.Token == "" {
+		resp, err := camera.Media2_CreateOSD(cfg)
+		if err != nil {
+			return errors.Wrap(err, "Media2 CreateOSD err")
+		}
+		if err = ptz.ParseResponse(resp, &Media2.CreateOSDResponse{}); err != nil {
+			return errors.Wrap(err, "Media2 CreateOSD err")
+		}
+	} else {
+		resp, err := camera.Media2_SetOSD(cfg)
+		if err != nil {
+			return errors.Wrap(err, "Media2 SetOSD err")
+		}
+		if err = ptz.ParseResponse(resp, &Media2.SetOSDResponse{}); err != nil {
+			return errors.Wrap(err, "Media2 SetOSD err")
+		}
+	}
+	return reportOSDs(camera, configurationToken)
+}
+
+// 删除OSD，value为OSD token
+func DeviceDeleteOSD(value interface{}) error {
+	token, _ := value.(string)
+	if token == "" {
+		return errors.New("osd token is required")
+	}
+	camera, err := media2Camera()
+	if err != nil {
+		return err
+	}
+	resp, err := camera.Media2_DeleteOSD(onvif.ReferenceToken(token))
+	if err != nil {
+		return errors.Wrap(err, "Media2 DeleteOSD err")
+	}
+	if err = ptz.ParseResponse(resp, &Media2.DeleteOSDResponse{}); err != nil {
+		return errors.Wrap(err, "Media2 DeleteOSD err")
+	}
+	return DeviceGetOSDs(nil)
+}
+
+// 获取隐私遮挡，value为视频源配置token，为空时使用当前Profile的配置
+func DeviceGetPrivacyMasks(value interface{}) error {
+	camera, err := media2Camera()
+	if err != nil {
+		return err
+	}
+	token, _ := value.(string)
+	configurationToken, err := videoSourceConfigurationToken(camera, token)
+	if err != nil {
+		return errors.Wrap(err, "DeviceGetPrivacyMasks err")
+	}
+	return reportPrivacyMasks(camera, configurationToken)
+}
+
+func reportPrivacyMasks(camera *ptz.Camera, configurationToken onvif.ReferenceToken) error {
+	resp, err := camera.Media2_GetMasks(configurationToken)
+	if err != nil {
+		return errors.Wrap(err, "Media2 GetMasks err")
+	}
+	res := Media2.GetMasksResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return errors.Wrap(err, "Media2 GetMasks err")
+	}
+
+	masks := make([]PrivacyMask, 0, len(res.Masks))
+	for _, m := range res.Masks {
+		mask := PrivacyMask{
+			Token:              m.Token,
+			ConfigurationToken: m.ConfigurationToken,
+			Type:               m.Type,
+			Enabled:            m.Enabled,
+		}
+		for _, p := range m.Polygon.Point {
+			mask.Polygon = append(mask.Polygon, Point{X: p.X, Y: p.Y})
+		}
+		masks = append(masks, mask)
+	}
+	go handleResponse(masks, handleGetPrivacyMasks)
+	return nil
+}
+
+// 创建或修改隐私遮挡，value为PrivacyMask，没有token时创建，点数不能超过摄像头的限制
+func DeviceSetPrivacyMask(value interface{}) error {
+	mask := PrivacyMask{}
+	if err := decodeDesired(value, &mask); err != nil {
+		return errors.Wrap(err, "decode privacy mask err")
+	}
+	if len(mask.Polygon) < 3 {
+		return errors.New("privacy mask polygon needs at least 3 points")
+	}
+	if mask.Type == "" {
+		mask.Type = "Color"
+	}
+
+	camera, err := media2Camera()
+	if err != nil {
+		return err
+	}
+	configurationToken, err := videoSourceConfigurationToken(camera, mask.ConfigurationToken)
+	if err != nil {
+		return errors.Wrap(err, "DeviceSetPrivacyMask err")
+	}
+
+	resp, err := camera.Media2_GetMaskOptions(configurationToken)
+	if err != nil {
+		return errors.Wrap(err, "Media2 GetMaskOptions err")
+	}
+	options := Media2.GetMaskOptionsResponse{}
+	if err = ptz.ParseResponse(resp, &options); err != nil {
+		return errors.Wrap(err, "Media2 GetMaskOptions err")
+	}
+	if max := options.Options.MaxPoints; max > 0 && len(mask.Polygon) > max {
+		return errors.Errorf("privacy mask supports at most %d points", max)
+	}
+
+	cfg := Media2.Mask{
+		Token:              mask.Token,
+		ConfigurationToken: configurationToken,
+		Type:               mask.Type,
+		Enabled:            mask.Enabled,
+	}
+	for _, p := range mask.Polygon {
+		cfg.Polygon.Point = append(cfg.Polygon.Point, onvif.Vector{X: p.X, Y: p.Y})
+	}
+
+	if mask.Token == "" {
+		resp, err = camera.Media2_CreateMask(cfg)
+		if err != nil {
+			return errors.Wrap(err, "Media2 CreateMask err")
+		}
+		if err = ptz.ParseResponse(resp, &Media2.CreateMaskResponse{}); err != nil {
+			return errors.Wrap(err, "Media2 CreateMask err")
+		}
+	} else {
+		resp, err = camera.Media2_SetMask(cfg)
+		if err != nil {
+			return errors.Wrap(err, "Media2 SetMask err")
+		}
+		if err = ptz.ParseResponse(resp, &Media2.SetMaskResponse{}); err != nil {
+			return errors.Wrap(err, "Media2 SetMask err")
+		}
+	}
+	return reportPrivacyMasks(camera, configurationToken)
+}
+
+// 删除隐私遮挡，value为遮挡token
+func DeviceDeletePrivacyMask(value interface{}) error {
+	token, _ := value.(string)
+	if token == "" {
+		return errors.New("privacy mask token is required")
+	}
+	camera, err := media2Camera()
+	if err != nil {
+		return err
+	}
+	resp, err := camera.Media2_DeleteMask(onvif.ReferenceToken(token))
+	if err != nil {
+		return errors.Wrap(err, "Media2 DeleteMask err")
+	}
+	if err = ptz.ParseResponse(resp, &Media2.DeleteMaskResponse{}); err != nil {
+		return errors.Wrap(err, "Media2 DeleteMask err")
+	}
+	return DeviceGetPrivacyMasks(nil)
+}
@@ -5,12 +5,17 @@ import (
 	"encoding/gob"
 	"github.com/eclipse/paho.mqtt.golang"
 	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"strings"
 	"sync"
 	"time"
 )
 
+const publishTimeout = time.Second * 10 // 等待发送完成的时间
+
+var errPublishTimeout = errors.Errorf("publish timeout after %v", publishTimeout)
+
 func init() {
 	gob.Register(map[string]interface{}{})
 	gob.Register([]interface{}{})
@@ -42,6 +47,12 @@ type Config struct {
 	CACert       string
 	TLSCert      string
 	TLSKey       string
+
+	InsecureSkipVerify bool
+
+	QueuePath string        // 离线消息队列目录，为空时断开期间的消息直接丢弃
+	QueueSize int           // 最多缓存的消息数量
+	QueueTTL  time.Duration // 消息的有效期
 }
 
 // KafkaBackend implements a MQTT pub-sub backend.
@@ -62,6 +73,8 @@ type Backend struct {
 
 	ctx       context.Context
 	redisPool *redis.Pool
+
+	queue *offlineQueue // MQTT断开时缓存上行消息
 }
 
 var pubSub *Backend
@@ -85,6 +98,11 @@ func NewBackend(c Config) error {
 	if err != nil {
 		return err
 	}
+	if c.QueuePath != "" {
+		if b.queue, err = newOfflineQueue(c.QueuePath, c.QueueSize, c.QueueTTL); err != nil {
+			return err
+		}
+	}
 
 	opts.SetAutoReconnect(false)
 	opts.SetOnConnectHandler(b.onConnected)
@@ -110,7 +128,7 @@ func (b *Backend) newOptions() (*mqtt.ClientOptions, error) {
 	opts.SetWriteTimeout(time.Second * 5)
 	opts.SetAutoReconnect(false)
 	opts.SetClientID(time.Now().String())
-	tlsConfig, err := NewTLSConfig(b.config.CACert, b.config.TLSCert, b.config.TLSKey)
+	tlsConfig, err := NewTLSConfig(b.config.CACert, b.config.TLSCert, b.config.TLSKey, b.config.InsecureSkipVerify)
 	if err != nil {
 		return nil, err
 	}
@@ -128,14 +146,58 @@ func (b *Backend) Close() error {
 	return nil
 }
 
-// 发送消息
+// 发送消息，断开或队列中还有未重发的消息时写入离线队列。发送和写入队列都持有队列的锁，保证消息的顺序
 func (b *Backend) publish(topic string, v []byte) error {
-	if token := b.conn.Publish(topic, b.config.QOS, false, v); token.Wait() && token.Error() != nil {
-		return token.Error()
+	if b.queue == nil {
+		return b.send(topic, v)
+	}
+	b.queue.Lock()
+	defer b.queue.Unlock()
+	if b.queue.len() > 0 || !b.connected() {
+		err := b.queue.push(topic, v)
+		if err == nil && b.connected() {
+			go b.replay()
+		}
+		return err
+	}
+
+	err := b.send(topic, v)
+	if err == nil {
+		return nil
+	}
+	if b.inFlight(err) {
+		logrus.WithError(err).Warn("publish is not confirmed, it is left to the mqtt client")
+		return nil
+	}
+	if qerr := b.queue.push(topic, v); qerr != nil {
+		return qerr
+	}
+	logrus.WithError(err).Warn("publish error, message is queued")
+	// 连接仍在时不会触发重连，需要主动重发
+	if b.connected() {
+		go b.replay()
 	}
 	return nil
 }
 
+// 发送消息，超过publishTimeout没有完成时返回errPublishTimeout
+func (b *Backend) send(topic string, v []byte) error {
+	token := b.conn.Publish(topic, b.config.QOS, false, v)
+	if !token.WaitTimeout(publishTimeout) {
+		return errPublishTimeout
+	}
+	return token.Error()
+}
+
+// 超时的QoS>=1消息仍由mqtt客户端投递，再写入队列重发会重复
+func (b *Backend) inFlight(err error) bool {
+	return err == errPublishTimeout && b.config.QOS > 0
+}
+
+func (b *Backend) connected() bool {
+	return b.conn != nil && b.conn.IsConnected()
+}
+
 // camera数据通道
 func (b *Backend) deviceHandler(c mqtt.Client, msg mqtt.Message) {
 	b.wg.Add(1)
@@ -165,6 +227,13 @@ func (b *Backend) onConnected(c mqtt.Client) {
 	if token := b.conn.Subscribe(b.deviceTopic, b.config.QOS, b.deviceHandler); token.Wait() && token.Error() != nil {
 		logrus.WithField("topic", b.deviceTopic).Errorf("subscribe rx error: %s", token.Error())
 	}
+	// 先重发离线期间的消息，再获取离线期间云端影子的变化
+	go func() {
+		b.replay()
+		if err := requestTwins(b); err != nil {
+			logrus.WithError(err).Error("request shadow error")
+		}
+	}()
 }
 
 func (b *Backend) onConnectionLost(c mqtt.Client, reason error) {
@@ -0,0 +1,530 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/goonvif"
+	"camera/goonvif/Device"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPrefixLength = 24 // 静态地址默认的子网前缀长度
+
+// 摄像头网络配置
+type NetworkInfo struct {
+	Addr       string             `json:"addr"` // 网关使用的摄像头地址
+	Interfaces []NetworkInterface `json:"interfaces"`
+	Gateway    []string           `json:"gateway"`
+	DNS        DNSInfo            `json:"dns"`
+	Hostname   HostnameInfo       `json:"hostname"`
+	Protocols  []NetworkProtocol  `json:"protocols"`
+}
+
+// 网卡配置，dhcp为false时使用address/prefix_length静态地址
+type NetworkInterface struct {
+	Token        string `json:"token,omitempty"`
+	Name         string `json:"name,omitempty"`
+	HwAddress    string `json:"hw_address,omitempty"`
+	Enabled      bool   `json:"enabled"`
+	DHCP         bool   `json:"dhcp"`
+	Address      string `json:"address,omitempty"`
+	PrefixLength int    `json:"prefix_length,omitempty"`
+	Gateway      string `json:"gateway,omitempty"` // 只用于下发
+	MTU          int    `json:"mtu,omitempty"`
+}
+
+// DNS配置
+type DNSInfo struct {
+	FromDHCP     bool     `json:"from_dhcp"`
+	Servers      []string `json:"servers"`
+	SearchDomain []string `json:"search_domain,omitempty"`
+}
+
+// 主机名
+type HostnameInfo struct {
+	FromDHCP bool   `json:"from_dhcp"`
+	Name     string `json:"name"`
+}
+
+// 网络协议端口，name为HTTP/HTTPS/RTSP
+type NetworkProtocol struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Port    int    `json:"port"`
+}
+
+// 获取网络配置
+func DeviceGetNetwork() error {
+	camera := newCamera()
+	info, err := getNetworkInfo(camera)
+	if err != nil {
+		return err
+	}
+	go handleResponse(info, handleGetNetwork)
+	return nil
+}
+
+func getNetworkInfo(camera *ptz.Camera) (*NetworkInfo, error) {
+	info := &NetworkInfo{Addr: camera.Addr}
+	interfaces, err := getNetworkInterfaces(camera)
+	if err != nil {
+		return nil, err
+	}
+	info.Interfaces = interfaces
+
+	resp, err := camera.Device_GetNetworkDefaultGateway()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNetworkDefaultGateway err")
+	}
+	gateway := Device.GetNetworkDefaultGatewayResponse{}
+	if err = ptz.ParseResponse(resp, &gateway); err != nil {
+		return nil, errors.Wrap(err, "GetNetworkDefaultGateway err")
+	}
+	info.Gateway = append([]string{}, gateway.NetworkGateway.IPv4Address...)
+
+	resp, err = camera.Device_GetDNS()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetDNS err")
+	}
+	dns := Device.GetDNSResponse{}
+	if err = ptz.ParseResponse(resp, &dns); err != nil {
+		return nil, errors.Wrap(err, "GetDNS err")
+	}
+	info.DNS = DNSInfo{FromDHCP: bool(dns.DNSInformation.FromDHCP), Servers: []string{}, SearchDomain: dns.DNSInformation.SearchDomain}
+	servers := dns.DNSInformation.DNSManual
+	if info.DNS.FromDHCP {
+		servers = dns.DNSInformation.DNSFromDHCP
+	}
+	for _, server := range servers {
+		if server.IPv4Address != "" {
+			info.DNS.Servers = append(info.DNS.Servers, server.IPv4Address)
+		} else if server.IPv6Address != "" {
+			info.DNS.Servers = append(info.DNS.Servers, server.IPv6Address)
+		}
+	}
+
+	hostname, err := getHostname(camera)
+	if err != nil {
+		return nil, err
+	}
+	info.Hostname = *hostname
+
+	protocols, err := getNetworkProtocols(camera)
+	if err != nil {
+		return nil, err
+	}
+	info.Protocols = protocols
+	return info, nil
+}
+
+func getHostname(camera *ptz.Camera) (*HostnameInfo, error) {
+	resp, err := camera.Device_GetHostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetHostname err")
+	}
+	res := Device.GetHostnameResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, errors.Wrap(err, "GetHostname err")
+	}
+	return &HostnameInfo{FromDHCP: bool(res.HostnameInformation.FromDHCP), Name: string(res.HostnameInformation.Name)}, nil
+}
+
+func getNetworkInterfaces(camera *ptz.Camera) ([]NetworkInterface, error) {
+	resp, err := camera.Device_GetNetworkInterfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNetworkInterfaces err")
+	}
+	res := Device.GetNetworkInterfacesResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, errors.Wrap(err, "GetNetworkInterfaces err")
+	}
+	interfaces := make([]NetworkInterface, 0, len(res.NetworkInterfaces))
+	for _, n := range res.NetworkInterfaces {
+		ni := NetworkInterface{
+			Token:     n.Token,
+			Name:      n.Info.Name,
+			HwAddress: n.Info.HwAddress,
+			Enabled:   bool(n.Enabled),
+			DHCP:      bool(n.IPv4.Config.DHCP),
+			MTU:       n.Info.MTU,
+		}
+		address := n.IPv4.Config.FromDHCP
+		if !ni.DHCP && len(n.IPv4.Config.Manual) > 0 {
+			address = n.IPv4.Config.Manual[0]
+		}
+		ni.Address = address.Address
+		ni.PrefixLength = address.PrefixLength
+		interfaces = append(interfaces, ni)
+	}
+	return interfaces, nil
+}
+
+func getNetworkProtocols(camera *ptz.Camera) ([]NetworkProtocol, error) {
+	resp, err := camera.Device_GetNetworkProtocols()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNetworkProtocols err")
+	}
+	res := Device.GetNetworkProtocolsResponse{}
+	if err = ptz.ParseResponse(resp, &res); err != nil {
+		return nil, errors.Wrap(err, "GetNetworkProtocols err")
+	}
+	protocols := make([]NetworkProtocol, 0, len(res.NetworkProtocols))
+	for _, p := range res.NetworkProtocols {
+		protocol := NetworkProtocol{Name: p.Name, Enabled: bool(p.Enabled)}
+		if len(p.Port) > 0 {
+			protocol.Port = p.Port[0]
+		}
+		protocols = append(protocols, protocol)
+	}
+	return protocols, nil
+}
+
+// 设置网卡地址，value为{"dhcp":false,"address":"192.168.1.70","prefix_length":24,"gateway":"192.168.1.1"}，
+// 地址变化后更新网关保存的摄像头地址。切换到DHCP时address必须为DHCP将分配的地址（如DHCP保留地址），否则网关会失去摄像头
+func DeviceSetNetworkInterface(value interface{}, commandID string) error {
+	cmd := NetworkInterface{}
+	if err := decodeDesired(value, &cmd); err != nil {
+		return errors.Wrap(err, "decode network interface err")
+	}
+	if cmd.DHCP && cmd.Address == "" {
+		return errors.New("address assigned by dhcp is required, the gateway can not find the camera otherwise")
+	}
+	if ip := net.ParseIP(cmd.Address); ip == nil || ip.To4() == nil {
+		return errors.Errorf("invalid ipv4 address %s", cmd.Address)
+	}
+	if !cmd.DHCP {
+		if cmd.PrefixLength == 0 {
+			cmd.PrefixLength = defaultPrefixLength
+		}
+		if cmd.PrefixLength < 1 || cmd.PrefixLength > 32 {
+			return errors.Errorf("invalid prefix length %d", cmd.PrefixLength)
+		}
+	}
+
+	camera := newCamera()
+	if cmd.Token == "" {
+		interfaces, err := getNetworkInterfaces(camera)
+		if err != nil {
+			return err
+		}
+		if len(interfaces) == 0 {
+			return errors.New("camera has no network interface")
+		}
+		cmd.Token = interfaces[0].Token
+	}
+
+	// 先设置网关，修改地址后旧地址可能无法访问
+	if cmd.Gateway != "" && !cmd.DHCP {
+		resp, err := camera.Device_SetNetworkDefaultGateway([]onvif.IPv4Address{onvif.IPv4Address(cmd.Gateway)})
+		if err != nil {
+			return errors.Wrap(err, "SetNetworkDefaultGateway err")
+		}
+		if err = ptz.ParseResponse(resp, &Device.SetNetworkDefaultGatewayResponse{}); err != nil {
+			return errors.Wrap(err, "SetNetworkDefaultGateway err")
+		}
+	}
+
+	ipv4 := &Device.IPv4NetworkInterfaceSetConfiguration{Enabled: true, DHCP: xsd.Boolean(cmd.DHCP)}
+	if !cmd.DHCP {
+		ipv4.Manual = []onvif.PrefixedIPv4Address{{Address: onvif.IPv4Address(cmd.Address), PrefixLength: xsd.Int(cmd.PrefixLength)}}
+	}
+	audit(SetNetworkInterface, "requested", commandID, cmd)
+	resp, err := camera.Device_SetNetworkInterfaces(cmd.Token, Device.NetworkInterfaceSetConfiguration{Enabled: true, MTU: cmd.MTU, IPv4: ipv4})
+
+	_, host, _ := splitCameraAddr(config.CameraAddr())
+	addressChanged := cmd.Address != host
+	rebootNeeded := false
+	switch {
+	case err != nil && addressChanged:
+		// 摄像头可能在应答前就切换了地址，按新地址继续检测
+		logrus.WithError(err).Warn("SetNetworkInterfaces no response, check the new address")
+	case err != nil:
+		audit(SetNetworkInterface, "failed", commandID, err.Error())
+		return errors.Wrap(err, "SetNetworkInterfaces err")
+	default:
+		res := Device.SetNetworkInterfacesResponse{}
+		if err = ptz.ParseResponse(resp, &res); err != nil {
+			audit(SetNetworkInterface, "failed", commandID, err.Error())
+			return errors.Wrap(err, "SetNetworkInterfaces err")
+		}
+		rebootNeeded = bool(res.RebootNeeded)
+	}
+	audit(SetNetworkInterface, "executed", commandID, map[string]interface{}{"reboot_needed": rebootNeeded, "address_changed": addressChanged})
+
+	switch {
+	case addressChanged:
+		go followAddressChange(SetNetworkInterface, cameraAddrWith(cmd.Address, ""), rebootNeeded, commandID)
+	default:
+		applyNetworkChange(SetNetworkInterface, rebootNeeded, commandID)
+	}
+	return nil
+}
+
+// 设置DNS，value为{"from_dhcp":false,"servers":["8.8.8.8"],"search_domain":[]}
+func DeviceSetDNS(value interface{}) error {
+	dns := DNSInfo{}
+	if err := decodeDesired(value, &dns); err != nil {
+		return errors.Wrap(err, "decode dns err")
+	}
+	if !dns.FromDHCP && len(dns.Servers) == 0 {
+		return errors.New("dns servers are required")
+	}
+	servers := make([]onvif.IPAddress, 0, len(dns.Servers))
+	for _, server := range dns.Servers {
+		ip := net.ParseIP(strings.TrimSpace(server))
+		switch {
+		case ip == nil:
+			return errors.Errorf("invalid dns server %s", server)
+		case ip.To4() != nil:
+			servers = append(servers, onvif.IPAddress{Type: "IPv4", IPv4Address: onvif.IPv4Address(ip.String())})
+		default:
+			servers = append(servers, onvif.IPAddress{Type: "IPv6", IPv6Address: onvif.IPv6Address(ip.String())})
+		}
+	}
+	searchDomain := make([]xsd.Token, 0, len(dns.SearchDomain))
+	for _, domain := range dns.SearchDomain {
+		searchDomain = append(searchDomain, xsd.Token(domain))
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_SetDNS(dns.FromDHCP, searchDomain, servers)
+	if err != nil {
+		return errors.Wrap(err, "SetDNS err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.SetDNSResponse{}); err != nil {
+		return errors.Wrap(err, "SetDNS err")
+	}
+	return DeviceGetNetwork()
+}
+
+// 设置主机名，value为主机名或{"from_dhcp":true}
+func DeviceSetHostname(value interface{}, commandID string) error {
+	hostname := HostnameInfo{}
+	switch v := value.(type) {
+	case string:
+		hostname.Name = v
+	default:
+		if err := decodeDesired(value, &hostname); err != nil {
+			return errors.Wrap(err, "decode hostname err")
+		}
+	}
+
+	camera := newCamera()
+	if hostname.FromDHCP {
+		resp, err := camera.Device_SetHostnameFromDHCP(true)
+		if err != nil {
+			return errors.Wrap(err, "SetHostnameFromDHCP err")
+		}
+		res := Device.SetHostnameFromDHCPResponse{}
+		if err = ptz.ParseResponse(resp, &res); err != nil {
+			return errors.Wrap(err, "SetHostnameFromDHCP err")
+		}
+		applyNetworkChange(SetHostname, bool(res.RebootNeeded), commandID)
+		return nil
+	}
+
+	if hostname.Name == "" {
+		return errors.New("hostname is required")
+	}
+	resp, err := camera.Device_SetHostname(hostname.Name)
+	if err != nil {
+		return errors.Wrap(err, "SetHostname err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.SetHostnameResponse{}); err != nil {
+		return errors.Wrap(err, "SetHostname err")
+	}
+	return DeviceGetNetwork()
+}
+
+// 设置网络协议端口，value为[{"name":"HTTP","enabled":true,"port":80}]，HTTP端口变化后更新网关保存的摄像头地址
+func DeviceSetNetworkProtocols(value interface{}, commandID string) error {
+	var protocols []NetworkProtocol
+	if err := decodeDesired(value, &protocols); err != nil {
+		return errors.Wrap(err, "decode network protocols err")
+	}
+	if len(protocols) == 0 {
+		return errors.New("network protocols are required")
+	}
+
+	scheme, _, port := splitCameraAddr(config.CameraAddr())
+	newPort := ""
+	settings := make([]onvif.NetworkProtocol, 0, len(protocols))
+	for _, p := range protocols {
+		p.Name = strings.ToUpper(p.Name)
+		switch p.Name {
+		case "HTTP", "HTTPS", "RTSP":
+		default:
+			return errors.Errorf("unknown network protocol %s", p.Name)
+		}
+		if p.Enabled && (p.Port <= 0 || p.Port > 65535) {
+			return errors.Errorf("invalid %s port %d", p.Name, p.Port)
+		}
+		// 网关访问摄像头使用的协议不能关闭
+		if strings.ToLower(p.Name) == scheme {
+			if !p.Enabled {
+				return errors.Errorf("%s is used by the gateway", p.Name)
+			}
+			if strconv.Itoa(p.Port) != port {
+				newPort = strconv.Itoa(p.Port)
+			}
+		}
+		settings = append(settings, onvif.NetworkProtocol{
+			Name:    onvif.NetworkProtocolType(p.Name),
+			Enabled: xsd.Boolean(p.Enabled),
+			Port:    xsd.Int(p.Port),
+		})
+	}
+
+	camera := newCamera()
+	audit(SetNetworkProtocols, "requested", commandID, protocols)
+	resp, err := camera.Device_SetNetworkProtocols(settings)
+	switch {
+	case err != nil && newPort != "":
+		logrus.WithError(err).Warn("SetNetworkProtocols no response, check the new port")
+	case err != nil:
+		audit(SetNetworkProtocols, "failed", commandID, err.Error())
+		return errors.Wrap(err, "SetNetworkProtocols err")
+	default:
+		if err = ptz.ParseResponse(resp, &Device.SetNetworkProtocolsResponse{}); err != nil {
+			audit(SetNetworkProtocols, "failed", commandID, err.Error())
+			return errors.Wrap(err, "SetNetworkProtocols err")
+		}
+	}
+	audit(SetNetworkProtocols, "executed", commandID, protocols)
+
+	if newPort != "" {
+		go followAddressChange(SetNetworkProtocols, cameraAddrWith("", newPort), false, commandID)
+		return nil
+	}
+	return DeviceGetNetwork()
+}
+
+// 需要重启时重启摄像头并跟踪恢复，否则直接上报新的网络配置
+func applyNetworkChange(action string, rebootNeeded bool, commandID string) {
+	if !rebootNeeded {
+		if err := DeviceGetNetwork(); err != nil {
+			logrus.WithError(err).Error("report network error")
+		}
+		return
+	}
+	if err := rebootCamera(action, commandID); err != nil {
+		logrus.WithError(err).Error("reboot camera error")
+		return
+	}
+	go func() {
+		trackRecovery(action, time.Now())
+		if err := DeviceGetNetwork(); err != nil {
+			logrus.WithError(err).Error("report network error")
+		}
+	}()
+}
+
+// 网络配置修改后重启摄像头使其生效
+func rebootCamera(action, commandID string) error {
+	camera := newCamera()
+	resp, err := camera.Device_SystemReboot()
+	if err != nil {
+		audit(action, "reboot_failed", commandID, err.Error())
+		return errors.Wrap(err, "SystemReboot err")
+	}
+	if err = ptz.ParseResponse(resp, &Device.SystemRebootResponse{}); err != nil {
+		audit(action, "reboot_failed", commandID, err.Error())
+		return errors.Wrap(err, "SystemReboot err")
+	}
+	audit(action, "reboot", commandID, nil)
+	return nil
+}
+
+// 等待摄像头在新地址上线，上线后更新网关保存的摄像头地址
+func followAddressChange(action, addr string, rebootNeeded bool, commandID string) {
+	start := time.Now()
+	if rebootNeeded {
+		if err := rebootCamera(action, commandID); err != nil {
+			logrus.WithError(err).Error("reboot camera error")
+		}
+	}
+	if err := setCameraTLS(addr); err != nil {
+		logrus.WithError(err).Error("set camera tls error")
+	}
+
+	deadline := start.Add(onlineWaitTimeout)
+	for time.Now().Before(deadline) {
+		if cameraReachable(addr) {
+			old := config.CameraAddr()
+			updateCameraAddr(addr)
+			audit(action, "address_changed", commandID, map[string]interface{}{"from": old, "to": addr, "seconds": time.Since(start).Seconds()})
+			go HandleIntervalCheck("online(在线)", HandleInterval)
+			go ReportInventory()
+			if err := DeviceGetNetwork(); err != nil {
+				logrus.WithError(err).Error("report network error")
+			}
+			return
+		}
+		time.Sleep(recoveryInterval)
+	}
+	audit(action, "failed", commandID, fmt.Sprintf("camera is not reachable at %s", addr))
+	if cameraOnline() {
+		NewEntry(Fields{"did": did}).DownLink("camera still online at %s", config.CameraAddr())
+	}
+}
+
+// 更新网关保存的摄像头地址并写回配置文件
+func updateCameraAddr(addr string) {
+	goonvif.ResetEndpoints(config.CameraAddr())
+	goonvif.ResetEndpoints(addr)
+	config.SetCameraAddr(addr)
+	if err := config.Save("general.addr", addr); err != nil {
+		logrus.WithError(err).Error("save camera addr error")
+	}
+	NewEntry(Fields{"did": did, "addr": addr}).DownLink("camera address updated")
+}
+
+func cameraReachable(addr string) bool {
+	_, username, password := config.Camera()
+	dev, _ := goonvif.ProbeDevice(addr, username, password)
+	return dev != nil
+}
+
+// 拆分摄像头地址，addr可以带http(s)://前缀，没有端口时按协议使用默认端口
+func splitCameraAddr(addr string) (scheme, host, port string) {
+	scheme = "http"
+	if i := strings.Index(addr, "://"); i >= 0 {
+		scheme = addr[:i]
+		addr = addr[i+3:]
+	}
+	addr = strings.TrimRight(addr, "/")
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+		port = "80"
+		if scheme == "https" {
+			port = "443"
+		}
+	}
+	return scheme, host, port
+}
+
+// 替换当前摄像头地址的主机或端口，保留原来的格式
+func cameraAddrWith(host, port string) string {
+	addr := config.CameraAddr()
+	prefix := ""
+	if i := strings.Index(addr, "://"); i >= 0 {
+		prefix = addr[:i+3]
+	}
+	_, oldHost, oldPort := splitCameraAddr(addr)
+	if host == "" {
+		host = oldHost
+	}
+	if port == "" {
+		port = oldPort
+	}
+	return prefix + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,38 @@
+package camera
+
+import (
+	"camera/config"
+	"testing"
+)
+
+func TestSplitCameraAddr(t *testing.T) {
+	cases := []struct {
+		addr, scheme, host, port string
+	}{
+		{"192.168.1.64:80", "http", "192.168.1.64", "80"},
+		{"192.168.1.64", "http", "192.168.1.64", "80"},
+		{"http://192.168.1.64:8080/", "http", "192.168.1.64", "8080"},
+		{"https://192.168.1.64", "https", "192.168.1.64", "443"},
+		{"[fe80::1]:8000", "http", "fe80::1", "8000"},
+	}
+	for _, c := range cases {
+		scheme, host, port := splitCameraAddr(c.addr)
+		if scheme != c.scheme || host != c.host || port != c.port {
+			t.Errorf("splitCameraAddr(%q) = %s %s %s, want %s %s %s", c.addr, scheme, host, port, c.scheme, c.host, c.port)
+		}
+	}
+}
+
+func TestCameraAddrWith(t *testing.T) {
+	addr := config.CameraAddr()
+	defer config.SetCameraAddr(addr)
+
+	config.SetCameraAddr("https://192.168.1.64:8443")
+	if got := cameraAddrWith("192.168.1.65", ""); got != "https://192.168.1.65:8443" {
+		t.Errorf("cameraAddrWith host = %s", got)
+	}
+	config.SetCameraAddr("192.168.1.64")
+	if got := cameraAddrWith("", "8080"); got != "192.168.1.64:8080" {
+		t.Errorf("cameraAddrWith port = %s", got)
+	}
+}
@@ -0,0 +1,150 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/goonvif"
+	"camera/goonvif/Device"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// NTP配置
+type NTPInfo struct {
+	FromDHCP    bool     `json:"from_dhcp"`
+	Servers     []string `json:"servers"`
+	DHCPServers []string `json:"dhcp_servers,omitempty"`
+}
+
+// 摄像头时区，未配置时按网关本地时区生成POSIX时区，如东八区为CST-8
+func cameraTimeZone() string {
+	if config.C.General.TimeZone != "" {
+		return config.C.General.TimeZone
+	}
+	name, offset := time.Now().Zone()
+	if len(name) < 3 || strings.ContainsAny(name, "+-0123456789") {
+		name = "UTC"
+	}
+	// POSIX时区的偏移方向与UTC偏移相反
+	offset = -offset
+	sign := ""
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	tz := fmt.Sprintf("%s%s%d", name, sign, offset/3600)
+	if minute := offset % 3600 / 60; minute != 0 {
+		tz += fmt.Sprintf(":%02d", minute)
+	}
+	return tz
+}
+
+func networkHost(host string) onvif.NetworkHost {
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return onvif.NetworkHost{Type: "DNS", DNSname: onvif.DNSName(host)}
+	case ip.To4() != nil:
+		return onvif.NetworkHost{Type: "IPv4", IPv4Address: onvif.IPv4Address(host)}
+	default:
+		return onvif.NetworkHost{Type: "IPv6", IPv6Address: onvif.IPv6Address(host)}
+	}
+}
+
+func networkHostString(host Device.NetworkHost) string {
+	switch {
+	case host.IPv4Address != "":
+		return string(host.IPv4Address)
+	case host.IPv6Address != "":
+		return string(host.IPv6Address)
+	}
+	return string(host.DNSname)
+}
+
+// 获取NTP服务器
+func DeviceGetNTP() error {
+	camera := newCamera()
+	info, err := getNTPInfo(camera)
+	if err != nil {
+		return err
+	}
+	go handleResponse(*info, handleGetNTP)
+	return nil
+}
+
+func getNTPInfo(camera *ptz.Camera) (*NTPInfo, error) {
+	resp, err := camera.Device_GetNTP()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNTP err")
+	}
+	res := Device.GetNTPResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetNTP err")
+	}
+
+	info := &NTPInfo{FromDHCP: bool(res.NTPInformation.FromDHCP), Servers: []string{}}
+	for _, host := range res.NTPInformation.NTPManual {
+		info.Servers = append(info.Servers, networkHostString(host))
+	}
+	for _, host := range res.NTPInformation.NTPFromDHCP {
+		info.DHCPServers = append(info.DHCPServers, networkHostString(host))
+	}
+	return info, nil
+}
+
+// 设置NTP服务器，value为{"from_dhcp":false,"servers":["pool.ntp.org"]}
+func DeviceSetNTP(value interface{}) error {
+	info := NTPInfo{}
+	if err := decodeDesired(value, &info); err != nil {
+		return errors.Wrap(err, "decode ntp err")
+	}
+	if !info.FromDHCP && len(info.Servers) == 0 {
+		return errors.New("ntp servers are required")
+	}
+	hosts := make([]onvif.NetworkHost, 0, len(info.Servers))
+	for _, server := range info.Servers {
+		hosts = append(hosts, networkHost(strings.TrimSpace(server)))
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_SetNTP(info.FromDHCP, hosts)
+	if err != nil {
+		return errors.Wrap(err, "SetNTP err")
+	}
+	err = ptz.ParseResponse(resp, &Device.SetNTPResponse{})
+	if err != nil {
+		return errors.Wrap(err, "SetNTP err")
+	}
+	return DeviceGetNTP()
+}
+
+// 设置校时方式，value为"NTP"或"Manual"，Manual时使用网关时间校准
+func DeviceSetDateTimeType(value interface{}) error {
+	dateTimeType, _ := value.(string)
+	switch strings.ToLower(dateTimeType) {
+	case "manual":
+		return DeviceSetSystemDateAndTime()
+	case "ntp":
+	default:
+		return errors.Errorf("unknown date time type %v", value)
+	}
+
+	camera := newCamera()
+	timeZone := onvif.TimeZone{TZ: xsd.Token(cameraTimeZone())}
+	resp, err := camera.Device_SetSystemDateAndTimeNTP(false, timeZone)
+	if err != nil {
+		return errors.Wrap(err, "SetSystemDateAndTime err")
+	}
+	err = ptz.ParseResponse(resp, &Device.SetSystemDateAndTimeResponse{})
+	if err != nil {
+		return errors.Wrap(err, "SetSystemDateAndTime err")
+	}
+	goonvif.ResetTimeOffset(config.CameraAddr())
+	return DeviceGetNTP()
+}
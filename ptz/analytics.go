@@ -0,0 +1,80 @@
+package ptz
+
+import (
+	"camera/goonvif/Analytics"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"net/http"
+)
+
+//获取支持的规则类型
+func (c *Camera) Analytics_GetSupportedRules(token onvif.ReferenceToken) (*http.Response, error) {
+	GetSupportedRules := Analytics.GetSupportedRules{ConfigurationToken: token}
+	return c.Call(GetSupportedRules)
+}
+
+//获取规则参数约束
+func (c *Camera) Analytics_GetRuleOptions(token onvif.ReferenceToken, ruleType string) (*http.Response, error) {
+	GetRuleOptions := Analytics.GetRuleOptions{ConfigurationToken: token, RuleType: xsd.QName(ruleType)}
+	return c.Call(GetRuleOptions)
+}
+
+//获取规则
+func (c *Camera) Analytics_GetRules(token onvif.ReferenceToken) (*http.Response, error) {
+	GetRules := Analytics.GetRules{ConfigurationToken: token}
+	return c.Call(GetRules)
+}
+
+//创建规则
+func (c *Camera) Analytics_CreateRules(token onvif.ReferenceToken, rule onvif.Config) (*http.Response, error) {
+	CreateRules := Analytics.CreateRules{ConfigurationToken: token, Rule: rule}
+	return c.Call(CreateRules)
+}
+
+//修改规则
+func (c *Camera) Analytics_ModifyRules(token onvif.ReferenceToken, rule onvif.Config) (*http.Response, error) {
+	ModifyRules := Analytics.ModifyRules{ConfigurationToken: token, Rule: rule}
+	return c.Call(ModifyRules)
+}
+
+//删除规则
+func (c *Camera) Analytics_DeleteRules(token onvif.ReferenceToken, ruleName string) (*http.Response, error) {
+	DeleteRules := Analytics.DeleteRules{ConfigurationToken: token, RuleName: xsd.String(ruleName)}
+	return c.Call(DeleteRules)
+}
+
+//获取支持的分析模块
+func (c *Camera) Analytics_GetSupportedAnalyticsModules(token onvif.ReferenceToken) (*http.Response, error) {
+	GetSupportedAnalyticsModules := Analytics.GetSupportedAnalyticsModules{ConfigurationToken: token}
+	return c.Call(GetSupportedAnalyticsModules)
+}
+
+//获取分析模块参数约束
+func (c *Camera) Analytics_GetAnalyticsModuleOptions(token onvif.ReferenceToken, moduleType string) (*http.Response, error) {
+	GetAnalyticsModuleOptions := Analytics.GetAnalyticsModuleOptions{ConfigurationToken: token, Type: xsd.QName(moduleType)}
+	return c.Call(GetAnalyticsModuleOptions)
+}
+
+//获取分析模块
+func (c *Camera) Analytics_GetAnalyticsModules(token onvif.ReferenceToken) (*http.Response, error) {
+	GetAnalyticsModules := Analytics.GetAnalyticsModules{ConfigurationToken: token}
+	return c.Call(GetAnalyticsModules)
+}
+
+//创建分析模块
+func (c *Camera) Analytics_CreateAnalyticsModules(token onvif.ReferenceToken, module onvif.Config) (*http.Response, error) {
+	CreateAnalyticsModules := Analytics.CreateAnalyticsModules{ConfigurationToken: token, AnalyticsModule: module}
+	return c.Call(CreateAnalyticsModules)
+}
+
+//修改分析模块
+func (c *Camera) Analytics_ModifyAnalyticsModules(token onvif.ReferenceToken, module onvif.Config) (*http.Response, error) {
+	ModifyAnalyticsModules := Analytics.ModifyAnalyticsModules{ConfigurationToken: token, AnalyticsModule: module}
+	return c.Call(ModifyAnalyticsModules)
+}
+
+//删除分析模块
+func (c *Camera) Analytics_DeleteAnalyticsModules(token onvif.ReferenceToken, moduleName string) (*http.Response, error) {
+	DeleteAnalyticsModules := Analytics.DeleteAnalyticsModules{ConfigurationToken: token, AnalyticsModuleName: xsd.String(moduleName)}
+	return c.Call(DeleteAnalyticsModules)
+}
@@ -7,7 +7,11 @@ import (
 	"encoding/xml"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
 func ReadResponse(resp *http.Response) (string, error) {
@@ -25,20 +29,78 @@ func GetSoapMessage(resp *http.Response) (string, error) {
 		log.Error(err)
 		return "", err
 	}
-	body := gosoap.SoapMessage(string(b)).Body()
+	body, err := gosoap.SoapMessage(string(b)).Body()
+	if err != nil {
+		//不是soap消息时返回原始内容，便于记录错误
+		return string(b), err
+	}
 	return body, nil
 }
 
+//解析应答，摄像头返回Fault或非2xx应答时返回*Fault
 func ParseResponse(resp *http.Response, v interface{}) error {
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	body := gosoap.SoapMessage(string(b)).Body()
+	return parseBody(resp, b, v)
+}
+
+//解析soap body，摄像头返回Fault或非2xx应答时返回*Fault
+func parseBody(resp *http.Response, b []byte, v interface{}) error {
+	body, err := gosoap.SoapMessage(string(b)).Body()
+	if ferr := checkFault(resp, body); ferr != nil {
+		return ferr
+	}
+	if err != nil {
+		return err
+	}
 	return xml.Unmarshal([]byte(body), v)
 }
 
+//解析可能带MTOM附件的应答，返回以Content-ID为key的附件，非multipart应答时与ParseResponse相同
+func ParseResponseWithAttachments(resp *http.Response, v interface{}) (map[string][]byte, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, ParseResponse(resp, v)
+	}
+	defer resp.Body.Close()
+
+	start := strings.Trim(params["start"], "<>")
+	var soap []byte
+	attachments := make(map[string][]byte)
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		b, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		//没有start参数时第一个part是soap消息
+		if soap == nil && (id == start || start == "") {
+			soap = b
+			continue
+		}
+		attachments[id] = b
+	}
+	return attachments, parseBody(resp, soap, v)
+}
+
+//按xop:Include的href(cid:xxx)查找附件
+func Attachment(attachments map[string][]byte, href string) ([]byte, bool) {
+	id := strings.TrimPrefix(href, "cid:")
+	if unescaped, err := url.QueryUnescape(id); err == nil {
+		id = unescaped
+	}
+	b, ok := attachments[id]
+	return b, ok
+}
+
 type Camera struct {
 	Addr     string // 192.168.1.64:80
 	Username string // admin
@@ -47,16 +109,23 @@ type Camera struct {
 
 func (c *Camera) Call(method interface{}) (*http.Response, error) {
 	//Getting an camera instance
-	dev, err := goonvif.NewDevice(c.Addr)
+	dev, err := goonvif.NewDeviceWithAuth(c.Addr, c.Username, c.Password)
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
-	//Authorization
-	dev.Authenticate(c.Username, c.Password)
 	return dev.CallMethod(method)
 }
 
+func (c *Camera) CallWithAttachment(method interface{}, contentID, contentType string, attachment []byte) (*http.Response, error) {
+	dev, err := goonvif.NewDeviceWithAuth(c.Addr, c.Username, c.Password)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	return dev.CallMethodWithAttachment(method, contentID, contentType, attachment)
+}
+
 func (c *Camera) GetProfiles() (*Media.GetProfilesResponse, error) {
 	getProfiles := Media.GetProfiles{}
 	res, err := c.Call(getProfiles)
@@ -46,7 +46,7 @@ func (c *Camera) Device_SetSystemDateAndTime(dateTimeType onvif.SetDateTimeType,
 		DateTimeType:    dateTimeType,
 		DaylightSavings: daylightSavings,
 		TimeZone:        timeZone,
-		UTCDateTime: onvif.DateTime{
+		UTCDateTime: &onvif.DateTime{
 			Time: onvif.Time{
 				Hour:   xsd.Int(now.Hour()),
 				Minute: xsd.Int(now.Minute()),
@@ -58,3 +58,334 @@ func (c *Camera) Device_SetSystemDateAndTime(dateTimeType onvif.SetDateTimeType,
 		}}
 	return c.Call(SetSystemDateAndTime)
 }
+
+//获取继电器输出
+func (c *Camera) Device_GetRelayOutputs() (*http.Response, error) {
+	GetRelayOutputs := Device.GetRelayOutputs{}
+	return c.Call(GetRelayOutputs)
+}
+
+//设置继电器模式
+func (c *Camera) Device_SetRelayOutputSettings(token onvif.ReferenceToken, settings onvif.RelayOutputSettings) (*http.Response, error) {
+	SetRelayOutputSettings := Device.SetRelayOutputSettings{RelayOutputToken: token, Properties: settings}
+	return c.Call(SetRelayOutputSettings)
+}
+
+//设置继电器状态
+func (c *Camera) Device_SetRelayOutputState(token onvif.ReferenceToken, state onvif.RelayLogicalState) (*http.Response, error) {
+	SetRelayOutputState := Device.SetRelayOutputState{RelayOutputToken: token, LogicalState: state}
+	return c.Call(SetRelayOutputState)
+}
+
+//重启
+func (c *Camera) Device_SystemReboot() (*http.Response, error) {
+	SystemReboot := Device.SystemReboot{}
+	return c.Call(SystemReboot)
+}
+
+//恢复出厂设置 Soft:保留网络参数 Hard:全部恢复
+func (c *Camera) Device_SetSystemFactoryDefault(factoryDefault onvif.FactoryDefaultType) (*http.Response, error) {
+	SetSystemFactoryDefault := Device.SetSystemFactoryDefault{FactoryDefault: factoryDefault}
+	return c.Call(SetSystemFactoryDefault)
+}
+
+//开始固件升级，返回固件上传地址
+func (c *Camera) Device_StartFirmwareUpgrade() (*http.Response, error) {
+	StartFirmwareUpgrade := Device.StartFirmwareUpgrade{}
+	return c.Call(StartFirmwareUpgrade)
+}
+
+//固件升级，固件以MTOM附件的方式上传
+func (c *Camera) Device_UpgradeSystemFirmware(firmware []byte) (*http.Response, error) {
+	contentID := "firmware"
+	UpgradeSystemFirmware := Device.UpgradeSystemFirmware{
+		Firmware: onvif.AttachmentData{
+			ContentType: "application/octet-stream",
+			Include:     onvif.Include{Href: xsd.AnyURI("cid:" + contentID)},
+		},
+	}
+	return c.CallWithAttachment(UpgradeSystemFirmware, contentID, "application/octet-stream", firmware)
+}
+
+//获取服务列表及版本
+func (c *Camera) Device_GetServices(includeCapability bool) (*http.Response, error) {
+	GetServices := Device.GetServices{IncludeCapability: xsd.Boolean(includeCapability)}
+	return c.Call(GetServices)
+}
+
+//获取用户列表
+func (c *Camera) Device_GetUsers() (*http.Response, error) {
+	GetUsers := Device.GetUsers{}
+	return c.Call(GetUsers)
+}
+
+//修改用户密码或级别
+func (c *Camera) Device_SetUser(user onvif.User) (*http.Response, error) {
+	SetUser := Device.SetUser{User: user}
+	return c.Call(SetUser)
+}
+
+//删除用户
+func (c *Camera) Device_DeleteUsers(username string) (*http.Response, error) {
+	DeleteUsers := Device.DeleteUsers{Username: xsd.String(username)}
+	return c.Call(DeleteUsers)
+}
+
+//切换为NTP校时，只设置时区
+func (c *Camera) Device_SetSystemDateAndTimeNTP(daylightSavings xsd.Boolean, timeZone onvif.TimeZone) (*http.Response, error) {
+	SetSystemDateAndTime := Device.SetSystemDateAndTime{
+		DateTimeType:    "NTP",
+		DaylightSavings: daylightSavings,
+		TimeZone:        timeZone,
+	}
+	return c.Call(SetSystemDateAndTime)
+}
+
+//获取NTP服务器
+func (c *Camera) Device_GetNTP() (*http.Response, error) {
+	GetNTP := Device.GetNTP{}
+	return c.Call(GetNTP)
+}
+
+//设置NTP服务器，fromDHCP为true时使用DHCP下发的服务器
+func (c *Camera) Device_SetNTP(fromDHCP bool, servers []onvif.NetworkHost) (*http.Response, error) {
+	SetNTP := Device.SetNTP{FromDHCP: xsd.Boolean(fromDHCP), NTPManual: servers}
+	return c.Call(SetNTP)
+}
+
+//获取存储配置(NAS/CIFS等)
+func (c *Camera) Device_GetStorageConfigurations() (*http.Response, error) {
+	GetStorageConfigurations := Device.GetStorageConfigurations{}
+	return c.Call(GetStorageConfigurations)
+}
+
+//创建存储配置
+func (c *Camera) Device_CreateStorageConfiguration(data Device.StorageConfigurationData) (*http.Response, error) {
+	CreateStorageConfiguration := Device.CreateStorageConfiguration{StorageConfiguration: data}
+	return c.Call(CreateStorageConfiguration)
+}
+
+//修改存储配置
+func (c *Camera) Device_SetStorageConfiguration(token string, data Device.StorageConfigurationData) (*http.Response, error) {
+	SetStorageConfiguration := Device.SetStorageConfiguration{
+		StorageConfiguration: Device.StorageConfiguration{
+			DeviceEntity: onvif.DeviceEntity{Token: onvif.ReferenceToken(token)},
+			Data:         data,
+		},
+	}
+	return c.Call(SetStorageConfiguration)
+}
+
+//删除存储配置
+func (c *Camera) Device_DeleteStorageConfiguration(token string) (*http.Response, error) {
+	DeleteStorageConfiguration := Device.DeleteStorageConfiguration{Token: onvif.ReferenceToken(token)}
+	return c.Call(DeleteStorageConfiguration)
+}
+
+//获取网卡配置
+func (c *Camera) Device_GetNetworkInterfaces() (*http.Response, error) {
+	GetNetworkInterfaces := Device.GetNetworkInterfaces{}
+	return c.Call(GetNetworkInterfaces)
+}
+
+//设置网卡配置，返回是否需要重启生效
+func (c *Camera) Device_SetNetworkInterfaces(token string, networkInterface Device.NetworkInterfaceSetConfiguration) (*http.Response, error) {
+	SetNetworkInterfaces := Device.SetNetworkInterfaces{InterfaceToken: onvif.ReferenceToken(token), NetworkInterface: networkInterface}
+	return c.Call(SetNetworkInterfaces)
+}
+
+//获取DNS
+func (c *Camera) Device_GetDNS() (*http.Response, error) {
+	GetDNS := Device.GetDNS{}
+	return c.Call(GetDNS)
+}
+
+//设置DNS
+func (c *Camera) Device_SetDNS(fromDHCP bool, searchDomain []xsd.Token, servers []onvif.IPAddress) (*http.Response, error) {
+	SetDNS := Device.SetDNS{FromDHCP: xsd.Boolean(fromDHCP), SearchDomain: searchDomain, DNSManual: servers}
+	return c.Call(SetDNS)
+}
+
+//获取默认网关
+func (c *Camera) Device_GetNetworkDefaultGateway() (*http.Response, error) {
+	GetNetworkDefaultGateway := Device.GetNetworkDefaultGateway{}
+	return c.Call(GetNetworkDefaultGateway)
+}
+
+//设置默认网关
+func (c *Camera) Device_SetNetworkDefaultGateway(gateways []onvif.IPv4Address) (*http.Response, error) {
+	SetNetworkDefaultGateway := Device.SetNetworkDefaultGateway{IPv4Address: gateways}
+	return c.Call(SetNetworkDefaultGateway)
+}
+
+//获取主机名
+func (c *Camera) Device_GetHostname() (*http.Response, error) {
+	GetHostname := Device.GetHostname{}
+	return c.Call(GetHostname)
+}
+
+//设置主机名
+func (c *Camera) Device_SetHostname(name string) (*http.Response, error) {
+	SetHostname := Device.SetHostname{Name: xsd.Token(name)}
+	return c.Call(SetHostname)
+}
+
+//设置是否从DHCP获取主机名
+func (c *Camera) Device_SetHostnameFromDHCP(fromDHCP bool) (*http.Response, error) {
+	SetHostnameFromDHCP := Device.SetHostnameFromDHCP{FromDHCP: xsd.Boolean(fromDHCP)}
+	return c.Call(SetHostnameFromDHCP)
+}
+
+//获取网络协议端口(HTTP/HTTPS/RTSP)
+func (c *Camera) Device_GetNetworkProtocols() (*http.Response, error) {
+	GetNetworkProtocols := Device.GetNetworkProtocols{}
+	return c.Call(GetNetworkProtocols)
+}
+
+//设置网络协议端口
+func (c *Camera) Device_SetNetworkProtocols(protocols []onvif.NetworkProtocol) (*http.Response, error) {
+	SetNetworkProtocols := Device.SetNetworkProtocols{NetworkProtocols: protocols}
+	return c.Call(SetNetworkProtocols)
+}
+
+//获取IP地址过滤规则
+func (c *Camera) Device_GetIPAddressFilter() (*http.Response, error) {
+	GetIPAddressFilter := Device.GetIPAddressFilter{}
+	return c.Call(GetIPAddressFilter)
+}
+
+//替换IP地址过滤规则
+func (c *Camera) Device_SetIPAddressFilter(filter onvif.IPAddressFilter) (*http.Response, error) {
+	SetIPAddressFilter := Device.SetIPAddressFilter{IPAddressFilter: filter}
+	return c.Call(SetIPAddressFilter)
+}
+
+//向IP地址过滤规则中添加地址
+func (c *Camera) Device_AddIPAddressFilter(filter onvif.IPAddressFilter) (*http.Response, error) {
+	AddIPAddressFilter := Device.AddIPAddressFilter{IPAddressFilter: filter}
+	return c.Call(AddIPAddressFilter)
+}
+
+//从IP地址过滤规则中删除地址
+func (c *Camera) Device_RemoveIPAddressFilter(filter onvif.IPAddressFilter) (*http.Response, error) {
+	RemoveIPAddressFilter := Device.RemoveIPAddressFilter{IPAddressFilter: filter}
+	return c.Call(RemoveIPAddressFilter)
+}
+
+//在摄像头上生成密钥对和自签名证书，notAfter为证书到期时间(xsd:dateTime)，为空时由摄像头决定
+func (c *Camera) Device_CreateCertificate(certificateID, subject, notAfter string) (*http.Response, error) {
+	CreateCertificate := Device.CreateCertificate{
+		CertificateID: xsd.Token(certificateID),
+		Subject:       subject,
+		ValidNotAfter: xsd.DateTime(notAfter),
+	}
+	return c.Call(CreateCertificate)
+}
+
+//获取摄像头的证书
+func (c *Camera) Device_GetCertificates() (*http.Response, error) {
+	GetCertificates := Device.GetCertificates{}
+	return c.Call(GetCertificates)
+}
+
+//获取证书的启用状态
+func (c *Camera) Device_GetCertificatesStatus() (*http.Response, error) {
+	GetCertificatesStatus := Device.GetCertificatesStatus{}
+	return c.Call(GetCertificatesStatus)
+}
+
+//启用或停用证书，启用的证书用于https
+func (c *Camera) Device_SetCertificatesStatus(certificateID string, enabled bool) (*http.Response, error) {
+	SetCertificatesStatus := Device.SetCertificatesStatus{CertificateStatus: onvif.CertificateStatus{
+		CertificateID: xsd.Token(certificateID),
+		Status:        xsd.Boolean(enabled),
+	}}
+	return c.Call(SetCertificatesStatus)
+}
+
+//用证书的密钥生成PKCS#10证书签名请求
+func (c *Camera) Device_GetPkcs10Request(certificateID, subject string) (*http.Response, error) {
+	GetPkcs10Request := Device.GetPkcs10Request{CertificateID: xsd.Token(certificateID), Subject: xsd.String(subject)}
+	return c.Call(GetPkcs10Request)
+}
+
+//上传签名后的证书，der为DER编码的证书
+func (c *Camera) Device_LoadCertificates(certificateID string, der []byte) (*http.Response, error) {
+	LoadCertificates := Device.LoadCertificates{NVTCertificate: onvif.Certificate{
+		CertificateID: xsd.Token(certificateID),
+		Certificate:   onvif.BinaryData{Data: xsd.Base64Binary("").NewBase64Binary(der)},
+	}}
+	return c.Call(LoadCertificates)
+}
+
+//获取摄像头的CA证书
+func (c *Camera) Device_GetCACertificates() (*http.Response, error) {
+	GetCACertificates := Device.GetCACertificates{}
+	return c.Call(GetCACertificates)
+}
+
+//上传CA证书，用于校验客户端证书
+func (c *Camera) Device_LoadCACertificates(certificateID string, der []byte) (*http.Response, error) {
+	LoadCACertificates := Device.LoadCACertificates{CACertificate: onvif.Certificate{
+		CertificateID: xsd.Token(certificateID),
+		Certificate:   onvif.BinaryData{Data: xsd.Base64Binary("").NewBase64Binary(der)},
+	}}
+	return c.Call(LoadCACertificates)
+}
+
+//获取是否要求客户端证书
+func (c *Camera) Device_GetClientCertificateMode() (*http.Response, error) {
+	GetClientCertificateMode := Device.GetClientCertificateMode{}
+	return c.Call(GetClientCertificateMode)
+}
+
+//设置是否要求客户端证书
+func (c *Camera) Device_SetClientCertificateMode(enabled bool) (*http.Response, error) {
+	SetClientCertificateMode := Device.SetClientCertificateMode{Enabled: xsd.Boolean(enabled)}
+	return c.Call(SetClientCertificateMode)
+}
+
+//获取系统日志，logType为System或Access
+func (c *Camera) Device_GetSystemLog(logType string) (*http.Response, error) {
+	GetSystemLog := Device.GetSystemLog{LogType: onvif.SystemLogType(logType)}
+	return c.Call(GetSystemLog)
+}
+
+//获取技术支持信息
+func (c *Camera) Device_GetSystemSupportInformation() (*http.Response, error) {
+	GetSystemSupportInformation := Device.GetSystemSupportInformation{}
+	return c.Call(GetSystemSupportInformation)
+}
+
+//获取系统日志、技术支持信息和备份的http下载地址
+func (c *Camera) Device_GetSystemUris() (*http.Response, error) {
+	GetSystemUris := Device.GetSystemUris{}
+	return c.Call(GetSystemUris)
+}
+
+//获取系统备份，备份文件以MTOM附件返回
+func (c *Camera) Device_GetSystemBackup() (*http.Response, error) {
+	GetSystemBackup := Device.GetSystemBackup{}
+	return c.Call(GetSystemBackup)
+}
+
+//开始系统恢复，返回备份文件上传地址
+func (c *Camera) Device_StartSystemRestore() (*http.Response, error) {
+	StartSystemRestore := Device.StartSystemRestore{}
+	return c.Call(StartSystemRestore)
+}
+
+//系统恢复，备份文件以MTOM附件的方式上传
+func (c *Camera) Device_RestoreSystem(name string, backup []byte) (*http.Response, error) {
+	contentID := "backup"
+	RestoreSystem := Device.RestoreSystem{
+		BackupFiles: onvif.BackupFile{
+			Name: name,
+			Data: onvif.AttachmentData{
+				ContentType: "application/octet-stream",
+				Include:     onvif.Include{Href: xsd.AnyURI("cid:" + contentID)},
+			},
+		},
+	}
+	return c.CallWithAttachment(RestoreSystem, contentID, "application/octet-stream", backup)
+}
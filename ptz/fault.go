@@ -0,0 +1,70 @@
+package ptz
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+)
+
+//摄像头拒绝请求：返回了SOAP Fault或非2xx应答
+type Fault struct {
+	StatusCode int
+	Status     string
+	Code       string //如env:Sender/ter:InvalidArgVal/ter:NoUser
+	Reason     string
+}
+
+func (f *Fault) Error() string {
+	msg := "soap fault"
+	if f.Status != "" {
+		msg += ": " + f.Status
+	}
+	if f.Code != "" {
+		msg += " " + f.Code
+	}
+	if f.Reason != "" {
+		msg += " " + f.Reason
+	}
+	return msg
+}
+
+//SOAP 1.2和SOAP 1.1的Fault
+type soapFault struct {
+	XMLName xml.Name
+	Code    struct {
+		Value   string `xml:"Value"`
+		Subcode struct {
+			Value   string `xml:"Value"`
+			Subcode struct {
+				Value string `xml:"Value"`
+			} `xml:"Subcode"`
+		} `xml:"Subcode"`
+	} `xml:"Code"`
+	Reason struct {
+		Text []string `xml:"Text"`
+	} `xml:"Reason"`
+	FaultCode   string `xml:"faultcode"`
+	FaultString string `xml:"faultstring"`
+}
+
+//检查应答状态和soap body，body不是Fault且状态为2xx时返回nil
+func checkFault(resp *http.Response, body string) error {
+	fault := soapFault{}
+	if body != "" && xml.Unmarshal([]byte(body), &fault) == nil && fault.XMLName.Local == "Fault" {
+		codes := []string{}
+		for _, code := range []string{fault.Code.Value, fault.Code.Subcode.Value, fault.Code.Subcode.Subcode.Value, fault.FaultCode} {
+			if code = strings.TrimSpace(code); code != "" {
+				codes = append(codes, code)
+			}
+		}
+		reason := strings.TrimSpace(fault.FaultString)
+		if len(fault.Reason.Text) > 0 {
+			reason = strings.TrimSpace(fault.Reason.Text[0])
+		}
+		return &Fault{StatusCode: resp.StatusCode, Status: resp.Status, Code: strings.Join(codes, "/"), Reason: reason}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &Fault{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package ptz
+
+import (
+	"camera/goonvif/Device"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func response(status int, body string) *http.Response {
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: ioutil.NopCloser(strings.NewReader(body))}
+}
+
+const soap12Fault = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:ter="http://www.onvif.org/ver10/error"><env:Body><env:Fault>
+<env:Code><env:Value>env:Sender</env:Value><env:Subcode><env:Value>ter:InvalidArgVal</env:Value><env:Subcode><env:Value>ter:NoUser</env:Value></env:Subcode></env:Subcode></env:Code>
+<env:Reason><env:Text xml:lang="en">Username not recognized</env:Text></env:Reason>
+</env:Fault></env:Body></env:Envelope>`
+
+func TestParseResponseFault(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest, http.StatusInternalServerError} {
+		err := ParseResponse(response(status, soap12Fault), &Device.SetUserResponse{})
+		fault, ok := err.(*Fault)
+		if !ok {
+			t.Fatalf("status %d: err = %v, want *Fault", status, err)
+		}
+		if fault.Code != "env:Sender/ter:InvalidArgVal/ter:NoUser" || fault.Reason != "Username not recognized" {
+			t.Errorf("status %d: fault = %+v", status, fault)
+		}
+	}
+}
+
+func TestParseResponseSOAP11Fault(t *testing.T) {
+	body := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault><faultcode>s:Client</faultcode><faultstring>Action not supported</faultstring></s:Fault></s:Body></s:Envelope>`
+	fault, ok := ParseResponse(response(http.StatusInternalServerError, body), &Device.SetUserResponse{}).(*Fault)
+	if !ok || fault.Code != "s:Client" || fault.Reason != "Action not supported" {
+		t.Errorf("fault = %+v", fault)
+	}
+}
+
+func TestParseResponseStatus(t *testing.T) {
+	err := ParseResponse(response(http.StatusUnauthorized, "<html><body>401 Unauthorized</body></html>"), &Device.SetUserResponse{})
+	if fault, ok := err.(*Fault); !ok || fault.StatusCode != http.StatusUnauthorized {
+		t.Errorf("err = %v, want 401 fault", err)
+	}
+}
+
+func TestParseResponseOK(t *testing.T) {
+	body := `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><tds:GetDeviceInformationResponse xmlns:tds="http://www.onvif.org/ver10/device/wsdl"><tds:Model>DS-2CD</tds:Model></tds:GetDeviceInformationResponse></env:Body></env:Envelope>`
+	res := Device.GetDeviceInformationResponse{}
+	if err := ParseResponse(response(http.StatusOK, body), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Model != "DS-2CD" {
+		t.Errorf("model = %q", res.Model)
+	}
+}
@@ -0,0 +1,24 @@
+package ptz
+
+import (
+	"camera/goonvif/Imaging"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"net/http"
+)
+
+//获取视频源的图像参数
+func (c *Camera) Imaging_GetImagingSettings(videoSourceToken onvif.ReferenceToken) (*http.Response, error) {
+	GetImagingSettings := Imaging.GetImagingSettings{VideoSourceToken: videoSourceToken}
+	return c.Call(GetImagingSettings)
+}
+
+//设置视频源的图像参数，只修改settings中设置的值
+func (c *Camera) Imaging_SetImagingSettings(videoSourceToken onvif.ReferenceToken, settings Imaging.ImagingSettingsData) (*http.Response, error) {
+	SetImagingSettings := Imaging.SetImagingSettings{
+		VideoSourceToken: videoSourceToken,
+		ImagingSettings:  settings,
+		ForcePersistence: xsd.Boolean(true),
+	}
+	return c.Call(SetImagingSettings)
+}
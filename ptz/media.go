@@ -33,3 +33,18 @@ func (c *Camera) Media_GetSnapshotUri(token onvif.ReferenceToken) (*http.Respons
 	SnapshotUri := Media.GetSnapshotUri{ProfileToken: token}
 	return c.Call(SnapshotUri)
 }
+
+func (c *Camera) Media_GetVideoAnalyticsConfigurations() (*http.Response, error) {
+	GetVideoAnalyticsConfigurations := Media.GetVideoAnalyticsConfigurations{}
+	return c.Call(GetVideoAnalyticsConfigurations)
+}
+
+func (c *Camera) Media_GetVideoEncoderConfigurations() (*http.Response, error) {
+	GetVideoEncoderConfigurations := Media.GetVideoEncoderConfigurations{}
+	return c.Call(GetVideoEncoderConfigurations)
+}
+
+func (c *Camera) Media_GetVideoSources() (*http.Response, error) {
+	GetVideoSources := Media.GetVideoSources{}
+	return c.Call(GetVideoSources)
+}
@@ -0,0 +1,116 @@
+package ptz
+
+import (
+	"camera/goonvif"
+	"camera/goonvif/Media2"
+	"camera/goonvif/xsd/onvif"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+//摄像头是否提供Media2服务
+func (c *Camera) SupportsMedia2() bool {
+	dev, err := goonvif.NewDeviceWithAuth(c.Addr, c.Username, c.Password)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+	return dev.GetEndpoint(goonvif.Xlmns["tr2"]) != ""
+}
+
+func (c *Camera) Media2_GetProfiles() (*Media2.GetProfilesResponse, error) {
+	getProfiles := Media2.GetProfiles{Type: []string{"All"}}
+	res, err := c.Call(getProfiles)
+	if err != nil {
+		log.WithError(err).Error("Media2 GetProfiles Call Error")
+		return nil, err
+	}
+	getProfilesResponse := &Media2.GetProfilesResponse{}
+	err = ParseResponse(res, getProfilesResponse)
+	if err != nil {
+		log.WithError(err).Error("Media2 GetProfiles ParseResponse Error")
+		return nil, err
+	}
+	return getProfilesResponse, nil
+}
+
+//protocol为RtspUnicast/RtspMulticast/RTSP/RtspOverHttp
+func (c *Camera) Media2_GetStreamUri(protocol string, token onvif.ReferenceToken) (*http.Response, error) {
+	StreamUri := Media2.GetStreamUri{Protocol: protocol, ProfileToken: token}
+	return c.Call(StreamUri)
+}
+
+func (c *Camera) Media2_GetSnapshotUri(token onvif.ReferenceToken) (*http.Response, error) {
+	SnapshotUri := Media2.GetSnapshotUri{ProfileToken: token}
+	return c.Call(SnapshotUri)
+}
+
+//获取视频编码配置，token为空时返回全部配置
+func (c *Camera) Media2_GetVideoEncoderConfigurations(token onvif.ReferenceToken) (*http.Response, error) {
+	GetVideoEncoderConfigurations := Media2.GetVideoEncoderConfigurations{ConfigurationToken: token}
+	return c.Call(GetVideoEncoderConfigurations)
+}
+
+//修改视频编码配置
+func (c *Camera) Media2_SetVideoEncoderConfiguration(configuration Media2.VideoEncoder2ConfigurationData) (*http.Response, error) {
+	SetVideoEncoderConfiguration := Media2.SetVideoEncoderConfiguration{Configuration: configuration}
+	return c.Call(SetVideoEncoderConfiguration)
+}
+
+//获取视频编码参数约束，每种编码方式一组
+func (c *Camera) Media2_GetVideoEncoderConfigurationOptions(token onvif.ReferenceToken) (*http.Response, error) {
+	GetVideoEncoderConfigurationOptions := Media2.GetVideoEncoderConfigurationOptions{ConfigurationToken: token}
+	return c.Call(GetVideoEncoderConfigurationOptions)
+}
+
+//获取隐私遮挡，configurationToken为视频源配置
+func (c *Camera) Media2_GetMasks(configurationToken onvif.ReferenceToken) (*http.Response, error) {
+	GetMasks := Media2.GetMasks{ConfigurationToken: configurationToken}
+	return c.Call(GetMasks)
+}
+
+func (c *Camera) Media2_GetMaskOptions(configurationToken onvif.ReferenceToken) (*http.Response, error) {
+	GetMaskOptions := Media2.GetMaskOptions{ConfigurationToken: configurationToken}
+	return c.Call(GetMaskOptions)
+}
+
+func (c *Camera) Media2_CreateMask(mask Media2.Mask) (*http.Response, error) {
+	CreateMask := Media2.CreateMask{Mask: mask}
+	return c.Call(CreateMask)
+}
+
+func (c *Camera) Media2_SetMask(mask Media2.Mask) (*http.Response, error) {
+	SetMask := Media2.SetMask{Mask: mask}
+	return c.Call(SetMask)
+}
+
+func (c *Camera) Media2_DeleteMask(token onvif.ReferenceToken) (*http.Response, error) {
+	DeleteMask := Media2.DeleteMask{Token: token}
+	return c.Call(DeleteMask)
+}
+
+//获取OSD，configurationToken为视频源配置
+func (c *Camera) Media2_GetOSDs(configurationToken onvif.ReferenceToken) (*http.Response, error) {
+	GetOSDs := Media2.GetOSDs{ConfigurationToken: configurationToken}
+	return c.Call(GetOSDs)
+}
+
+func (c *Camera) Media2_GetOSDOptions(configurationToken onvif.ReferenceToken) (*http.Response, error) {
+	GetOSDOptions := Media2.GetOSDOptions{ConfigurationToken: configurationToken}
+	return c.Call(GetOSDOptions)
+}
+
+func (c *Camera) Media2_CreateOSD(osd Media2.OSDConfiguration) (*http.Response, error) {
+	CreateOSD := Media2.CreateOSD{OSD: osd}
+	return c.Call(CreateOSD)
+}
+
+func (c *Camera) Media2_SetOSD(osd Media2.OSDConfiguration) (*http.Response, error) {
+	SetOSD := Media2.SetOSD{OSD: osd}
+	return c.Call(SetOSD)
+}
+
+func (c *Camera) Media2_DeleteOSD(token onvif.ReferenceToken) (*http.Response, error) {
+	DeleteOSD := Media2.DeleteOSD{OSDToken: token}
+	return c.Call(DeleteOSD)
+}
@@ -0,0 +1,68 @@
+package ptz
+
+import (
+	"camera/goonvif/Recording"
+	"camera/goonvif/Replay"
+	"camera/goonvif/Search"
+	"camera/goonvif/xsd/onvif"
+	"net/http"
+)
+
+//获取摄像头存储上的录像
+func (c *Camera) Recording_GetRecordings() (*http.Response, error) {
+	GetRecordings := Recording.GetRecordings{}
+	return c.Call(GetRecordings)
+}
+
+//获取录像概况
+func (c *Camera) Search_GetRecordingSummary() (*http.Response, error) {
+	GetRecordingSummary := Search.GetRecordingSummary{}
+	return c.Call(GetRecordingSummary)
+}
+
+//获取录像的时间范围和状态
+func (c *Camera) Search_GetRecordingInformation(token string) (*http.Response, error) {
+	GetRecordingInformation := Search.GetRecordingInformation{RecordingToken: token}
+	return c.Call(GetRecordingInformation)
+}
+
+//开始搜索录像，keepAlive为搜索会话的保持时间
+func (c *Camera) Search_FindRecordings(scope Search.SearchScope, maxMatches int, keepAlive string) (*http.Response, error) {
+	FindRecordings := Search.FindRecordings{Scope: scope, MaxMatches: maxMatches, KeepAliveTime: keepAlive}
+	return c.Call(FindRecordings)
+}
+
+func (c *Camera) Search_GetRecordingSearchResults(searchToken string, waitTime string) (*http.Response, error) {
+	GetRecordingSearchResults := Search.GetRecordingSearchResults{SearchToken: searchToken, WaitTime: waitTime}
+	return c.Call(GetRecordingSearchResults)
+}
+
+//开始搜索录像中的事件，start晚于end时倒序搜索
+func (c *Camera) Search_FindEvents(start, end string, scope Search.SearchScope, filter Search.EventFilter, maxMatches int, keepAlive string) (*http.Response, error) {
+	FindEvents := Search.FindEvents{
+		StartPoint:    start,
+		EndPoint:      end,
+		Scope:         scope,
+		SearchFilter:  filter,
+		MaxMatches:    maxMatches,
+		KeepAliveTime: keepAlive,
+	}
+	return c.Call(FindEvents)
+}
+
+func (c *Camera) Search_GetEventSearchResults(searchToken string, waitTime string) (*http.Response, error) {
+	GetEventSearchResults := Search.GetEventSearchResults{SearchToken: searchToken, WaitTime: waitTime}
+	return c.Call(GetEventSearchResults)
+}
+
+//结束搜索，释放摄像头的搜索会话
+func (c *Camera) Search_EndSearch(searchToken string) (*http.Response, error) {
+	EndSearch := Search.EndSearch{SearchToken: searchToken}
+	return c.Call(EndSearch)
+}
+
+//获取录像回放地址
+func (c *Camera) Replay_GetReplayUri(setup onvif.StreamSetup, recordingToken string) (*http.Response, error) {
+	GetReplayUri := Replay.GetReplayUri{StreamSetup: setup, RecordingToken: recordingToken}
+	return c.Call(GetReplayUri)
+}
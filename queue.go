@@ -0,0 +1,203 @@
+package camera
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize = 1000
+	defaultQueueTTL  = time.Hour * 24
+
+	queueFileExt = ".msg"
+)
+
+// 离线缓存的上行消息
+type queuedMessage struct {
+	Topic     string
+	Payload   []byte
+	CreatedAt time.Time
+	ExpireAt  time.Time
+}
+
+// MQTT断开时缓存上行消息的磁盘队列，每条消息一个gob文件，文件名为递增序号，重连后按序号重发
+type offlineQueue struct {
+	sync.Mutex
+	dir  string
+	size int
+	ttl  time.Duration
+	seqs []uint64 // 队列中的序号，从旧到新
+	next uint64
+
+	replaying bool
+}
+
+func newOfflineQueue(dir string, size int, ttl time.Duration) (*offlineQueue, error) {
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	if ttl <= 0 {
+		ttl = defaultQueueTTL
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "create queue dir err")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read queue dir err")
+	}
+	q := &offlineQueue{dir: dir, size: size, ttl: ttl}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), queueFileExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), queueFileExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		q.seqs = append(q.seqs, seq)
+	}
+	sort.Slice(q.seqs, func(i, j int) bool { return q.seqs[i] < q.seqs[j] })
+	if len(q.seqs) > 0 {
+		q.next = q.seqs[len(q.seqs)-1] + 1
+		logrus.WithField("messages", len(q.seqs)).Info("offline queue loaded")
+	}
+	return q, nil
+}
+
+func (q *offlineQueue) path(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, queueFileExt))
+}
+
+// 消息数量，调用时需要持有锁
+func (q *offlineQueue) len() int {
+	return len(q.seqs)
+}
+
+// 写入消息，超过容量时丢弃最旧的消息，调用时需要持有锁
+func (q *offlineQueue) push(topic string, payload []byte) error {
+	now := time.Now()
+	msg := queuedMessage{Topic: topic, Payload: payload, CreatedAt: now, ExpireAt: now.Add(q.ttl)}
+	seq := q.next
+	tmp := q.path(seq) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "write queue err")
+	}
+	err = gob.NewEncoder(f).Encode(msg)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, q.path(seq))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return errors.Wrap(err, "write queue err")
+	}
+	q.next++
+	q.seqs = append(q.seqs, seq)
+
+	for len(q.seqs) > q.size {
+		logrus.WithField("seq", q.seqs[0]).Warn("offline queue is full, drop the oldest message")
+		q.remove()
+	}
+	return nil
+}
+
+// 读取最旧的消息和序号，过期或损坏的消息直接删除，队列为空时返回nil，调用时需要持有锁
+func (q *offlineQueue) peek() (uint64, *queuedMessage) {
+	for len(q.seqs) > 0 {
+		f, err := os.Open(q.path(q.seqs[0]))
+		if err != nil {
+			logrus.WithError(err).Warn("read offline message error")
+			q.remove()
+			continue
+		}
+		msg := &queuedMessage{}
+		err = gob.NewDecoder(f).Decode(msg)
+		f.Close()
+		if err != nil {
+			logrus.WithError(err).Warn("decode offline message error")
+			q.remove()
+			continue
+		}
+		if time.Now().After(msg.ExpireAt) {
+			logrus.WithFields(logrus.Fields{"topic": msg.Topic, "created_at": msg.CreatedAt}).Warn("offline message expired")
+			q.remove()
+			continue
+		}
+		return q.seqs[0], msg
+	}
+	return 0, nil
+}
+
+// 删除最旧的消息，调用时需要持有锁
+func (q *offlineQueue) remove() {
+	if len(q.seqs) == 0 {
+		return
+	}
+	if err := os.Remove(q.path(q.seqs[0])); err != nil && !os.IsNotExist(err) {
+		logrus.WithError(err).Warn("remove offline message error")
+	}
+	q.seqs = q.seqs[1:]
+}
+
+// 重连后按顺序重发缓存的消息，发送失败时停止，等待下次重连或下次发送时重试
+func (b *Backend) replay() {
+	q := b.queue
+	if q == nil {
+		return
+	}
+	q.Lock()
+	if q.replaying {
+		q.Unlock()
+		return
+	}
+	q.replaying = true
+	q.Unlock()
+
+	sent := 0
+	for {
+		q.Lock()
+		seq, msg := q.peek()
+		if msg == nil {
+			// 在锁内清除标记，之后写入的消息由新的replay发送
+			q.replaying = false
+			q.Unlock()
+			break
+		}
+		q.Unlock()
+		if err := b.send(msg.Topic, msg.Payload); err != nil {
+			logrus.WithError(err).Error("replay offline message error")
+			q.Lock()
+			// 超时的消息由mqtt客户端继续投递，不再重发
+			if b.inFlight(err) && len(q.seqs) > 0 && q.seqs[0] == seq {
+				q.remove()
+			}
+			q.replaying = false
+			q.Unlock()
+			return
+		}
+		q.Lock()
+		// 发送期间队列已满时最旧的消息可能已被丢弃
+		if len(q.seqs) > 0 && q.seqs[0] == seq {
+			q.remove()
+		}
+		q.Unlock()
+		sent++
+	}
+	if sent > 0 {
+		logrus.WithField("messages", sent).Info("offline messages replayed")
+	}
+}
@@ -0,0 +1,138 @@
+package camera
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestQueue(t *testing.T, size int, ttl time.Duration) (*offlineQueue, string) {
+	dir, err := ioutil.TempDir("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := newOfflineQueue(dir, size, ttl)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return q, dir
+}
+
+func queueFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+queueFileExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestOfflineQueuePushPeek(t *testing.T) {
+	q, dir := newTestQueue(t, 10, time.Hour)
+	defer os.RemoveAll(dir)
+
+	for _, payload := range []string{"a", "b", "c"} {
+		if err := q.push("topic", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.len() != 3 || len(queueFiles(t, dir)) != 3 {
+		t.Fatalf("len = %d, files = %d, want 3", q.len(), len(queueFiles(t, dir)))
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		_, msg := q.peek()
+		if msg == nil || msg.Topic != "topic" || string(msg.Payload) != want {
+			t.Fatalf("peek = %+v, want %s", msg, want)
+		}
+		q.remove()
+	}
+	if _, msg := q.peek(); msg != nil {
+		t.Errorf("peek on empty queue = %+v", msg)
+	}
+	if files := queueFiles(t, dir); len(files) != 0 {
+		t.Errorf("files left after remove: %v", files)
+	}
+}
+
+func TestOfflineQueueReload(t *testing.T) {
+	q, dir := newTestQueue(t, 10, time.Hour)
+	defer os.RemoveAll(dir)
+
+	for _, payload := range []string{"a", "b"} {
+		if err := q.push("topic", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reloaded, err := newOfflineQueue(dir, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.len() != 2 {
+		t.Fatalf("len = %d, want 2", reloaded.len())
+	}
+	if err := reloaded.push("topic", []byte("c")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		_, msg := reloaded.peek()
+		if msg == nil || string(msg.Payload) != want {
+			t.Fatalf("peek = %+v, want %s", msg, want)
+		}
+		reloaded.remove()
+	}
+}
+
+func TestOfflineQueueOverflow(t *testing.T) {
+	q, dir := newTestQueue(t, 2, time.Hour)
+	defer os.RemoveAll(dir)
+
+	for _, payload := range []string{"a", "b", "c"} {
+		if err := q.push("topic", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if q.len() != 2 || len(queueFiles(t, dir)) != 2 {
+		t.Fatalf("len = %d, files = %d, want 2", q.len(), len(queueFiles(t, dir)))
+	}
+	if _, msg := q.peek(); msg == nil || string(msg.Payload) != "b" {
+		t.Errorf("peek = %+v, want the oldest message dropped", msg)
+	}
+}
+
+func TestOfflineQueueTTL(t *testing.T) {
+	q, dir := newTestQueue(t, 10, time.Millisecond)
+	defer os.RemoveAll(dir)
+
+	if err := q.push("topic", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond * 5)
+	if _, msg := q.peek(); msg != nil {
+		t.Errorf("peek = %+v, want expired message dropped", msg)
+	}
+	if q.len() != 0 || len(queueFiles(t, dir)) != 0 {
+		t.Errorf("len = %d, files = %d, want 0", q.len(), len(queueFiles(t, dir)))
+	}
+}
+
+func TestOfflineQueueCorrupt(t *testing.T) {
+	q, dir := newTestQueue(t, 10, time.Hour)
+	defer os.RemoveAll(dir)
+
+	for _, payload := range []string{"a", "b"} {
+		if err := q.push("topic", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(q.path(q.seqs[0]), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg := q.peek(); msg == nil || string(msg.Payload) != "b" {
+		t.Errorf("peek = %+v, want the corrupt message skipped", msg)
+	}
+	if q.len() != 1 {
+		t.Errorf("len = %d, want 1", q.len())
+	}
+}
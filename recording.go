@@ -0,0 +1,419 @@
+package camera
+
+import (
+	"camera/goonvif/Recording"
+	"camera/goonvif/Replay"
+	"camera/goonvif/Search"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const (
+	searchKeepAlive   = "PT60S"            // 搜索会话保持时间
+	searchWaitTime    = "PT5S"             // 每次获取结果的最长等待时间
+	searchTimeout     = time.Minute        // 整个搜索的超时时间
+	defaultMaxMatches = 100                // 默认最多返回的结果数
+	replayClockFormat = "20060102T150405Z" // RTSP Range头的clock时间格式
+	topicDialect      = "http://www.onvif.org/ver10/tev/topicExpression/ConcreteSet"
+)
+
+// 摄像头存储上的录像
+type CameraRecording struct {
+	Token             string           `json:"token"`
+	SourceName        string           `json:"source_name,omitempty"`
+	Location          string           `json:"location,omitempty"`
+	Description       string           `json:"description,omitempty"`
+	Content           string           `json:"content,omitempty"`
+	RetentionTime     string           `json:"retention_time,omitempty"`
+	EarliestRecording string           `json:"earliest_recording,omitempty"`
+	LatestRecording   string           `json:"latest_recording,omitempty"`
+	Status            string           `json:"status,omitempty"`
+	Tracks            []RecordingTrack `json:"tracks,omitempty"`
+}
+
+// 录像轨道
+type RecordingTrack struct {
+	Token       string `json:"token"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	DataFrom    string `json:"data_from,omitempty"`
+	DataTo      string `json:"data_to,omitempty"`
+}
+
+// 录像中的事件
+type RecordingEvent struct {
+	RecordingToken string            `json:"recording_token"`
+	TrackToken     string            `json:"track_token,omitempty"`
+	Time           string            `json:"time"`
+	Topic          string            `json:"topic"`
+	Operation      string            `json:"operation,omitempty"`
+	StartState     bool              `json:"start_state,omitempty"`
+	Source         map[string]string `json:"source,omitempty"`
+	Data           map[string]string `json:"data,omitempty"`
+}
+
+// 录像搜索命令，type为recordings/events，时间为RFC3339格式，end为空时到当前时间
+type recordingSearch struct {
+	Type           string `json:"type"`
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	Topic          string `json:"topic"`
+	RecordingToken string `json:"recording_token"`
+	MaxMatches     int    `json:"max_matches"`
+}
+
+// 录像搜索结果
+type RecordingSearchResult struct {
+	Type       string            `json:"type"`
+	Start      string            `json:"start"`
+	End        string            `json:"end"`
+	Recordings []CameraRecording `json:"recordings,omitempty"`
+	Events     []RecordingEvent  `json:"events,omitempty"`
+	Completed  bool              `json:"completed"`
+}
+
+// 录像回放地址，播放时在RTSP PLAY请求中带上Range头
+type ReplayInfo struct {
+	RecordingToken string `json:"recording_token"`
+	Uri            string `json:"uri"`
+	Start          string `json:"start"`
+	End            string `json:"end"`
+	Range          string `json:"range"`
+}
+
+func newCameraRecording(info Search.RecordingInformation) CameraRecording {
+	recording := CameraRecording{
+		Token:             info.RecordingToken,
+		SourceName:        info.Source.Name,
+		Location:          info.Source.Location,
+		Description:       info.Source.Description,
+		Content:           info.Content,
+		EarliestRecording: info.EarliestRecording,
+		LatestRecording:   info.LatestRecording,
+		Status:            info.RecordingStatus,
+	}
+	for _, track := range info.Track {
+		recording.Tracks = append(recording.Tracks, RecordingTrack{
+			Token:       track.TrackToken,
+			Type:        track.TrackType,
+			Description: track.Description,
+			DataFrom:    track.DataFrom,
+			DataTo:      track.DataTo,
+		})
+	}
+	return recording
+}
+
+// 获取摄像头存储上的录像
+func DeviceGetRecordings() error {
+	camera := newCamera()
+	resp, err := camera.Recording_GetRecordings()
+	if err != nil {
+		return errors.Wrap(err, "GetRecordings err")
+	}
+	res := Recording.GetRecordingsResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return errors.Wrap(err, "GetRecordings err")
+	}
+
+	recordings := make([]CameraRecording, 0, len(res.RecordingItem))
+	for _, item := range res.RecordingItem {
+		recording := CameraRecording{
+			Token:         item.RecordingToken,
+			SourceName:    item.Configuration.Source.Name,
+			Location:      item.Configuration.Source.Location,
+			Description:   item.Configuration.Source.Description,
+			Content:       item.Configuration.Content,
+			RetentionTime: item.Configuration.MaximumRetentionTime,
+		}
+		for _, track := range item.Tracks.Track {
+			recording.Tracks = append(recording.Tracks, RecordingTrack{
+				Token:       track.TrackToken,
+				Type:        track.Configuration.TrackType,
+				Description: track.Configuration.Description,
+			})
+		}
+		// 录像的时间范围由Search服务提供，获取失败时只上报配置
+		info, err := getRecordingInformation(camera, item.RecordingToken)
+		if err != nil {
+			logrus.WithError(err).Warn("GetRecordingInformation err")
+		} else {
+			retention := recording.RetentionTime
+			recording = newCameraRecording(*info)
+			recording.RetentionTime = retention
+		}
+		recordings = append(recordings, recording)
+	}
+	go handleResponse(recordings, handleGetRecordings)
+	return nil
+}
+
+func getRecordingInformation(camera *ptz.Camera, token string) (*Search.RecordingInformation, error) {
+	resp, err := camera.Search_GetRecordingInformation(token)
+	if err != nil {
+		return nil, err
+	}
+	res := Search.GetRecordingInformationResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res.RecordingInformation, nil
+}
+
+// 按时间范围搜索录像或事件，value为{"type":"events","start":"","end":"","topic":""}
+func DeviceSearchRecordings(value interface{}) error {
+	cmd := recordingSearch{}
+	if err := decodeDesired(value, &cmd); err != nil {
+		return errors.Wrap(err, "decode recording search err")
+	}
+	start, end, err := searchTimeRange(cmd.Start, cmd.End)
+	if err != nil {
+		return err
+	}
+	if cmd.MaxMatches <= 0 {
+		cmd.MaxMatches = defaultMaxMatches
+	}
+	scope := Search.SearchScope{}
+	if cmd.RecordingToken != "" {
+		scope.IncludedRecordings = []string{cmd.RecordingToken}
+	}
+
+	camera := newCamera()
+	result := RecordingSearchResult{Type: cmd.Type, Start: start.Format(time.RFC3339), End: end.Format(time.RFC3339)}
+	switch cmd.Type {
+	case "", "recordings":
+		result.Type = "recordings"
+		infos, completed, err := findRecordings(camera, scope, cmd.MaxMatches)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if recordingOverlaps(info, start, end) {
+				result.Recordings = append(result.Recordings, newCameraRecording(info))
+			}
+		}
+		result.Completed = completed
+	case "events":
+		filter := Search.EventFilter{}
+		if cmd.Topic != "" {
+			filter.TopicExpression = &Search.TopicExpression{Dialect: topicDialect, Expression: cmd.Topic}
+		}
+		events, completed, err := findEvents(camera, start, end, scope, filter, cmd.MaxMatches)
+		if err != nil {
+			return err
+		}
+		result.Events = events
+		result.Completed = completed
+	default:
+		return errors.Errorf("unknown search type %s", cmd.Type)
+	}
+	go handleResponse(result, handleSearchRecordings)
+	return nil
+}
+
+func searchTimeRange(start, end string) (time.Time, time.Time, error) {
+	if start == "" {
+		return time.Time{}, time.Time{}, errors.New("search start time is required")
+	}
+	startTime, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Wrap(err, "parse start time err")
+	}
+	endTime := time.Now()
+	if end != "" {
+		endTime, err = time.Parse(time.RFC3339, end)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.Wrap(err, "parse end time err")
+		}
+	}
+	if !endTime.After(startTime) {
+		return time.Time{}, time.Time{}, errors.New("search end time must be after start time")
+	}
+	return startTime.UTC(), endTime.UTC(), nil
+}
+
+// 录像的时间范围是否与[start,end]重叠，摄像头没有给出时间范围时保留
+func recordingOverlaps(info Search.RecordingInformation, start, end time.Time) bool {
+	earliest, err := time.Parse(time.RFC3339, info.EarliestRecording)
+	if err == nil && earliest.After(end) {
+		return false
+	}
+	latest, err := time.Parse(time.RFC3339, info.LatestRecording)
+	if err == nil && latest.Before(start) {
+		return false
+	}
+	return true
+}
+
+// 搜索录像，返回结果和是否完成，搜索结束后释放会话
+func findRecordings(camera *ptz.Camera, scope Search.SearchScope, maxMatches int) ([]Search.RecordingInformation, bool, error) {
+	resp, err := camera.Search_FindRecordings(scope, maxMatches, searchKeepAlive)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "FindRecordings err")
+	}
+	res := Search.FindRecordingsResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "FindRecordings err")
+	}
+	if res.SearchToken == "" {
+		return nil, false, errors.New("FindRecordings err: empty search token")
+	}
+	defer endSearch(camera, res.SearchToken)
+
+	var infos []Search.RecordingInformation
+	deadline := time.Now().Add(searchTimeout)
+	for time.Now().Before(deadline) {
+		resp, err = camera.Search_GetRecordingSearchResults(res.SearchToken, searchWaitTime)
+		if err != nil {
+			return infos, false, errors.Wrap(err, "GetRecordingSearchResults err")
+		}
+		results := Search.GetRecordingSearchResultsResponse{}
+		err = ptz.ParseResponse(resp, &results)
+		if err != nil {
+			return infos, false, errors.Wrap(err, "GetRecordingSearchResults err")
+		}
+		infos = append(infos, results.ResultList.RecordingInformation...)
+		if results.ResultList.SearchState == "Completed" || len(infos) >= maxMatches {
+			return infos, true, nil
+		}
+		// 没有新结果也没有搜索状态时摄像头不会再返回结果，避免连续请求到超时
+		if len(results.ResultList.RecordingInformation) == 0 && results.ResultList.SearchState == "" {
+			return infos, false, nil
+		}
+	}
+	return infos, false, nil
+}
+
+// 搜索录像中的事件，返回结果和是否完成，搜索结束后释放会话
+func findEvents(camera *ptz.Camera, start, end time.Time, scope Search.SearchScope, filter Search.EventFilter, maxMatches int) ([]RecordingEvent, bool, error) {
+	resp, err := camera.Search_FindEvents(start.Format(time.RFC3339), end.Format(time.RFC3339), scope, filter, maxMatches, searchKeepAlive)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "FindEvents err")
+	}
+	res := Search.FindEventsResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "FindEvents err")
+	}
+	if res.SearchToken == "" {
+		return nil, false, errors.New("FindEvents err: empty search token")
+	}
+	defer endSearch(camera, res.SearchToken)
+
+	var events []RecordingEvent
+	deadline := time.Now().Add(searchTimeout)
+	for time.Now().Before(deadline) {
+		resp, err = camera.Search_GetEventSearchResults(res.SearchToken, searchWaitTime)
+		if err != nil {
+			return events, false, errors.Wrap(err, "GetEventSearchResults err")
+		}
+		results := Search.GetEventSearchResultsResponse{}
+		err = ptz.ParseResponse(resp, &results)
+		if err != nil {
+			return events, false, errors.Wrap(err, "GetEventSearchResults err")
+		}
+		for _, result := range results.ResultList.Result {
+			message := result.Event.Message.Message
+			event := RecordingEvent{
+				RecordingToken: result.RecordingToken,
+				TrackToken:     result.TrackToken,
+				Time:           result.Time,
+				Topic:          result.Event.Topic,
+				Operation:      message.PropertyOperation,
+				StartState:     result.StartStateEvent,
+				Source:         simpleItems(message.Source.SimpleItem),
+				Data:           simpleItems(message.Data.SimpleItem),
+			}
+			events = append(events, event)
+		}
+		if results.ResultList.SearchState == "Completed" || len(events) >= maxMatches {
+			return events, true, nil
+		}
+		if len(results.ResultList.Result) == 0 && results.ResultList.SearchState == "" {
+			return events, false, nil
+		}
+	}
+	return events, false, nil
+}
+
+func simpleItems(items []Search.SimpleItem) map[string]string {
+	if len(items) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(items))
+	for _, item := range items {
+		m[item.Name] = item.Value
+	}
+	return m
+}
+
+func endSearch(camera *ptz.Camera, searchToken string) {
+	resp, err := camera.Search_EndSearch(searchToken)
+	if err != nil {
+		logrus.WithError(err).Warn("EndSearch err")
+		return
+	}
+	resp.Body.Close()
+}
+
+// 获取录像回放地址，value为{"recording_token":"","start":"","end":""}，没有给出录像时使用覆盖start的录像
+func DeviceGetReplayUri(value interface{}) error {
+	cmd := recordingSearch{}
+	if err := decodeDesired(value, &cmd); err != nil {
+		return errors.Wrap(err, "decode replay command err")
+	}
+	start, end, err := searchTimeRange(cmd.Start, cmd.End)
+	if err != nil {
+		return err
+	}
+
+	camera := newCamera()
+	if cmd.RecordingToken == "" {
+		infos, _, err := findRecordings(camera, Search.SearchScope{}, defaultMaxMatches)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if recordingOverlaps(info, start, start) {
+				cmd.RecordingToken = info.RecordingToken
+				break
+			}
+		}
+		if cmd.RecordingToken == "" {
+			return errors.Errorf("no recording covers %s", start.Format(time.RFC3339))
+		}
+	}
+
+	setup := onvif.StreamSetup{
+		Stream:    onvif.StreamType("RTP-Unicast"),
+		Transport: onvif.Transport{Protocol: onvif.TransportProtocol("RTSP")},
+	}
+	resp, err := camera.Replay_GetReplayUri(setup, cmd.RecordingToken)
+	if err != nil {
+		return errors.Wrap(err, "GetReplayUri err")
+	}
+	res := Replay.GetReplayUriResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return errors.Wrap(err, "GetReplayUri err")
+	}
+	if res.Uri == "" {
+		return errors.New("GetReplayUri err: empty uri")
+	}
+
+	info := ReplayInfo{
+		RecordingToken: cmd.RecordingToken,
+		Uri:            res.Uri,
+		Start:          start.Format(time.RFC3339),
+		End:            end.Format(time.RFC3339),
+		Range:          "clock=" + start.Format(replayClockFormat) + "-" + end.Format(replayClockFormat),
+	}
+	go handleResponse(info, handleGetReplayUri)
+	return nil
+}
@@ -0,0 +1,208 @@
+package camera
+
+import (
+	"camera/goonvif/Device"
+	"camera/goonvif/xsd"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RelayMonostable = "Monostable" // 单稳态，触发后经过DelayTime自动恢复
+	RelayBistable   = "Bistable"   // 双稳态，保持状态直到再次设置
+
+	RelayActive   = "active"
+	RelayInactive = "inactive"
+)
+
+// 继电器输出（警笛、道闸等）
+type Relay struct {
+	Token     string `json:"token"`
+	Mode      string `json:"mode,omitempty"`
+	DelayTime string `json:"delay_time,omitempty"`
+	IdleState string `json:"idle_state,omitempty"`
+	State     string `json:"state,omitempty"`
+}
+
+// 继电器设置命令，delay为秒数
+type relaySettings struct {
+	Token     string  `json:"token"`
+	Mode      string  `json:"mode"`
+	Delay     float64 `json:"delay"`
+	IdleState string  `json:"idle_state"`
+}
+
+// 继电器触发命令
+type relayState struct {
+	Token string      `json:"token"`
+	State interface{} `json:"state"`
+}
+
+// onvif没有查询继电器状态的接口，记录最后一次设置的状态
+var relayStates = struct {
+	sync.RWMutex
+	states map[string]string
+}{states: make(map[string]string)}
+
+func setRelayState(token, state string) {
+	relayStates.Lock()
+	relayStates.states[token] = state
+	relayStates.Unlock()
+}
+
+func getRelayState(token string) string {
+	relayStates.RLock()
+	defer relayStates.RUnlock()
+	if state, ok := relayStates.states[token]; ok {
+		return state
+	}
+	return RelayInactive
+}
+
+// 获取继电器列表
+func DeviceGetRelayOutputs() error {
+	camera := newCamera()
+	relays, err := getRelayOutputs(camera)
+	if err != nil {
+		return err
+	}
+	go handleResponse(relays, handleGetRelayOutputs)
+	return nil
+}
+
+func getRelayOutputs(camera *ptz.Camera) ([]Relay, error) {
+	resp, err := camera.Device_GetRelayOutputs()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetRelayOutputs err")
+	}
+	res := Device.GetRelayOutputsResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetRelayOutputs err")
+	}
+
+	relays := make([]Relay, 0, len(res.RelayOutputs))
+	for _, output := range res.RelayOutputs {
+		token := string(output.Token)
+		relays = append(relays, Relay{
+			Token:     token,
+			Mode:      string(output.Properties.Mode),
+			DelayTime: string(output.Properties.DelayTime),
+			IdleState: string(output.Properties.IdleState),
+			State:     getRelayState(token),
+		})
+	}
+	return relays, nil
+}
+
+// 设置继电器模式，value为{"token":"","mode":"Monostable","delay":5,"idle_state":"open"}
+func DeviceSetRelayOutputSettings(value interface{}) error {
+	settings := relaySettings{}
+	if err := decodeDesired(value, &settings); err != nil {
+		return errors.Wrap(err, "decode relay settings err")
+	}
+	if settings.Token == "" {
+		return errors.New("relay token is required")
+	}
+	switch strings.ToLower(settings.Mode) {
+	case strings.ToLower(RelayMonostable):
+		settings.Mode = RelayMonostable
+		if settings.Delay <= 0 {
+			return errors.New("monostable relay needs a positive delay")
+		}
+	case strings.ToLower(RelayBistable):
+		settings.Mode = RelayBistable
+	default:
+		return errors.Errorf("unknown relay mode %s", settings.Mode)
+	}
+	settings.IdleState = strings.ToLower(settings.IdleState)
+	if settings.IdleState == "" {
+		settings.IdleState = "open"
+	}
+	if settings.IdleState != "open" && settings.IdleState != "closed" {
+		return errors.Errorf("unknown relay idle state %s", settings.IdleState)
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_SetRelayOutputSettings(onvif.ReferenceToken(settings.Token), onvif.RelayOutputSettings{
+		Mode:      onvif.RelayMode(settings.Mode),
+		DelayTime: xsd.NewDuration(time.Duration(settings.Delay * float64(time.Second))),
+		IdleState: onvif.RelayIdleState(settings.IdleState),
+	})
+	if err != nil {
+		return errors.Wrap(err, "SetRelayOutputSettings err")
+	}
+	err = ptz.ParseResponse(resp, &Device.SetRelayOutputSettingsResponse{})
+	if err != nil {
+		return errors.Wrap(err, "SetRelayOutputSettings err")
+	}
+	return DeviceGetRelayOutputs()
+}
+
+// 触发继电器，value为{"token":"","state":"on"}，state支持on/off、active/inactive、true/false
+func DeviceSetRelayOutputState(value interface{}) error {
+	cmd := relayState{}
+	if err := decodeDesired(value, &cmd); err != nil {
+		return errors.Wrap(err, "decode relay state err")
+	}
+	if cmd.Token == "" {
+		return errors.New("relay token is required")
+	}
+	var state string
+	switch v := cmd.State.(type) {
+	case bool:
+		state = map[bool]string{true: RelayActive, false: RelayInactive}[v]
+	case float64:
+		state = map[bool]string{true: RelayActive, false: RelayInactive}[v != 0]
+	case string:
+		switch strings.ToLower(v) {
+		case "on", "active", "1", "true":
+			state = RelayActive
+		case "off", "inactive", "0", "false":
+			state = RelayInactive
+		}
+	}
+	if state == "" {
+		return errors.Errorf("unknown relay state %v", cmd.State)
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_SetRelayOutputState(onvif.ReferenceToken(cmd.Token), onvif.RelayLogicalState(state))
+	if err != nil {
+		return errors.Wrap(err, "SetRelayOutputState err")
+	}
+	err = ptz.ParseResponse(resp, &Device.SetRelayOutputStateResponse{})
+	if err != nil {
+		return errors.Wrap(err, "SetRelayOutputState err")
+	}
+	setRelayState(cmd.Token, state)
+
+	relays, err := getRelayOutputs(camera)
+	if err != nil {
+		return err
+	}
+	// 单稳态继电器在DelayTime之后自动恢复，届时再上报一次状态
+	for _, relay := range relays {
+		if relay.Token != cmd.Token || relay.Mode != RelayMonostable || state != RelayActive {
+			continue
+		}
+		delay, err := xsd.Duration(relay.DelayTime).TimeDuration()
+		if err != nil {
+			logrus.WithError(err).Warnf("relay %s delay time", relay.Token)
+			continue
+		}
+		time.AfterFunc(delay, func() {
+			setRelayState(cmd.Token, RelayInactive)
+			if err := DeviceGetRelayOutputs(); err != nil {
+				logrus.WithError(err).Error("report relay outputs error")
+			}
+		})
+	}
+	go handleResponse(relays, handleGetRelayOutputs)
+	return nil
+}
@@ -0,0 +1,352 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/goonvif/Device"
+	"camera/goonvif/networking"
+	"camera/goonvif/xsd"
+	"camera/ptz"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	StorageIndex = "storage" // 存储状态指标
+
+	defaultStorageInterval = time.Minute * 10
+	isapiStoragePath       = "/ISAPI/ContentMgmt/Storage" // 海康ISAPI存储状态，onvif没有存储容量和状态
+	isapiManufacturer      = "hikvision"                  // 只有该厂商的摄像头查询ISAPI存储状态
+	StorageSourceISAPI     = "hikvision_isapi"            // 存储状态来自海康ISAPI，不是onvif标准接口
+)
+
+// 存储状态
+const (
+	StorageOK      = "ok"
+	StorageFull    = "full"
+	StorageError   = "error"
+	StorageAbsent  = "absent"
+	StorageUnknown = "unknown" // 摄像头不支持查询存储状态
+)
+
+// 存储配置(NAS/CIFS等)，password只用于下发，不会上报
+type StorageConfig struct {
+	Token      string `json:"token,omitempty"`
+	Type       string `json:"type"` // NFS/CIFS/CDMI/FTP
+	LocalPath  string `json:"local_path,omitempty"`
+	StorageUri string `json:"storage_uri"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+}
+
+// 存储设备(SD卡、NAS)，容量单位MB
+type StorageDisk struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type"`
+	Status   string `json:"status"`
+	Capacity int64  `json:"capacity"`
+	Free     int64  `json:"free"`
+	Property string `json:"property,omitempty"`
+}
+
+// 存储状态，status为ok/full/error/absent/unknown。onvif没有存储状态接口，
+// status、disks只在source为hikvision_isapi(厂商私有接口)时有效，其他厂商的摄像头为unknown
+type StorageStatus struct {
+	Status         string          `json:"status"`
+	Source         string          `json:"source,omitempty"`
+	SDCardPresent  bool            `json:"sd_card_present"`
+	Capacity       int64           `json:"capacity"`
+	Free           int64           `json:"free"`
+	Disks          []StorageDisk   `json:"disks,omitempty"`
+	Configurations []StorageConfig `json:"configurations"`
+	CheckedAt      int64           `json:"checked_at"`
+}
+
+// 海康ISAPI存储状态
+type isapiStorage struct {
+	HDD []isapiDisk `xml:"hddList>hdd"`
+	NAS []isapiDisk `xml:"nasList>nas"`
+}
+
+type isapiDisk struct {
+	ID        string `xml:"id"`
+	Name      string `xml:"hddName"`
+	Type      string `xml:"hddType"`
+	NASType   string `xml:"nasType"`
+	IPAddress string `xml:"ipAddress"`
+	Path      string `xml:"path"`
+	Status    string `xml:"status"`
+	Capacity  int64  `xml:"capacity"`
+	Free      int64  `xml:"freeSpace"`
+	Property  string `xml:"property"`
+}
+
+// 表示存储异常的磁盘状态
+var diskErrorStatus = map[string]bool{
+	"error":         true,
+	"smartFailed":   true,
+	"mismatch":      true,
+	"offline":       true,
+	"unformatted":   true,
+	"uninitialized": true,
+}
+
+// 上一次检测的存储状态，状态变化时记录日志
+var lastStorageStatus string
+
+// 获取存储配置和状态
+func DeviceGetStorage() error {
+	camera := newCamera()
+	status, err := getStorageStatus(camera)
+	if err != nil {
+		return err
+	}
+	go handleResponse(status, handleGetStorage)
+	return nil
+}
+
+func getStorageStatus(camera *ptz.Camera) (*StorageStatus, error) {
+	configurations, err := getStorageConfigurations(camera)
+	if err != nil {
+		return nil, err
+	}
+	status := &StorageStatus{Status: StorageUnknown, Configurations: configurations, CheckedAt: time.Now().Unix()}
+
+	info, err := getDeviceInformation(camera)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(strings.ToLower(info.Manufacturer), isapiManufacturer) {
+		logrus.WithField("manufacturer", info.Manufacturer).Debug("storage status not supported")
+		return status, nil
+	}
+	disks, err := getStorageDisks(camera)
+	if err != nil {
+		logrus.WithError(err).Debug("storage status not supported")
+		return status, nil
+	}
+	status.Disks = disks
+	status.Source = StorageSourceISAPI
+	status.Status = StorageAbsent
+	hasError, full := false, false
+	for _, disk := range disks {
+		if disk.Type == "nas" || disk.Status == "notexist" {
+			continue
+		}
+		status.SDCardPresent = true
+		status.Capacity += disk.Capacity
+		status.Free += disk.Free
+		if diskErrorStatus[disk.Status] {
+			hasError = true
+		}
+		if disk.Status == "ok" && disk.Capacity > 0 && disk.Free == 0 {
+			full = true
+		}
+	}
+	switch {
+	case !status.SDCardPresent:
+	case hasError:
+		status.Status = StorageError
+	case full:
+		status.Status = StorageFull
+	default:
+		status.Status = StorageOK
+	}
+	return status, nil
+}
+
+func getStorageConfigurations(camera *ptz.Camera) ([]StorageConfig, error) {
+	resp, err := camera.Device_GetStorageConfigurations()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetStorageConfigurations err")
+	}
+	res := Device.GetStorageConfigurationsResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetStorageConfigurations err")
+	}
+	configurations := make([]StorageConfig, 0, len(res.StorageConfigurations))
+	for _, c := range res.StorageConfigurations {
+		configurations = append(configurations, StorageConfig{
+			Token:      c.Token,
+			Type:       c.Data.Type,
+			LocalPath:  c.Data.LocalPath,
+			StorageUri: c.Data.StorageUri,
+			Username:   c.Data.User.UserName,
+		})
+	}
+	return configurations, nil
+}
+
+// 通过海康ISAPI获取SD卡和NAS的状态、容量，只能用于海康摄像头
+func getStorageDisks(camera *ptz.Camera) ([]StorageDisk, error) {
+	endpoint := cameraHTTPURL(camera.Addr) + isapiStoragePath
+	resp, err := networking.Get(endpoint, &networking.DigestAuth{Username: camera.Username, Password: camera.Password})
+	if err != nil {
+		return nil, errors.Wrap(err, "get storage status err")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("get storage status err: %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "get storage status err")
+	}
+	storage := isapiStorage{}
+	if err = xml.Unmarshal(b, &storage); err != nil {
+		return nil, errors.Wrap(err, "parse storage status err")
+	}
+
+	disks := make([]StorageDisk, 0, len(storage.HDD))
+	for _, hdd := range storage.HDD {
+		disks = append(disks, StorageDisk{
+			ID:       hdd.ID,
+			Name:     hdd.Name,
+			Type:     "sd",
+			Status:   hdd.Status,
+			Capacity: hdd.Capacity,
+			Free:     hdd.Free,
+			Property: hdd.Property,
+		})
+	}
+	// 没有配置的NAS状态为notexist，不上报
+	for _, nas := range storage.NAS {
+		if nas.Status == "notexist" {
+			continue
+		}
+		disks = append(disks, StorageDisk{
+			ID:       nas.ID,
+			Name:     nas.NASType + "://" + nas.IPAddress + nas.Path,
+			Type:     "nas",
+			Status:   nas.Status,
+			Capacity: nas.Capacity,
+			Free:     nas.Free,
+			Property: nas.Property,
+		})
+	}
+	return disks, nil
+}
+
+// 摄像头的http地址，addr可以带http(s)://前缀
+func cameraHTTPURL(addr string) string {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return strings.TrimRight(addr, "/")
+	}
+	return "http://" + addr
+}
+
+// 创建或修改存储配置，value为{"type":"CIFS","storage_uri":"//192.168.1.10/record","username":"","password":""}，没有token时创建
+func DeviceSetStorageConfiguration(value interface{}) error {
+	cfg := StorageConfig{}
+	if err := decodeDesired(value, &cfg); err != nil {
+		return errors.Wrap(err, "decode storage configuration err")
+	}
+	cfg.Type = strings.ToUpper(cfg.Type)
+	switch cfg.Type {
+	case "NFS", "CIFS", "CDMI", "FTP":
+	default:
+		return errors.Errorf("unknown storage type %s", cfg.Type)
+	}
+	if cfg.StorageUri == "" {
+		return errors.New("storage_uri is required")
+	}
+
+	data := Device.StorageConfigurationData{
+		Type:       xsd.String(cfg.Type),
+		LocalPath:  xsd.AnyURI(cfg.LocalPath),
+		StorageUri: xsd.AnyURI(cfg.StorageUri),
+	}
+	if cfg.Username != "" {
+		data.User = &Device.UserCredential{UserName: xsd.String(cfg.Username), Password: xsd.String(cfg.Password)}
+	}
+
+	camera := newCamera()
+	if cfg.Token == "" {
+		resp, err := camera.Device_CreateStorageConfiguration(data)
+		if err != nil {
+			return errors.Wrap(err, "CreateStorageConfiguration err")
+		}
+		err = ptz.ParseResponse(resp, &Device.CreateStorageConfigurationResponse{})
+		if err != nil {
+			return errors.Wrap(err, "CreateStorageConfiguration err")
+		}
+	} else {
+		resp, err := camera.Device_SetStorageConfiguration(cfg.Token, data)
+		if err != nil {
+			return errors.Wrap(err, "SetStorageConfiguration err")
+		}
+		err = ptz.ParseResponse(resp, &Device.SetStorageConfigurationResponse{})
+		if err != nil {
+			return errors.Wrap(err, "SetStorageConfiguration err")
+		}
+	}
+	return DeviceGetStorage()
+}
+
+// 删除存储配置，value为存储配置token
+func DeviceDeleteStorageConfiguration(value interface{}) error {
+	token, _ := value.(string)
+	if token == "" {
+		return errors.New("storage configuration token is required")
+	}
+	camera := newCamera()
+	resp, err := camera.Device_DeleteStorageConfiguration(token)
+	if err != nil {
+		return errors.Wrap(err, "DeleteStorageConfiguration err")
+	}
+	err = ptz.ParseResponse(resp, &Device.DeleteStorageConfigurationResponse{})
+	if err != nil {
+		return errors.Wrap(err, "DeleteStorageConfiguration err")
+	}
+	return DeviceGetStorage()
+}
+
+// 检测存储状态并上报，SD卡异常时记录日志
+func DeviceCheckStorage() error {
+	camera := newCamera()
+	status, err := getStorageStatus(camera)
+	if err != nil {
+		return err
+	}
+	if status.Status != lastStorageStatus {
+		entry := NewEntry(Fields{"did": did, "status": status.Status, "capacity": status.Capacity, "free": status.Free})
+		switch status.Status {
+		case StorageError, StorageFull, StorageAbsent:
+			entry.DownLink("sd card %s", status.Status)
+		}
+		lastStorageStatus = status.Status
+	}
+
+	if err := Mark(MarkFields{
+		"did":      did,
+		"status":   status.Status,
+		"capacity": status.Capacity,
+		"free":     status.Free,
+	}, StorageIndex); err != nil {
+		logrus.Error(err)
+	}
+	go handleResponse(status, handleGetStorage)
+	return nil
+}
+
+// 定时检测存储状态
+func StorageCheck() {
+	interval := config.C.StorageCheck.Interval
+	if interval <= 0 {
+		interval = defaultStorageInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := DeviceCheckStorage(); err != nil {
+			logrus.WithError(err).Error("check storage error")
+		}
+		<-t.C
+	}
+}
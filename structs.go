@@ -7,6 +7,7 @@ import (
 
 type AckPacket struct {
 	CommandID string `json:"command_id"`
+	Command   string `json:"command,omitempty"`
 	Status    string `json:"status"`
 	Result    string `json:"result"`
 }
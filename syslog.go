@@ -0,0 +1,207 @@
+package camera
+
+import (
+	"bytes"
+	"camera/config"
+	"camera/goonvif/Device"
+	"camera/goonvif/networking"
+	"camera/ptz"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// 日志类型
+const (
+	SystemLogSystem  = "system"
+	SystemLogAccess  = "access"
+	SystemLogSupport = "support" // 技术支持信息
+)
+
+// 上传到文件服务器的日志，source为onvif(GetSystemLog)或http(GetSystemUris下载)
+type SystemLogFile struct {
+	Type      string `json:"type"`
+	Fid       string `json:"fid"`
+	Size      int    `json:"size"`
+	Source    string `json:"source"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// 获取系统日志并上传到文件服务器，value为system/access或{"type":"access"}，默认system
+func DeviceGetSystemLog(value interface{}) error {
+	logType, _ := value.(string)
+	if logType == "" && value != nil {
+		cmd := struct {
+			Type string `json:"type"`
+		}{}
+		if err := decodeDesired(value, &cmd); err != nil {
+			return errors.Wrap(err, "decode system log err")
+		}
+		logType = cmd.Type
+	}
+	logType = strings.ToLower(logType)
+	switch logType {
+	case "":
+		logType = SystemLogSystem
+	case SystemLogSystem, SystemLogAccess:
+	default:
+		return errors.Errorf("unknown system log type %s", logType)
+	}
+
+	camera := newCamera()
+	// onvif的日志类型为System/Access
+	onvifType := strings.ToUpper(logType[:1]) + logType[1:]
+	content, source, err := fetchSystemFile(camera, func() (Device.SystemLog, map[string][]byte, error) {
+		resp, err := camera.Device_GetSystemLog(onvifType)
+		if err != nil {
+			return Device.SystemLog{}, nil, err
+		}
+		res := Device.GetSystemLogResponse{}
+		attachments, err := ptz.ParseResponseWithAttachments(resp, &res)
+		return res.SystemLog, attachments, err
+	}, func(uris Device.GetSystemUrisResponse) string {
+		for _, uri := range uris.SystemLogUris.SystemLog {
+			if strings.EqualFold(uri.Type, onvifType) {
+				return uri.Uri
+			}
+		}
+		return ""
+	})
+	if err != nil {
+		return errors.Wrap(err, "GetSystemLog err")
+	}
+	file, err := uploadSystemFile(logType, content, source)
+	if err != nil {
+		return err
+	}
+	go handleResponse(file, handleGetSystemLog)
+	return nil
+}
+
+// 获取技术支持信息并上传到文件服务器
+func DeviceGetSystemSupportInformation() error {
+	camera := newCamera()
+	content, source, err := fetchSystemFile(camera, func() (Device.SystemLog, map[string][]byte, error) {
+		resp, err := camera.Device_GetSystemSupportInformation()
+		if err != nil {
+			return Device.SystemLog{}, nil, err
+		}
+		res := Device.GetSystemSupportInformationResponse{}
+		attachments, err := ptz.ParseResponseWithAttachments(resp, &res)
+		return res.SupportInformation, attachments, err
+	}, func(uris Device.GetSystemUrisResponse) string {
+		return uris.SupportInfoUri
+	})
+	if err != nil {
+		return errors.Wrap(err, "GetSystemSupportInformation err")
+	}
+	file, err := uploadSystemFile(SystemLogSupport, content, source)
+	if err != nil {
+		return err
+	}
+	go handleResponse(file, handleGetSystemSupportInformation)
+	return nil
+}
+
+// 先通过onvif获取内容(内联文本或MTOM附件)，不支持时通过GetSystemUris返回的http地址下载
+func fetchSystemFile(camera *ptz.Camera, get func() (Device.SystemLog, map[string][]byte, error), uri func(Device.GetSystemUrisResponse) string) ([]byte, string, error) {
+	log, attachments, err := get()
+	if err == nil {
+		if log.String != "" {
+			return []byte(log.String), "onvif", nil
+		}
+		if b, ok := ptz.Attachment(attachments, log.Binary.Include.Href); ok {
+			return b, "onvif", nil
+		}
+	}
+	logrus.WithError(err).Debug("system log not returned by onvif, try system uris")
+
+	resp, err := camera.Device_GetSystemUris()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "GetSystemUris err")
+	}
+	uris := Device.GetSystemUrisResponse{}
+	if err = ptz.ParseResponse(resp, &uris); err != nil {
+		return nil, "", errors.Wrap(err, "GetSystemUris err")
+	}
+	endpoint := uri(uris)
+	if endpoint == "" {
+		return nil, "", errors.New("camera does not provide the file")
+	}
+	b, err := downloadSystemFile(camera, endpoint)
+	return b, "http", err
+}
+
+func downloadSystemFile(camera *ptz.Camera, endpoint string) ([]byte, error) {
+	resp, err := networking.Get(endpoint, &networking.DigestAuth{Username: camera.Username, Password: camera.Password})
+	if err != nil {
+		return nil, errors.Wrap(err, "download file err")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("download file err: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// 上传日志到文件服务器
+func uploadSystemFile(logType string, content []byte, source string) (*SystemLogFile, error) {
+	ext := ".log"
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		ext = ".tar.gz"
+	}
+	fid, err := uploadContent(logType+"_"+time.Now().Format("20060102150405")+ext, content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "upload %s log err", logType)
+	}
+	return &SystemLogFile{Type: logType, Fid: fid, Size: len(content), Source: source, CreatedAt: time.Now().Unix()}, nil
+}
+
+// 写入临时文件后使用快照的上传方式上传，返回文件服务器的fid
+func uploadContent(name string, content []byte) (string, error) {
+	fileName := fmt.Sprintf("%s_%s", config.C.General.SnapshotPath, name)
+	if err := ioutil.WriteFile(fileName, content, 0644); err != nil {
+		return "", errors.Wrap(err, "write file err")
+	}
+	defer os.Remove(fileName)
+
+	fid := sendSnapshot(fileName)
+	if fid == "" {
+		return "", errors.New("file server returned no fid")
+	}
+	return fid, nil
+}
+
+// 删除文件服务器上的文件，没有配置delete_url时不删除
+func deleteFile(fid string) error {
+	if config.C.File.DeleteURL == "" {
+		return errors.New("file server delete_url is not configured")
+	}
+	req, err := http.NewRequest(http.MethodDelete, strings.TrimRight(config.C.File.DeleteURL, "/")+"/"+fid, nil)
+	if err != nil {
+		return errors.Wrap(err, "delete file err")
+	}
+	client := &http.Client{Timeout: time.Second * 30}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "delete file err")
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return errors.Errorf("delete file err: %s", resp.Status)
+	}
+	return nil
+}
+
+// 文件服务器上fid的下载地址，上传地址url只能用于上传
+func fileDownloadURL(fid string) (string, error) {
+	if config.C.File.DownloadURL == "" {
+		return "", errors.New("file server download_url is not configured")
+	}
+	return strings.TrimRight(config.C.File.DownloadURL, "/") + "/" + fid, nil
+}
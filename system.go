@@ -0,0 +1,269 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/goonvif/Device"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	confirmTimeout     = time.Minute * 2  // 确认码有效期
+	offlineWaitTimeout = time.Minute * 2  // 等待摄像头下线的时间
+	onlineWaitTimeout  = time.Minute * 10 // 等待摄像头恢复的时间
+	recoveryInterval   = time.Second * 5  // 检测摄像头在线的间隔
+)
+
+// 待确认的危险操作
+type PendingAction struct {
+	Action   string `json:"action"`
+	Type     string `json:"type,omitempty"`
+	Token    string `json:"token"`
+	ExpireAt int64  `json:"expire_at"`
+}
+
+// 重启后的恢复情况
+type RebootRecovery struct {
+	Action          string  `json:"action"`
+	Status          string  `json:"status"` // recovered/timeout/not_offline
+	RebootAt        int64   `json:"reboot_at"`
+	OfflineAt       int64   `json:"offline_at,omitempty"`
+	OnlineAt        int64   `json:"online_at,omitempty"`
+	RecoverySeconds float64 `json:"recovery_seconds,omitempty"`
+}
+
+// 危险操作的下发参数，confirm为空时生成确认码
+type confirmCommand struct {
+	Type    string `json:"type"`
+	Confirm string `json:"confirm"`
+}
+
+var pendingConfirmations = struct {
+	sync.Mutex
+	actions map[string]PendingAction
+}{actions: make(map[string]PendingAction)}
+
+// 记录危险操作审计日志
+func audit(action, stage, commandID string, detail interface{}) {
+	NewEntry(Fields{
+		"did":        did,
+		"action":     action,
+		"stage":      stage,
+		"command_id": commandID,
+		"detail":     detail,
+	}).DownLink("audit %s %s", action, stage)
+	logrus.WithFields(logrus.Fields{"action": action, "stage": stage, "command_id": commandID}).Warn("dangerous command")
+}
+
+func newConfirmToken() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 生成确认码并上报，需要再次下发带confirm的命令才会执行
+func requestConfirmation(action, factoryType, commandID string) error {
+	token, err := newConfirmToken()
+	if err != nil {
+		return errors.Wrap(err, "generate confirm token err")
+	}
+	pending := PendingAction{
+		Action:   action,
+		Type:     factoryType,
+		Token:    token,
+		ExpireAt: time.Now().Add(confirmTimeout).Unix(),
+	}
+	pendingConfirmations.Lock()
+	pendingConfirmations.actions[action] = pending
+	pendingConfirmations.Unlock()
+
+	audit(action, "requested", commandID, pending)
+	go handleResponse(pending, handlePendingConfirmation)
+	return nil
+}
+
+// 校验确认码，确认码只能使用一次
+func checkConfirmation(action, factoryType, token, commandID string) error {
+	pendingConfirmations.Lock()
+	pending, ok := pendingConfirmations.actions[action]
+	delete(pendingConfirmations.actions, action)
+	pendingConfirmations.Unlock()
+
+	switch {
+	case !ok:
+		err := errors.Errorf("%s has no pending confirmation", action)
+		audit(action, "rejected", commandID, err.Error())
+		return err
+	case time.Now().Unix() > pending.ExpireAt:
+		err := errors.Errorf("%s confirmation expired", action)
+		audit(action, "rejected", commandID, err.Error())
+		return err
+	case pending.Token != token || pending.Type != factoryType:
+		err := errors.Errorf("%s confirmation mismatch", action)
+		audit(action, "rejected", commandID, err.Error())
+		return err
+	}
+	audit(action, "confirmed", commandID, pending)
+	return nil
+}
+
+func decodeConfirmCommand(value interface{}) confirmCommand {
+	cmd := confirmCommand{}
+	switch v := value.(type) {
+	case string:
+		cmd.Type = v
+	case map[string]interface{}:
+		decodeDesired(v, &cmd)
+	}
+	return cmd
+}
+
+// 远程重启，value为true时返回确认码，{"confirm":"确认码"}时执行
+func DeviceSystemReboot(value interface{}, commandID string) error {
+	cmd := decodeConfirmCommand(value)
+	if cmd.Confirm == "" {
+		return requestConfirmation(SystemReboot, "", commandID)
+	}
+	if err := checkConfirmation(SystemReboot, "", cmd.Confirm, commandID); err != nil {
+		return err
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_SystemReboot()
+	if err != nil {
+		audit(SystemReboot, "failed", commandID, err.Error())
+		return errors.Wrap(err, "SystemReboot err")
+	}
+	res := Device.SystemRebootResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		audit(SystemReboot, "failed", commandID, err.Error())
+		return errors.Wrap(err, "SystemReboot err")
+	}
+	audit(SystemReboot, "executed", commandID, res.Message)
+
+	go trackRecovery(SystemReboot, time.Now())
+	return nil
+}
+
+// 恢复出厂设置，value为"Soft"/"Hard"时返回确认码，{"type":"Hard","confirm":"确认码"}时执行
+func DeviceSetSystemFactoryDefault(value interface{}, commandID string) error {
+	cmd := decodeConfirmCommand(value)
+	switch strings.ToLower(cmd.Type) {
+	case "soft":
+		cmd.Type = "Soft"
+	case "hard":
+		cmd.Type = "Hard"
+	default:
+		return errors.Errorf("unknown factory default type %s", cmd.Type)
+	}
+	if cmd.Confirm == "" {
+		return requestConfirmation(SetSystemFactoryDefault, cmd.Type, commandID)
+	}
+	if err := checkConfirmation(SetSystemFactoryDefault, cmd.Type, cmd.Confirm, commandID); err != nil {
+		return err
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_SetSystemFactoryDefault(onvif.FactoryDefaultType(cmd.Type))
+	if err != nil {
+		audit(SetSystemFactoryDefault, "failed", commandID, err.Error())
+		return errors.Wrap(err, "SetSystemFactoryDefault err")
+	}
+	err = ptz.ParseResponse(resp, &Device.SetSystemFactoryDefaultResponse{})
+	if err != nil {
+		audit(SetSystemFactoryDefault, "failed", commandID, err.Error())
+		return errors.Wrap(err, "SetSystemFactoryDefault err")
+	}
+	audit(SetSystemFactoryDefault, "executed", commandID, cmd.Type)
+
+	go trackRecovery(SetSystemFactoryDefault, time.Now())
+	return nil
+}
+
+func cameraOnline() bool {
+	return cameraReachable(config.CameraAddr())
+}
+
+// 当前摄像头，地址和密码在运行中可能被修改，每次使用时重新获取
+func newCamera() *ptz.Camera {
+	addr, username, password := config.Camera()
+	return &ptz.Camera{Addr: addr, Username: username, Password: password}
+}
+
+// 跟踪摄像头下线和恢复上线，上报恢复用时
+func trackRecovery(action string, start time.Time) {
+	recovery := waitRecovery(action, start, onlineWaitTimeout)
+	go handleResponse(recovery, handleRebootRecovery)
+}
+
+// 等待摄像头下线后再恢复上线
+func waitRecovery(action string, start time.Time, onlineTimeout time.Duration) RebootRecovery {
+	recovery := RebootRecovery{Action: action, Status: "timeout", RebootAt: start.Unix()}
+
+	deadline := start.Add(offlineWaitTimeout)
+	for time.Now().Before(deadline) {
+		if !cameraOnline() {
+			recovery.OfflineAt = time.Now().Unix()
+			go HandleIntervalCheck("offline(离线)", HandleInterval)
+			break
+		}
+		time.Sleep(recoveryInterval)
+	}
+	if recovery.OfflineAt == 0 {
+		// 摄像头一直在线，说明命令没有生效
+		logrus.Warnf("%s: camera did not go offline within %v", action, offlineWaitTimeout)
+		recovery.Status = "not_offline"
+		return recovery
+	}
+
+	deadline = time.Now().Add(onlineTimeout)
+	for time.Now().Before(deadline) {
+		if cameraOnline() {
+			now := time.Now()
+			recovery.Status = "recovered"
+			recovery.OnlineAt = now.Unix()
+			recovery.RecoverySeconds = now.Sub(start).Seconds()
+			go HandleIntervalCheck("online(在线)", HandleInterval)
+			break
+		}
+		time.Sleep(recoveryInterval)
+	}
+
+	NewEntry(Fields{"did": did}).DownLink("%s recovery %s in %.0fs", action, recovery.Status, recovery.RecoverySeconds)
+	return recovery
+}
+
+// 摄像头不支持该操作，可以改用其他方式
+var errActionNotSupported = errors.New("action not supported")
+
+// 根据摄像头返回的fault判断是否不支持该操作，网络错误和鉴权失败不算
+func actionNotSupported(err error) bool {
+	if errors.Cause(err) == errActionNotSupported {
+		return true
+	}
+	fault, ok := errors.Cause(err).(*ptz.Fault)
+	if !ok {
+		return false
+	}
+	if fault.StatusCode == http.StatusNotImplemented {
+		return true
+	}
+	text := strings.ToLower(fault.Code + " " + fault.Reason)
+	for _, reason := range []string{"actionnotsupported", "notimplemented", "not implemented", "not supported"} {
+		if strings.Contains(text, reason) {
+			return true
+		}
+	}
+	return false
+}
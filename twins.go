@@ -0,0 +1,284 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/storage"
+	"encoding/json"
+	"fmt"
+	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"sync"
+	"time"
+)
+
+const versionConflict = "406" // 影子版本冲突的错误码
+
+// 网关保存的设备影子，上报时版本递增并记录每个属性的更新时间，配置redis时持久化
+var shadow = struct {
+	sync.Mutex
+	twins     *Twins
+	persisted bool // 已合并redis中保存的影子
+}{}
+
+// 上报属性，更新本地影子后以新版本发布
+func publishReported(reported map[string]interface{}) error {
+	shadow.Lock()
+
+	twins := currentTwins()
+	now := time.Now()
+	for k, v := range reported {
+		twins.DigitalTwins.State.Reported[k] = v
+		twins.DigitalTwins.MetaData.Reported[k] = Meta{Timestamp: now.Unix()}
+	}
+	twins.DigitalTwins.Version++
+	twins.DigitalTwins.Timestamp = now.Unix()
+	twins.Timestamp = now
+	saveTwins(twins)
+
+	request := RequestTwins{Method: Update, State: &State{Reported: reported}, Version: twins.DigitalTwins.Version}
+	jsonText, err := request.MarshalJSONText()
+	shadow.Unlock()
+	if err != nil {
+		return err
+	}
+	// 发布可能阻塞，不能持有影子的锁
+	return pubSub.publish(pubSub.rxTopic, jsonText)
+}
+
+// 使用云端的版本，并以新版本重新上报全部属性，用于版本冲突和回应get
+func resyncTwins(version int64) error {
+	shadow.Lock()
+
+	twins := currentTwins()
+	if version > twins.DigitalTwins.Version {
+		twins.DigitalTwins.Version = version
+	}
+	twins.DigitalTwins.Version++
+	twins.DigitalTwins.Timestamp = time.Now().Unix()
+	saveTwins(twins)
+	NewEntry(Fields{"did": twins.Did, "version": twins.DigitalTwins.Version}).UpLink("resync reported state")
+
+	request := RequestTwins{Method: Update, State: &State{Reported: twins.DigitalTwins.State.Reported}, Version: twins.DigitalTwins.Version}
+	jsonText, err := request.MarshalJSONText()
+	shadow.Unlock()
+	if err != nil {
+		return err
+	}
+	return pubSub.publish(pubSub.rxTopic, jsonText)
+}
+
+// 云端的版本较新时使用云端的版本，返回云端是否落后于网关
+func syncTwinsVersion(version int64) (cloudBehind bool) {
+	shadow.Lock()
+	defer shadow.Unlock()
+
+	twins := currentTwins()
+	if version > twins.DigitalTwins.Version {
+		twins.DigitalTwins.Version = version
+		saveTwins(twins)
+	}
+	return version < twins.DigitalTwins.Version
+}
+
+// 记录下发的期望状态，执行后通过clearDesired删除，密码等凭据不保存
+func recordDesired(desired map[string]interface{}) {
+	shadow.Lock()
+	defer shadow.Unlock()
+
+	twins := currentTwins()
+	if twins.DigitalTwins.State.Desired == nil {
+		twins.DigitalTwins.State.Desired = map[string]interface{}{}
+		twins.DigitalTwins.MetaData.Desired = map[string]Meta{}
+	}
+	now := time.Now().Unix()
+	for k, v := range desired {
+		if v == nil {
+			delete(twins.DigitalTwins.State.Desired, k)
+			delete(twins.DigitalTwins.MetaData.Desired, k)
+			continue
+		}
+		twins.DigitalTwins.State.Desired[k] = scrubCredentials(v)
+		twins.DigitalTwins.MetaData.Desired[k] = Meta{Timestamp: now}
+	}
+	saveTwins(twins)
+}
+
+// 去掉名称中包含password的字段，如CreateUser、SetUser的密码
+func scrubCredentials(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			if strings.Contains(strings.ToLower(k), "password") {
+				continue
+			}
+			res[k] = scrubCredentials(item)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(value))
+		for i, item := range value {
+			res[i] = scrubCredentials(item)
+		}
+		return res
+	}
+	return v
+}
+
+// 本地影子中的期望状态
+func shadowDesired(key string) (interface{}, bool) {
+	shadow.Lock()
+	defer shadow.Unlock()
+
+	v, ok := currentTwins().DigitalTwins.State.Desired[key]
+	return v, ok && v != nil
+}
+
+// 删除已执行的期望状态，上报值为null的desired使云端影子同步删除
+func clearDesired(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	shadow.Lock()
+	twins := currentTwins()
+	desired := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		desired[k] = nil
+		delete(twins.DigitalTwins.State.Desired, k)
+		delete(twins.DigitalTwins.MetaData.Desired, k)
+	}
+	twins.DigitalTwins.Version++
+	twins.DigitalTwins.Timestamp = time.Now().Unix()
+	saveTwins(twins)
+
+	request := RequestTwins{Method: Update, State: &State{Desired: desired}, Version: twins.DigitalTwins.Version}
+	jsonText, err := request.MarshalJSONText()
+	shadow.Unlock()
+	if err != nil {
+		return err
+	}
+	return pubSub.publish(pubSub.rxTopic, jsonText)
+}
+
+// 云端删除影子属性，keys为空时删除全部上报属性
+func deleteReported(keys []string, version int64) {
+	shadow.Lock()
+	defer shadow.Unlock()
+
+	twins := currentTwins()
+	if len(keys) == 0 {
+		twins.DigitalTwins.State.Reported = map[string]interface{}{}
+		twins.DigitalTwins.MetaData.Reported = map[string]Meta{}
+	}
+	for _, k := range keys {
+		delete(twins.DigitalTwins.State.Reported, k)
+		delete(twins.DigitalTwins.MetaData.Reported, k)
+	}
+	if version > twins.DigitalTwins.Version {
+		twins.DigitalTwins.Version = version
+	}
+	twins.DigitalTwins.Timestamp = time.Now().Unix()
+	saveTwins(twins)
+}
+
+// 连接后获取云端影子，云端reply中的期望状态会被执行
+func requestTwins(b *Backend) error {
+	request := RequestTwins{Method: Get}
+	jsonText, err := request.MarshalJSONText()
+	if err != nil {
+		return err
+	}
+	return b.publish(b.rxTopic, jsonText)
+}
+
+// 当前设备的影子，调用时需要持有shadow的锁。redis在mqtt之后连接，连接前的上报在连接后与保存的影子合并
+func currentTwins() *Twins {
+	id := deviceID()
+	if shadow.twins == nil || shadow.twins.Did != id {
+		shadow.twins = newTwins(id)
+		shadow.persisted = false
+	}
+	if !shadow.persisted && config.C.Redis.Pool != nil {
+		stored, err := loadTwins(id)
+		if err != nil {
+			logrus.WithError(err).Warn("load shadow error")
+			return shadow.twins
+		}
+		if stored != nil {
+			mergeTwins(shadow.twins, stored)
+		}
+		shadow.persisted = true
+	}
+	return shadow.twins
+}
+
+func newTwins(id string) *Twins {
+	return &Twins{
+		Tid: config.C.General.Tid,
+		Pid: config.C.General.Pid,
+		Did: id,
+		DigitalTwins: DBTwins{
+			State:    State{Reported: map[string]interface{}{}},
+			MetaData: Metadata{Reported: map[string]Meta{}},
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// 合并保存的影子，本次运行中上报的属性优先，版本取较大值
+func mergeTwins(twins, stored *Twins) {
+	for k, v := range stored.DigitalTwins.State.Reported {
+		if _, ok := twins.DigitalTwins.State.Reported[k]; !ok {
+			twins.DigitalTwins.State.Reported[k] = v
+			twins.DigitalTwins.MetaData.Reported[k] = stored.DigitalTwins.MetaData.Reported[k]
+		}
+	}
+	if len(stored.DigitalTwins.State.Desired) > 0 && twins.DigitalTwins.State.Desired == nil {
+		twins.DigitalTwins.State.Desired = stored.DigitalTwins.State.Desired
+		twins.DigitalTwins.MetaData.Desired = stored.DigitalTwins.MetaData.Desired
+	}
+	if stored.DigitalTwins.Version > twins.DigitalTwins.Version {
+		twins.DigitalTwins.Version = stored.DigitalTwins.Version
+	}
+}
+
+func twinsKey(id string) string {
+	return fmt.Sprintf(keyPrefix, config.C.General.Tid, config.C.General.Pid, id)
+}
+
+func loadTwins(id string) (*Twins, error) {
+	b, err := redis.Bytes(storage.Get(twinsKey(id)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "load shadow err")
+	}
+	twins := newTwins(id)
+	if err = json.Unmarshal(b, twins); err != nil {
+		return nil, errors.Wrap(err, "decode shadow err")
+	}
+	if twins.DigitalTwins.State.Reported == nil {
+		twins.DigitalTwins.State.Reported = map[string]interface{}{}
+	}
+	if twins.DigitalTwins.MetaData.Reported == nil {
+		twins.DigitalTwins.MetaData.Reported = map[string]Meta{}
+	}
+	return twins, nil
+}
+
+// 持久化影子，失败时只记录日志，下次上报时再保存
+func saveTwins(twins *Twins) {
+	if config.C.Redis.Pool == nil || !shadow.persisted {
+		return
+	}
+	b, err := json.Marshal(twins)
+	if err == nil {
+		err = storage.Set(twinsKey(twins.Did), b)
+	}
+	if err != nil {
+		logrus.WithError(err).Warn("save shadow error")
+	}
+}
@@ -0,0 +1,293 @@
+package camera
+
+import (
+	"bytes"
+	"camera/goonvif/Device"
+	"camera/goonvif/networking"
+	"camera/ptz"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	upgradeHTTPTimeout = time.Minute * 10 // 下载、上传固件的超时时间
+	upgradeStep        = 10               // 上传进度每10%记录一次
+)
+
+// 固件升级命令，fid为文件服务器上的固件，也可以直接给出url
+type upgradeCommand struct {
+	Fid     string `json:"fid"`
+	URL     string `json:"url"`
+	Version string `json:"version"`
+}
+
+// 固件升级进度和结果
+type FirmwareUpgradeStatus struct {
+	Status          string `json:"status"` // downloading/uploading/rebooting/success/failed
+	Progress        int    `json:"progress"`
+	Method          string `json:"method,omitempty"` // http/mtom
+	FromVersion     string `json:"from_version,omitempty"`
+	ToVersion       string `json:"to_version,omitempty"`
+	ExpectedVersion string `json:"expected_version,omitempty"`
+	Error           string `json:"error,omitempty"`
+	StartAt         int64  `json:"start_at"`
+	FinishAt        int64  `json:"finish_at,omitempty"`
+}
+
+// 同一时间只允许一个升级任务
+var upgrading int32
+
+// 固件升级，value为{"fid":"文件id","version":"期望的固件版本"}
+func DeviceUpgradeFirmware(value interface{}) error {
+	cmd := upgradeCommand{}
+	if err := decodeDesired(value, &cmd); err != nil {
+		return errors.Wrap(err, "decode upgrade command err")
+	}
+	if cmd.Fid == "" && cmd.URL == "" {
+		return errors.New("firmware fid or url is required")
+	}
+	if cmd.Version == "" {
+		return errors.New("expected firmware version is required")
+	}
+	if cmd.URL == "" {
+		url, err := fileDownloadURL(cmd.Fid)
+		if err != nil {
+			return err
+		}
+		cmd.URL = url
+	}
+	if !atomic.CompareAndSwapInt32(&upgrading, 0, 1) {
+		return errors.New("firmware upgrade is already running")
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&upgrading, 0)
+		upgradeFirmware(cmd)
+	}()
+	return nil
+}
+
+func upgradeFirmware(cmd upgradeCommand) {
+	entry := NewEntry(Fields{"did": did, "url": cmd.URL, "version": cmd.Version})
+	status := &FirmwareUpgradeStatus{ExpectedVersion: cmd.Version, StartAt: time.Now().Unix()}
+	fail := func(err error) {
+		entry.UpgradeUp("firmware upgrade failed: %v", err)
+		status.Status = "failed"
+		status.Error = err.Error()
+		status.FinishAt = time.Now().Unix()
+		reportUpgrade(status)
+	}
+
+	camera := newCamera()
+	info, err := getDeviceInformation(camera)
+	if err != nil {
+		fail(err)
+		return
+	}
+	status.FromVersion = info.FirmwareVersion
+	if info.FirmwareVersion == cmd.Version {
+		entry.UpgradeUp("firmware is already %s", cmd.Version)
+		status.Status = "success"
+		status.Progress = 100
+		status.ToVersion = info.FirmwareVersion
+		status.FinishAt = time.Now().Unix()
+		reportUpgrade(status)
+		return
+	}
+
+	status.Status = "downloading"
+	reportUpgrade(status)
+	entry.UpgradeDown("download firmware")
+	firmware, err := downloadFirmware(cmd.URL)
+	if err != nil {
+		fail(err)
+		return
+	}
+	entry.UpgradeDown("firmware downloaded, %d bytes", len(firmware))
+
+	status.Status = "uploading"
+	reportUpgrade(status)
+	expectedDownTime, err := uploadFirmware(camera, firmware, status, entry)
+	if err != nil {
+		fail(err)
+		return
+	}
+	// 上传可能耗时较长，从上传完成开始等待摄像头下线
+	start := time.Now()
+
+	status.Status = "rebooting"
+	status.Progress = 100
+	reportUpgrade(status)
+	onlineTimeout := onlineWaitTimeout
+	if expectedDownTime*2 > onlineTimeout {
+		onlineTimeout = expectedDownTime * 2
+	}
+	recovery := waitRecovery(UpgradeFirmware, start, onlineTimeout)
+	entry.UpgradeUp("camera recovery %s in %.0fs", recovery.Status, recovery.RecoverySeconds)
+	switch recovery.Status {
+	case "timeout":
+		fail(errors.New("camera did not come back online after upgrade"))
+		return
+	case "not_offline":
+		// 摄像头没有重启，可能仍在写入固件，不能据此判断版本
+		fail(errors.New("camera did not reboot after upgrade"))
+		return
+	}
+
+	// 重启后检查固件版本
+	info, err = getDeviceInformation(camera)
+	if err != nil {
+		fail(err)
+		return
+	}
+	status.ToVersion = info.FirmwareVersion
+	if info.FirmwareVersion != cmd.Version {
+		fail(errors.Errorf("firmware version is %s, expected %s", info.FirmwareVersion, cmd.Version))
+		return
+	}
+	entry.UpgradeUp("firmware upgraded from %s to %s", status.FromVersion, status.ToVersion)
+	status.Status = "success"
+	status.FinishAt = time.Now().Unix()
+	reportUpgrade(status)
+	go ReportInventory()
+}
+
+func reportUpgrade(status *FirmwareUpgradeStatus) {
+	s := *status
+	go handleResponse(s, handleFirmwareUpgrade)
+}
+
+func getDeviceInformation(camera *ptz.Camera) (*Device.GetDeviceInformationResponse, error) {
+	resp, err := camera.Device_GetDeviceInformation()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetDeviceInformation err")
+	}
+	res := &Device.GetDeviceInformationResponse{}
+	err = ptz.ParseResponse(resp, res)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetDeviceInformation err")
+	}
+	return res, nil
+}
+
+// 从文件服务器下载固件
+func downloadFirmware(url string) ([]byte, error) {
+	client := &http.Client{Timeout: upgradeHTTPTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "download firmware err")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("download firmware err: %s", resp.Status)
+	}
+	firmware, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "download firmware err")
+	}
+	if len(firmware) == 0 {
+		return nil, errors.New("firmware is empty")
+	}
+	return firmware, nil
+}
+
+// 优先使用StartFirmwareUpgrade返回的地址上传固件，摄像头不支持时才使用UpgradeSystemFirmware，返回预计的离线时间
+func uploadFirmware(camera *ptz.Camera, firmware []byte, status *FirmwareUpgradeStatus, entry *Entry) (time.Duration, error) {
+	start, err := startFirmwareUpgrade(camera)
+	if err == nil {
+		status.Method = "http"
+		entry.UpgradeDown("upload firmware to %s", start.UploadUri)
+		delay, _ := start.UploadDelay.TimeDuration()
+		time.Sleep(delay)
+		if err = postFirmware(camera, string(start.UploadUri), firmware, status, entry); err != nil {
+			return 0, err
+		}
+		entry.UpgradeUp("firmware uploaded")
+		downTime, _ := start.ExpectedDownTime.TimeDuration()
+		return downTime, nil
+	}
+	if !actionNotSupported(err) {
+		return 0, err
+	}
+
+	logrus.WithError(err).Warn("StartFirmwareUpgrade not supported, fallback to UpgradeSystemFirmware")
+	status.Method = "mtom"
+	entry.UpgradeDown("upgrade system firmware")
+	resp, err := camera.Device_UpgradeSystemFirmware(firmware)
+	if err != nil {
+		return 0, errors.Wrap(err, "UpgradeSystemFirmware err")
+	}
+	res := Device.UpgradeSystemFirmwareResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return 0, errors.Wrap(err, "UpgradeSystemFirmware err")
+	}
+	entry.UpgradeUp("firmware uploaded: %s", res.Message)
+	return 0, nil
+}
+
+func startFirmwareUpgrade(camera *ptz.Camera) (*Device.StartFirmwareUpgradeResponse, error) {
+	resp, err := camera.Device_StartFirmwareUpgrade()
+	if err != nil {
+		return nil, errors.Wrap(err, "StartFirmwareUpgrade err")
+	}
+	res := &Device.StartFirmwareUpgradeResponse{}
+	err = ptz.ParseResponse(resp, res)
+	if err != nil {
+		return nil, errors.Wrap(err, "StartFirmwareUpgrade err")
+	}
+	if res.UploadUri == "" {
+		return nil, errors.Wrap(errActionNotSupported, "StartFirmwareUpgrade err: empty upload uri")
+	}
+	return res, nil
+}
+
+// 以application/octet-stream上传固件，摄像头要求Digest认证时重新上传
+func postFirmware(camera *ptz.Camera, uri string, firmware []byte, status *FirmwareUpgradeStatus, entry *Entry) error {
+	newBody := func() io.Reader {
+		return &progressReader{
+			reader: bytes.NewReader(firmware),
+			total:  len(firmware),
+			report: func(progress int) {
+				entry.UpgradeDown("upload firmware %d%%", progress)
+				status.Progress = progress
+				reportUpgrade(status)
+			},
+		}
+	}
+	auth := &networking.DigestAuth{Username: camera.Username, Password: camera.Password}
+	resp, err := networking.Upload(uri, "application/octet-stream", int64(len(firmware)), newBody, auth, upgradeHTTPTimeout)
+	if err != nil {
+		return errors.Wrap(err, "upload firmware err")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return errors.Errorf("upload firmware err: %s", resp.Status)
+	}
+	return nil
+}
+
+// 记录上传进度
+type progressReader struct {
+	reader   io.Reader
+	total    int
+	read     int
+	progress int
+	report   func(progress int)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += n
+	progress := r.read * 100 / r.total / upgradeStep * upgradeStep
+	if progress > r.progress {
+		r.progress = progress
+		r.report(progress)
+	}
+	return n, err
+}
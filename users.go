@@ -0,0 +1,204 @@
+package camera
+
+import (
+	"camera/config"
+	"camera/goonvif/Device"
+	"camera/goonvif/xsd/onvif"
+	"camera/ptz"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+// 摄像头用户，password只用于下发，不会上报
+type CameraUser struct {
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	Level    string `json:"level,omitempty"`
+}
+
+// 可以设置的用户级别
+var userLevels = []string{"Administrator", "Operator", "User"}
+
+func userLevel(level string) (string, error) {
+	for _, l := range userLevels {
+		if strings.EqualFold(l, level) {
+			return l, nil
+		}
+	}
+	return "", errors.Errorf("unknown user level %s", level)
+}
+
+// 获取用户列表
+func DeviceGetUsers() error {
+	camera := newCamera()
+	users, err := getUsers(camera)
+	if err != nil {
+		return err
+	}
+	go handleResponse(users, handleGetUsers)
+	return nil
+}
+
+func getUsers(camera *ptz.Camera) ([]CameraUser, error) {
+	resp, err := camera.Device_GetUsers()
+	if err != nil {
+		return nil, errors.Wrap(err, "GetUsers err")
+	}
+	res := Device.GetUsersResponse{}
+	err = ptz.ParseResponse(resp, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetUsers err")
+	}
+	users := make([]CameraUser, 0, len(res.User))
+	for _, user := range res.User {
+		users = append(users, CameraUser{Username: user.Username, Level: string(user.UserLevel)})
+	}
+	return users, nil
+}
+
+// 创建用户，value为{"username":"","password":"","level":"User"}
+func DeviceCreateUser(value interface{}, commandID string) error {
+	user := CameraUser{}
+	if err := decodeDesired(value, &user); err != nil {
+		return errors.Wrap(err, "decode user err")
+	}
+	if user.Username == "" || user.Password == "" {
+		return errors.New("username and password are required")
+	}
+	if user.Level == "" {
+		user.Level = "User"
+	}
+	level, err := userLevel(user.Level)
+	if err != nil {
+		return err
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_CreateUsers(onvif.User{
+		Username:  user.Username,
+		Password:  user.Password,
+		UserLevel: onvif.UserLevel(level),
+	})
+	if err != nil {
+		return errors.Wrap(err, "CreateUsers err")
+	}
+	err = ptz.ParseResponse(resp, &Device.CreateUsersResponse{})
+	if err != nil {
+		return errors.Wrap(err, "CreateUsers err")
+	}
+	audit(CreateUser, "executed", commandID, user.Username)
+	return DeviceGetUsers()
+}
+
+// 删除用户，value为用户名或{"username":""}，不允许删除网关自身使用的账号
+func DeviceDeleteUser(value interface{}, commandID string) error {
+	user := CameraUser{}
+	switch v := value.(type) {
+	case string:
+		user.Username = v
+	default:
+		if err := decodeDesired(value, &user); err != nil {
+			return errors.Wrap(err, "decode user err")
+		}
+	}
+	if user.Username == "" {
+		return errors.New("username is required")
+	}
+	if user.Username == config.C.General.Username {
+		return errors.Errorf("user %s is used by the gateway", user.Username)
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_DeleteUsers(user.Username)
+	if err != nil {
+		return errors.Wrap(err, "DeleteUsers err")
+	}
+	err = ptz.ParseResponse(resp, &Device.DeleteUsersResponse{})
+	if err != nil {
+		return errors.Wrap(err, "DeleteUsers err")
+	}
+	audit(DeleteUser, "executed", commandID, user.Username)
+	return DeviceGetUsers()
+}
+
+// 修改用户密码或级别，value为{"username":"","password":"","level":""}，password和level可只给出一个
+func DeviceSetUser(value interface{}, commandID string) error {
+	user := CameraUser{}
+	if err := decodeDesired(value, &user); err != nil {
+		return errors.Wrap(err, "decode user err")
+	}
+	if user.Username == "" {
+		return errors.New("username is required")
+	}
+	if user.Password == "" && user.Level == "" {
+		return errors.New("password or level is required")
+	}
+
+	camera := newCamera()
+	// SetUser必须带上级别，只改密码时沿用原来的级别
+	if user.Level == "" {
+		users, err := getUsers(camera)
+		if err != nil {
+			return err
+		}
+		for _, u := range users {
+			if u.Username == user.Username {
+				user.Level = u.Level
+			}
+		}
+		if user.Level == "" {
+			return errors.Errorf("user %s not found", user.Username)
+		}
+	}
+	level, err := userLevel(user.Level)
+	if err != nil {
+		return err
+	}
+	if user.Username == config.C.General.Username && level != "Administrator" {
+		return errors.Errorf("user %s is used by the gateway and must stay Administrator", user.Username)
+	}
+
+	resp, err := camera.Device_SetUser(onvif.User{
+		Username:  user.Username,
+		Password:  user.Password,
+		UserLevel: onvif.UserLevel(level),
+	})
+	if err != nil {
+		return errors.Wrap(err, "SetUser err")
+	}
+	// 修改失败时摄像头返回soap fault，不能更新保存的密码
+	err = ptz.ParseResponse(resp, &Device.SetUserResponse{})
+	if err != nil {
+		return errors.Wrap(err, "SetUser err")
+	}
+	audit(SetUser, "executed", commandID, map[string]interface{}{"username": user.Username, "level": level, "password_changed": user.Password != ""})
+
+	// 修改的是网关自身使用的账号时，同步更新保存的密码
+	if user.Password != "" && user.Username == config.C.General.Username {
+		updateCredentials(user.Password)
+	}
+	return DeviceGetUsers()
+}
+
+// 更新网关保存的摄像头密码并写回配置文件
+func updateCredentials(password string) {
+	config.SetCameraPassword(password)
+	if err := config.Save("general.password", password); err != nil {
+		logrus.WithError(err).Error("save camera password error")
+	}
+
+	camera := newCamera()
+	resp, err := camera.Device_GetDeviceInformation()
+	if err != nil {
+		logrus.WithError(err).Error("verify camera credentials error")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		logrus.WithField("status", resp.Status).Error("camera rejected the new password")
+		return
+	}
+	NewEntry(Fields{"did": did, "username": config.C.General.Username}).DownLink("camera credentials updated")
+}
@@ -18,6 +18,124 @@ const (
 	TimeCalibration     = "TimeCalibration"     // 时间校准
 	TimeCalibrationData = "TimeCalibrationData" // 时间校准值
 	CameraStatus = "CameraStatus" // 设备状态
+
+	GetSupportedAnalyticsRules = "GetSupportedAnalyticsRules" // 获取支持的分析规则类型
+	SupportedAnalyticsRules    = "SupportedAnalyticsRules"    // 支持的分析规则类型
+	GetAnalyticsRules          = "GetAnalyticsRules"          // 获取分析规则
+	CreateAnalyticsRule        = "CreateAnalyticsRule"        // 创建分析规则
+	ModifyAnalyticsRule        = "ModifyAnalyticsRule"        // 修改分析规则
+	DeleteAnalyticsRule        = "DeleteAnalyticsRule"        // 删除分析规则
+	AnalyticsRules             = "AnalyticsRules"             // 分析规则
+
+	GetSupportedAnalyticsModules = "GetSupportedAnalyticsModules" // 获取支持的分析模块
+	SupportedAnalyticsModules    = "SupportedAnalyticsModules"    // 支持的分析模块
+	GetAnalyticsModules          = "GetAnalyticsModules"          // 获取分析模块
+	GetAnalyticsModuleOptions    = "GetAnalyticsModuleOptions"    // 获取分析模块参数约束
+	AnalyticsModuleOptions       = "AnalyticsModuleOptions"       // 分析模块参数约束
+	CreateAnalyticsModule        = "CreateAnalyticsModule"        // 创建分析模块
+	ModifyAnalyticsModule        = "ModifyAnalyticsModule"        // 修改分析模块
+	DeleteAnalyticsModule        = "DeleteAnalyticsModule"        // 删除分析模块
+	AnalyticsModules             = "AnalyticsModules"             // 分析模块
+
+	GetRelayOutputs        = "GetRelayOutputs"        // 获取继电器列表
+	SetRelayOutputSettings = "SetRelayOutputSettings" // 设置继电器模式
+	SetRelayOutputState    = "SetRelayOutputState"    // 触发继电器
+	RelayOutputs           = "RelayOutputs"           // 继电器状态
+
+	SystemReboot            = "SystemReboot"            // 远程重启
+	SetSystemFactoryDefault = "SetSystemFactoryDefault" // 恢复出厂设置
+	PendingConfirmation     = "PendingConfirmation"     // 待确认的危险操作
+	RebootRecoveryData      = "RebootRecovery"          // 重启恢复情况
+
+	UpgradeFirmware = "UpgradeFirmware" // 固件升级
+	FirmwareUpgrade = "FirmwareUpgrade" // 固件升级进度
+
+	GetInventory  = "GetInventory" // 获取资产信息
+	InventoryData = "Inventory"    // 资产信息
+
+	GetUsers   = "GetUsers"   // 获取用户列表
+	CreateUser = "CreateUser" // 创建用户
+	DeleteUser = "DeleteUser" // 删除用户
+	SetUser    = "SetUser"    // 修改用户密码或级别
+	Users      = "Users"      // 用户列表
+
+	GetNTP          = "GetNTP"          // 获取NTP服务器
+	SetNTP          = "SetNTP"          // 设置NTP服务器
+	SetDateTimeType = "SetDateTimeType" // 设置校时方式 NTP/Manual
+	NTP             = "NTP"             // NTP配置
+
+	CheckClockDrift = "CheckClockDrift" // 检测时钟偏差
+	ClockDriftData  = "ClockDrift"      // 时钟偏差
+
+	GetStreamUri           = "GetStreamUri"           // 获取视频流地址
+	StreamUri              = "StreamUri"              // 视频流地址
+	GetVideoEncoders       = "GetVideoEncoders"       // 获取视频编码配置
+	SetVideoEncoder        = "SetVideoEncoder"        // 修改视频编码配置
+	VideoEncoders          = "VideoEncoders"          // 视频编码配置
+	GetVideoEncoderOptions = "GetVideoEncoderOptions" // 获取视频编码参数约束
+	VideoEncoderOptions    = "VideoEncoderOptions"    // 视频编码参数约束
+	GetOSDs                = "GetOSDs"                // 获取OSD
+	SetOSD                 = "SetOSD"                 // 创建或修改OSD
+	DeleteOSD              = "DeleteOSD"              // 删除OSD
+	OSDs                   = "OSDs"                   // OSD列表
+	GetPrivacyMasks        = "GetPrivacyMasks"        // 获取隐私遮挡
+	SetPrivacyMask         = "SetPrivacyMask"         // 创建或修改隐私遮挡
+	DeletePrivacyMask      = "DeletePrivacyMask"      // 删除隐私遮挡
+	PrivacyMasks           = "PrivacyMasks"           // 隐私遮挡列表
+	GetImagingSettings     = "GetImagingSettings"     // 获取图像参数
+	SetImagingSettings     = "SetImagingSettings"     // 设置图像参数
+	ImagingSettings        = "ImagingSettings"        // 图像参数
+
+	GetRecordings    = "GetRecordings"    // 获取录像列表
+	Recordings       = "Recordings"       // 录像列表
+	SearchRecordings = "SearchRecordings" // 按时间范围搜索录像或事件
+	RecordingSearch  = "RecordingSearch"  // 录像搜索结果
+	GetReplayUri     = "GetReplayUri"     // 获取录像回放地址
+	ReplayUri        = "ReplayUri"        // 录像回放地址
+
+	GetStorage                 = "GetStorage"                 // 获取存储配置和SD卡状态
+	SetStorageConfiguration    = "SetStorageConfiguration"    // 创建或修改NAS/CIFS存储配置
+	DeleteStorageConfiguration = "DeleteStorageConfiguration" // 删除存储配置
+	Storage                    = "Storage"                    // 存储配置和SD卡状态
+
+	GetNetwork          = "GetNetwork"          // 获取网卡、网关、DNS、主机名和端口配置
+	SetNetworkInterface = "SetNetworkInterface" // 设置网卡地址(DHCP或静态IPv4)
+	SetDNS              = "SetDNS"              // 设置DNS
+	SetHostname         = "SetHostname"         // 设置主机名
+	SetNetworkProtocols = "SetNetworkProtocols" // 设置HTTP/RTSP端口
+	Network             = "Network"             // 网络配置
+
+	GetIPAddressFilter    = "GetIPAddressFilter"    // 获取IP地址过滤规则
+	SetIPAddressFilter    = "SetIPAddressFilter"    // 替换IP地址过滤规则
+	AddIPAddressFilter    = "AddIPAddressFilter"    // 添加过滤地址
+	RemoveIPAddressFilter = "RemoveIPAddressFilter" // 删除过滤地址
+	LockDownToGateway     = "LockDownToGateway"     // 只允许网关访问摄像头
+	IPAddressFilter       = "IPAddressFilter"       // IP地址过滤规则
+
+	GetCertificates           = "GetCertificates"           // 获取摄像头证书
+	CreateCertificateRequest  = "CreateCertificateRequest"  // 在摄像头上生成密钥和证书签名请求
+	LoadCertificate           = "LoadCertificate"           // 上传签名后的证书
+	LoadCACertificate         = "LoadCACertificate"         // 上传CA证书
+	SetClientCertificateMode  = "SetClientCertificateMode"  // 设置是否要求客户端证书
+	EnableHTTPS               = "EnableHTTPS"               // 启用证书和https
+	Certificates              = "Certificates"              // 摄像头证书
+	CertificateSigningRequest = "CertificateSigningRequest" // 证书签名请求
+
+	GetSystemLog                = "GetSystemLog"                // 获取系统日志并上传
+	GetSystemSupportInformation = "GetSystemSupportInformation" // 获取技术支持信息并上传
+	SystemLog                   = "SystemLog"                   // 系统日志的fid
+	SupportInformation          = "SupportInformation"          // 技术支持信息的fid
+
+	BackupSystem        = "BackupSystem"        // 备份摄像头配置到文件服务器
+	GetSystemBackups    = "GetSystemBackups"    // 获取备份记录
+	RestoreSystemBackup = "RestoreSystemBackup" // 恢复备份
+	SystemBackups       = "SystemBackups"       // 备份记录
+
+	CameraConfig    = "CameraConfig"    // 影子desired中为期望配置，reported中为实际配置
+	ReconcileConfig = "ReconcileConfig" // 立即检查期望配置
+	ConfigStateData = "ConfigState"     // 期望配置、实际配置和偏差
+
+	CommandResult = "CommandResult" // 命令执行失败的原因
 	/*----------------结束------------------------*/
 
 	// 命令回执